@@ -0,0 +1,83 @@
+package main
+
+// compares two xml files structurally, listing what changed (or writing an xml patch which makes the first into the second)
+//   xml-diff -key Item=Name old/items.xml new/items.xml
+//   xml-diff -key Item=@id -w -tolerance 0.001 -patch old/items.xml new/items.xml > items.patch.xml
+// exits with 1 if the files differ (and 2 on error), like diff
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+// -key Tag=Child or Tag=@attr (Tag may be * for any tag), repeatable
+type keyFlags map[string]xmltree.KeyFunc
+
+func (k keyFlags) String() string {
+	return ""
+}
+
+func (k keyFlags) Set(s string) error {
+	tag, key, err := xmltree.ParseKeySpec(s)
+	if err != nil {
+		return err
+	}
+	k[tag] = key
+	return nil
+}
+
+func main() {
+	keys := keyFlags{}
+	flag.Var(keys, "key", "match the given tag's elements by a child (Tag=Child) or attribute (Tag=@attr) rather than by position (repeatable, * for any tag)")
+	whitespace := flag.Bool("w", false, "ignore leading, trailing and repeated whitespace in values")
+	comments := flag.Bool("no-comments", false, "ignore comments")
+	tolerance := flag.Float64("tolerance", 0, "treat numbers which differ by no more than this as equal")
+	patch := flag.Bool("patch", false, "write an xml patch (see xml-patch) rather than a report")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] a.xml b.xml\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := xmltree.DiffOptions{Keys: keys, IgnoreWhitespace: *whitespace, IgnoreComments: *comments, Tolerance: *tolerance}
+	same, err := run(flag.Arg(0), flag.Arg(1), options, *patch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !same {
+		os.Exit(1)
+	}
+}
+
+func run(a, b string, options xmltree.DiffOptions, patch bool) (same bool, err error) {
+	ta, err := xmltree.LoadFromFile(a)
+	if err != nil {
+		return
+	}
+	tb, err := xmltree.LoadFromFile(b)
+	if err != nil {
+		return
+	}
+
+	d := xmltree.Diff(ta, tb, options)
+	same = d.Empty()
+	if !patch {
+		_, err = fmt.Print(d)
+		return
+	}
+
+	p, err := d.Patch()
+	if err != nil {
+		return
+	}
+	err = p.Write(os.Stdout)
+	return
+}
@@ -0,0 +1,94 @@
+package main
+
+// three-way merges xml files structurally (see xmltree.Merge3), writing the result over ours (as git expects of a merge driver)
+//   xml-merge -key Item=Name base.xml ours.xml theirs.xml
+// exits with 1 if there were conflicts (which are marked in the result), and 2 on error
+//
+// to have git use it for xml files:
+//   .gitattributes:  *.xml merge=xml
+//   .git/config:     [merge "xml"]
+//                        name = structural xml merge
+//                        driver = xml-merge -key Item=Name -path %P %O %A %B
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+// -key Tag=Child or Tag=@attr (Tag may be * for any tag), repeatable
+type keyFlags map[string]xmltree.KeyFunc
+
+func (k keyFlags) String() string {
+	return ""
+}
+
+func (k keyFlags) Set(s string) error {
+	tag, key, err := xmltree.ParseKeySpec(s)
+	if err != nil {
+		return err
+	}
+	k[tag] = key
+	return nil
+}
+
+func main() {
+	keys := keyFlags{}
+	flag.Var(keys, "key", "match the given tag's elements by a child (Tag=Child) or attribute (Tag=@attr) rather than by position (repeatable, * for any tag)")
+	whitespace := flag.Bool("w", false, "ignore leading, trailing and repeated whitespace in values")
+	tolerance := flag.Float64("tolerance", 0, "treat numbers which differ by no more than this as equal")
+	ours := flag.String("ours", "ours", "the label for our side of conflicts")
+	theirs := flag.String("theirs", "theirs", "the label for their side of conflicts")
+	output := flag.String("o", "", "write the result here (rather than over ours)")
+	path := flag.String("path", "", "the name to report conflicts under (rather than ours' filename, which for git is a temporary file)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] base.xml ours.xml theirs.xml\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = flag.Arg(1)
+	}
+	if *path == "" {
+		*path = flag.Arg(1)
+	}
+
+	options := xmltree.MergeOptions{
+		DiffOptions: xmltree.DiffOptions{Keys: keys, IgnoreWhitespace: *whitespace, Tolerance: *tolerance},
+		Ours:        *ours,
+		Theirs:      *theirs,
+	}
+	result, err := merge(flag.Arg(0), flag.Arg(1), flag.Arg(2), options)
+	if err == nil {
+		err = result.Tree.WriteToFile(*output)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(result.Conflicts) != 0 {
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(os.Stderr, "%s: conflict: %v\n", *path, c)
+		}
+		os.Exit(1)
+	}
+}
+
+func merge(base, ours, theirs string, options xmltree.MergeOptions) (result *xmltree.MergeResult, err error) {
+	trees := make([]*xmltree.XMLTree, 3)
+	for i, filename := range []string{base, ours, theirs} {
+		trees[i], err = xmltree.LoadFromFile(filename)
+		if err != nil {
+			return
+		}
+	}
+	result = xmltree.Merge3(trees[0], trees[1], trees[2], options)
+	return
+}
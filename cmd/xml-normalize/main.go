@@ -0,0 +1,113 @@
+package main
+
+// normalizes xml from stdin (or the given files, in place) so that equivalent data always produces identical bytes
+// usable as a git clean filter:
+//   git config filter.xml-normalize.clean "xml-normalize"
+//   echo "*.xml filter=xml-normalize" >> .gitattributes
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+func main() {
+	indent := flag.String("indent", "\t", "indentation string")
+	order := flag.String("attr-order", "", "per-tag attribute order, e.g. \"Item=id,name;Weapon=kind\"")
+	sort := flag.Bool("sort-attrs", true, "sort attributes alphabetically")
+	collapse := flag.Bool("collapse", true, "collapse whitespace in simple values")
+	numbers := flag.String("numbers", "", "normalize the numbers of these fields, e.g. \"Cost,Item/@weight,*/@scale\" (this changes values as text: 1.10 -> 1.1)")
+	flag.Parse()
+
+	normalize := &xmltree.Normalization{
+		SortAttributes:     *sort,
+		AttributeOrder:     parseAttributeOrder(*order),
+		CollapseWhitespace: *collapse,
+		NormalizeNumbers:   parseFields(*numbers),
+		StripTrailingSpace: true,
+	}
+
+	// no files: act as a filter
+	if flag.NArg() == 0 {
+		err := normalizeStream(os.Stdin, os.Stdout, *indent, normalize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, filename := range flag.Args() {
+		err := normalizeFile(filename, *indent, normalize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func normalizeStream(in io.Reader, out io.Writer, indent string, normalize *xmltree.Normalization) (err error) {
+	tree := new(xmltree.XMLTree)
+	err = tree.Read(in)
+	if err != nil {
+		return
+	}
+
+	encoder := xmltree.NewEncoder(out)
+	encoder.Configure("", indent)
+	encoder.ConfigureNormalization(normalize)
+	err = tree.Encode(encoder)
+	return
+}
+
+func normalizeFile(filename, indent string, normalize *xmltree.Normalization) (err error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	// we rewrite the file in place, so it keeps its permissions
+	info, err := in.Stat()
+	if err != nil {
+		in.Close()
+		return
+	}
+	sb := &strings.Builder{}
+	err = normalizeStream(in, sb, indent, normalize)
+	in.Close()
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(filename, []byte(sb.String()), info.Mode().Perm())
+	return
+}
+
+// "Item=id,name;Weapon=kind" -> {"Item": {"id", "name"}, "Weapon": {"kind"}}
+func parseAttributeOrder(s string) (order map[string][]string) {
+	order = map[string][]string{}
+	for _, spec := range strings.Split(s, ";") {
+		tag, attrs, ok := strings.Cut(spec, "=")
+		if !ok {
+			continue
+		}
+		order[strings.TrimSpace(tag)] = strings.Split(attrs, ",")
+	}
+	return
+}
+
+// "Cost, Item/@weight" -> {"Cost", "Item/@weight"}
+func parseFields(s string) (fields []string) {
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
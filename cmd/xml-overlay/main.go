@@ -0,0 +1,152 @@
+package main
+
+// applies overlays (partial xml, see xmltree.OverlayMerger) to a base file in load order, writing the merged xml to stdout
+//   xml-overlay -key Item=Name base/items.xml mods/a/items.xml mods/b/items.xml > items.xml
+//   xml-overlay -key Item=Name -report base/items.xml mods/*/items.xml    (which overlay last touched each value)
+//   xml-overlay -key Item=Name -conflicts -format json base/items.xml mods/*/items.xml    (what more than one overlay touches)
+//   xml-overlay -key Item=Name -make edited/items.xml base/items.xml > mods/mine/items.xml    (the overlay for a hand-edited copy)
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+// -key Tag=Child or Tag=@attr (Tag may be * for any tag), repeatable
+type keyFlags map[string]xmltree.KeyFunc
+
+func (k keyFlags) String() string {
+	return ""
+}
+
+func (k keyFlags) Set(s string) error {
+	tag, key, err := xmltree.ParseKeySpec(s)
+	if err != nil {
+		return err
+	}
+	k[tag] = key
+	return nil
+}
+
+func main() {
+	keys := keyFlags{}
+	flag.Var(keys, "key", "match the given tag's elements by a child (Tag=Child) or attribute (Tag=@attr) rather than by position (repeatable, * for any tag)")
+	directive := flag.String("directive", "merge", "the attribute holding merge directives (replace, delete, append or remove)")
+	report := flag.Bool("report", false, "list which overlay last touched each value, rather than writing the merged xml")
+	conflicts := flag.Bool("conflicts", false, "list every element and value which more than one overlay touches, rather than writing the merged xml")
+	format := flag.String("format", "text", "the format of -conflicts: text or json")
+	modified := flag.String("make", "", "write the smallest overlay which turns base into this (modified) file, rather than merging")
+	strictOrder := flag.Bool("strict-order", false, "with -make, fail if the modified file changed the order of elements (which overlays can't express, so is otherwise left out)")
+	output := flag.String("o", "", "write the merged xml (or the overlay) here (rather than to stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] base.xml overlays...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := xmltree.OverlayOptions{Keys: keys, Directive: *directive}
+	if *modified != "" {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err := makeOverlay(flag.Arg(0), *modified, xmltree.MakeOverlayOptions{OverlayOptions: options, StrictOrder: *strictOrder}, *output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *conflicts {
+		err := analyze(flag.Arg(0), flag.Args()[1:], options, *format)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	m, err := merge(flag.Arg(0), flag.Args()[1:], options)
+	if err == nil {
+		switch {
+		case *report:
+			_, err = fmt.Print(m)
+		case *output != "":
+			err = m.Tree().WriteToFile(*output)
+		default:
+			err = m.Tree().Write(os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func merge(base string, overlays []string, options xmltree.OverlayOptions) (m *xmltree.OverlayMerger, err error) {
+	tree, err := xmltree.LoadFromFile(base)
+	if err != nil {
+		return
+	}
+	m = xmltree.NewOverlayMerger(tree, options)
+	for _, filename := range overlays {
+		err = m.ApplyFile(filename)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func analyze(base string, filenames []string, options xmltree.OverlayOptions, format string) (err error) {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q (expected text or json)", format)
+	}
+
+	tree, err := xmltree.LoadFromFile(base)
+	if err != nil {
+		return
+	}
+	overlays := make([]xmltree.Overlay, len(filenames))
+	for i, filename := range filenames {
+		overlays[i].Name = filename
+		overlays[i].Tree, err = xmltree.LoadFromFile(filename)
+		if err != nil {
+			return
+		}
+	}
+
+	report, err := xmltree.AnalyzeOverlays(tree, overlays, options)
+	if err != nil {
+		return
+	}
+	if format == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+	_, err = fmt.Print(report)
+	return
+}
+
+func makeOverlay(base, modified string, options xmltree.MakeOverlayOptions, output string) (err error) {
+	trees := make([]*xmltree.XMLTree, 2)
+	for i, filename := range []string{base, modified} {
+		trees[i], err = xmltree.LoadFromFile(filename)
+		if err != nil {
+			return
+		}
+	}
+	overlay, err := xmltree.MakeOverlay(trees[0], trees[1], options)
+	if err != nil {
+		return
+	}
+	if output != "" {
+		return overlay.WriteToFile(output)
+	}
+	return overlay.Write(os.Stdout)
+}
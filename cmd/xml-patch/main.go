@@ -0,0 +1,94 @@
+package main
+
+// applies an xml patch (rfc 5261) to xml from stdin (writing the result to stdout), or to the given files in place
+//   xml-patch balance.patch.xml items/*.xml
+//   xml-patch -n balance.patch.xml items/*.xml    (dry run: list what would change)
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+func main() {
+	dryRun := flag.Bool("n", false, "dry run: list what would change, without changing anything")
+	keepGoing := flag.Bool("keep-going", false, "apply every operation that can be (rather than none, if any fails)")
+	verbose := flag.Bool("v", false, "list every change made")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] patch.xml [files...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	patch, err := xmltree.LoadPatch(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+	options := xmltree.PatchOptions{DryRun: *dryRun, KeepGoing: *keepGoing}
+
+	// no files: act as a filter
+	if flag.NArg() == 1 {
+		tree := new(xmltree.XMLTree)
+		err = tree.Read(os.Stdin)
+		if err == nil {
+			err = apply(patch, tree, options, "", *verbose || *dryRun)
+		}
+		if err == nil && !*dryRun {
+			err = tree.Write(os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, filename := range flag.Args()[1:] {
+		err := patchFile(patch, filename, options, *verbose || *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// applies the patch, listing its changes on stderr (so as not to mix them with the output of a filter)
+func apply(patch *xmltree.Patch, tree *xmltree.XMLTree, options xmltree.PatchOptions, filename string, list bool) (err error) {
+	result, err := patch.Apply(tree, options)
+	if list {
+		for _, c := range result.Changes {
+			if filename != "" {
+				fmt.Fprintf(os.Stderr, "%s: ", filename)
+			}
+			fmt.Fprintln(os.Stderr, c)
+		}
+	}
+	return
+}
+
+func patchFile(patch *xmltree.Patch, filename string, options xmltree.PatchOptions, list bool) (err error) {
+	tree, err := xmltree.LoadFromFile(filename)
+	if err != nil {
+		return
+	}
+	err = apply(patch, tree, options, filename, list)
+	// with KeepGoing, what did apply is still written (and the failures still reported)
+	if options.DryRun || err != nil && !options.KeepGoing {
+		return
+	}
+	if e := tree.WriteToFile(filename); e != nil {
+		err = e
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package main
+
+// runs a sql flavored query over xml from stdin (or the given files, queried together as one tree)
+//   xml-query "SELECT Name, Damage FROM //Item WHERE Damage > 10 ORDER BY Damage DESC" items/*.xml
+//   xml-query -format csv "SELECT Category, COUNT(*), AVG(Cost) FROM //Item GROUP BY Category" < items.xml
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucky-wolf/xml-tree/xmltree"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format: text, csv or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] query [files...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Arg(0), flag.Args()[1:], *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(query string, filenames []string, format string) (err error) {
+	q, err := xmltree.CompileSQL(query)
+	if err != nil {
+		return
+	}
+
+	tree, err := load(filenames)
+	if err != nil {
+		return
+	}
+
+	table, err := q.Run(tree)
+	if err != nil {
+		return
+	}
+
+	switch format {
+	case "text":
+		_, err = fmt.Print(table)
+	case "csv":
+		err = table.WriteCSV(os.Stdout)
+	case "json":
+		err = table.WriteJSON(os.Stdout)
+	default:
+		err = fmt.Errorf("unknown format %q (expected text, csv or json)", format)
+	}
+	return
+}
+
+// stdin, or every file's top level elements in a single tree
+func load(filenames []string) (tree *xmltree.XMLTree, err error) {
+	tree = new(xmltree.XMLTree)
+	if len(filenames) == 0 {
+		err = tree.Read(os.Stdin)
+		return
+	}
+
+	var elements []any
+	for _, filename := range filenames {
+		var t *xmltree.XMLTree
+		t, err = xmltree.LoadFromFile(filename)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", filename, err)
+			return
+		}
+		for _, e := range t.Elements.Elements() {
+			elements = append(elements, e)
+		}
+	}
+	tree.Elements.SetContents(elements)
+	return
+}
@@ -2,4 +2,7 @@ module github.com/lucky-wolf/xml-tree
 
 go 1.23.3
 
-require golang.org/x/exp v0.0.0-20241108182801-04b207964beb
+require (
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/exp v0.0.0-20241108182801-04b207964beb
+)
@@ -0,0 +1,192 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// aggregation over selections: count, sum, min, max, mean, percentiles, and grouping by a key
+// values which are missing or fail to parse are reported (see Stats.Err), never treated as zero
+
+// returns the number to aggregate for an element
+type NumberFunc func(e *XMLElement) (float64, error)
+
+// the number in the given child's value
+func NumberOfChild(tag string) NumberFunc {
+	return func(e *XMLElement) (float64, error) {
+		c := e.Child(tag)
+		if c == nil {
+			return 0, fmt.Errorf("no child %s", tag)
+		}
+		return c.number()
+	}
+}
+
+// the number in the named attribute
+func NumberOfAttr(name string) NumberFunc {
+	return func(e *XMLElement) (float64, error) {
+		return e.AttrFloat(name)
+	}
+}
+
+// the number in the element's own value
+func NumberOfValue(e *XMLElement) (float64, error) {
+	return e.number()
+}
+
+// our value as a number (with an error that says what we held if it wasn't one)
+func (e *XMLElement) number() (value float64, err error) {
+	s, ok := e.GetStringValue()
+	if !ok {
+		err = fmt.Errorf("%s is not a simple value", e.Name.Local)
+		return
+	}
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		err = fmt.Errorf("%s is not a number: %q", e.Name.Local, s)
+	}
+	return
+}
+
+// summary statistics over a set of values
+type Stats struct {
+	Count    int // how many values were aggregated (failures aren't counted)
+	Sum      float64
+	Min      float64 // min, max and mean are NaN if Count is 0
+	Max      float64
+	Mean     float64
+	Failures []error // the elements whose values were missing or unparsable (and why)
+	sorted   []float64
+}
+
+func newStats() *Stats {
+	return &Stats{Min: math.NaN(), Max: math.NaN(), Mean: math.NaN()}
+}
+
+func (st *Stats) add(e *XMLElement, value NumberFunc) {
+	v, err := value(e)
+	if err != nil {
+		st.Failures = append(st.Failures, fmt.Errorf("%s: %w", e.Path(), err))
+		return
+	}
+	if st.Count == 0 || v < st.Min {
+		st.Min = v
+	}
+	if st.Count == 0 || v > st.Max {
+		st.Max = v
+	}
+	st.Count++
+	st.Sum += v
+	st.Mean = st.Sum / float64(st.Count)
+	st.sorted = append(st.sorted, v)
+}
+
+// every value that failed (joined), or nil
+func (st *Stats) Err() error {
+	return errors.Join(st.Failures...)
+}
+
+// the value below which p percent of our values fall (p from 0 to 100, interpolating between the nearest ranks)
+// returns NaN if we have no values
+func (st *Stats) Percentile(p float64) float64 {
+	if st.Count == 0 {
+		return math.NaN()
+	}
+	slices.Sort(st.sorted)
+	p = math.Max(0, math.Min(100, p))
+	rank := p / 100 * float64(st.Count-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return st.sorted[lo] + (st.sorted[hi]-st.sorted[lo])*(rank-float64(lo))
+}
+
+// the 50th percentile
+func (st *Stats) Median() float64 {
+	return st.Percentile(50)
+}
+
+func (st *Stats) String() string {
+	s := fmt.Sprintf("count=%d sum=%g min=%g max=%g mean=%g median=%g", st.Count, st.Sum, st.Min, st.Max, st.Mean, st.Median())
+	if len(st.Failures) != 0 {
+		s += fmt.Sprintf(" failures=%d", len(st.Failures))
+	}
+	return s
+}
+
+// stats for each distinct key
+type GroupedStats struct {
+	Keys    []string // in order of first appearance
+	Groups  map[string]*Stats
+	Unkeyed []error // the elements which had no key (and so weren't grouped)
+}
+
+// every failure in every group, along with any unkeyed elements (joined), or nil
+func (g *GroupedStats) Err() error {
+	errs := slices.Clone(g.Unkeyed)
+	for _, k := range g.Keys {
+		errs = append(errs, g.Groups[k].Failures...)
+	}
+	return errors.Join(errs...)
+}
+
+////////////////////////////////////////////////////
+// selections
+
+// statistics over value for every selected element
+func (s *Selection) Stats(value NumberFunc) (st *Stats) {
+	st = newStats()
+	for _, e := range s.elements {
+		st.add(e, value)
+	}
+	return
+}
+
+// statistics over the given child's value of every selected element
+func (s *Selection) StatsOf(tag string) *Stats {
+	return s.Stats(NumberOfChild(tag))
+}
+
+// the sum of the given child's value over every selected element (errors if any are missing or unparsable)
+func (s *Selection) Sum(tag string) (sum float64, err error) {
+	st := s.StatsOf(tag)
+	return st.Sum, st.Err()
+}
+
+// statistics over value for the selected elements, grouped by key (e.g. KeyByChild("Category"))
+func (s *Selection) GroupBy(key KeyFunc, value NumberFunc) (g *GroupedStats) {
+	g = &GroupedStats{Groups: map[string]*Stats{}}
+	for _, e := range s.elements {
+		k, ok := key(e)
+		if !ok {
+			g.Unkeyed = append(g.Unkeyed, fmt.Errorf("%s: has no key to group by", e.Path()))
+			continue
+		}
+		st, found := g.Groups[k]
+		if !found {
+			st = newStats()
+			g.Groups[k] = st
+			g.Keys = append(g.Keys, k)
+		}
+		st.add(e, value)
+	}
+	return
+}
+
+// the number of selected elements in each group (in order of first appearance)
+func (s *Selection) CountBy(key KeyFunc) (keys []string, counts map[string]int) {
+	counts = map[string]int{}
+	for _, e := range s.elements {
+		k, ok := key(e)
+		if !ok {
+			continue
+		}
+		if counts[k] == 0 {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	return
+}
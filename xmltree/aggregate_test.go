@@ -0,0 +1,99 @@
+package xmltree
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+const aggregateTestXML = `<Items>
+	<Item cost="5"><Category>Blade</Category><Damage>10</Damage></Item>
+	<Item cost="3"><Category>Blunt</Category><Damage>6</Damage></Item>
+	<Item cost="8"><Category>Blade</Category><Damage>14</Damage></Item>
+	<Item cost="x"><Category>Blade</Category><Damage>high</Damage></Item>
+	<Item cost="1"><Damage>2</Damage></Item>
+</Items>`
+
+func TestStats(t *testing.T) {
+	tree := readTree(t, aggregateTestXML)
+	st := tree.QueryAt("Items/Item").StatsOf("Damage")
+	if st.Count != 4 || st.Sum != 32 || st.Min != 2 || st.Max != 14 || st.Mean != 8 {
+		t.Errorf("got %s", st)
+	}
+	if st.Median() != 8 {
+		t.Errorf("got median %g, want 8", st.Median())
+	}
+
+	// the unparsable value is reported, not counted as zero
+	if len(st.Failures) != 1 || st.Err() == nil {
+		t.Errorf("got failures %v", st.Failures)
+	}
+
+	st = tree.QueryAt("Items/Item").Stats(NumberOfAttr("cost"))
+	if st.Count != 4 || st.Sum != 17 || len(st.Failures) != 1 {
+		t.Errorf("got %s", st)
+	}
+
+	st = tree.QueryAt("Items/Item/Damage").Stats(NumberOfValue)
+	if st.Count != 4 || st.Sum != 32 {
+		t.Errorf("got %s", st)
+	}
+}
+
+func TestStatsMissing(t *testing.T) {
+	tree := readTree(t, aggregateTestXML)
+	st := tree.QueryAt("Items/Item").StatsOf("Weight")
+	if st.Count != 0 || len(st.Failures) != 5 {
+		t.Errorf("got %s", st)
+	}
+	if !math.IsNaN(st.Min) || !math.IsNaN(st.Max) || !math.IsNaN(st.Mean) || !math.IsNaN(st.Median()) {
+		t.Errorf("empty stats should be NaN, got %s", st)
+	}
+
+	if _, err := tree.QueryAt("Items/Item").Sum("Damage"); err == nil {
+		t.Error("Sum should report the unparsable value")
+	}
+	sum, err := tree.QueryAt("Items/Item").Filter(func(e *XMLElement) bool { v, _ := e.Attribute("cost"); return v != "x" }).Sum("Damage")
+	if err != nil || sum != 32 {
+		t.Errorf("got %g, %v", sum, err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	st := newStats()
+	for _, v := range []float64{40, 10, 30, 20} {
+		st.add(nil, func(*XMLElement) (float64, error) { return v, nil })
+	}
+	tests := []struct {
+		p, want float64
+	}{
+		{0, 10}, {100, 40}, {50, 25}, {25, 17.5}, {-5, 10}, {150, 40},
+	}
+	for _, tt := range tests {
+		if got := st.Percentile(tt.p); got != tt.want {
+			t.Errorf("p%g: got %g, want %g", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	tree := readTree(t, aggregateTestXML)
+	g := tree.QueryAt("Items/Item").GroupBy(KeyByChild("Category"), NumberOfChild("Damage"))
+	if !slices.Equal(g.Keys, []string{"Blade", "Blunt"}) {
+		t.Fatalf("got keys %q", g.Keys)
+	}
+	if st := g.Groups["Blade"]; st.Count != 2 || st.Mean != 12 || len(st.Failures) != 1 {
+		t.Errorf("Blade: got %s", st)
+	}
+	if st := g.Groups["Blunt"]; st.Count != 1 || st.Sum != 6 {
+		t.Errorf("Blunt: got %s", st)
+	}
+	if len(g.Unkeyed) != 1 || g.Err() == nil {
+		t.Errorf("got unkeyed %v", g.Unkeyed)
+	}
+
+	keys, counts := tree.QueryAt("Items/Item").CountBy(KeyByChild("Category"))
+	if !slices.Equal(keys, []string{"Blade", "Blunt"}) || counts["Blade"] != 3 || counts["Blunt"] != 1 {
+		t.Errorf("got %q %v", keys, counts)
+	}
+}
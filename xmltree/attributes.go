@@ -0,0 +1,270 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+)
+
+// attribute manipulation
+// attributes are matched by local name (like Attribute), and values are formatted the same way as SetValue
+// (floats use the tree's number formatting for the attribute's name, see NumberFormatter.Attrs)
+
+// the index of the named attribute in e.Attr (-1 if we don't have it)
+func (e *XMLElement) AttributeIndex(name string) int {
+	return slices.IndexFunc(e.Attr, func(a xml.Attr) bool { return a.Name.Local == name })
+}
+
+// true if we have the named attribute
+func (e *XMLElement) HasAttribute(name string) bool {
+	return e.AttributeIndex(name) != -1
+}
+
+// sets the named attribute to the given value (appending it after our existing attributes if we don't already have it)
+// panics (with ErrNotWellFormed) if name isn't a valid attribute name (see IsValidName), as SetContents does for invalid contents
+func (e *XMLElement) SetAttribute(name string, value any) {
+	if !IsValidName(name) {
+		err := notWellFormed("invalid attribute name %q", name)
+		panic(err)
+	}
+	s := formatValue(e.attrNumberFormatter(name), value)
+	e.record()
+	if i := e.AttributeIndex(name); i != -1 {
+		e.Attr[i].Value = s
+	} else {
+		e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: s})
+	}
+	e.touch()
+}
+
+// sets the named attribute, placing it at the given index in e.Attr (moving it there if we already have it)
+func (e *XMLElement) InsertAttributeAt(index int, name string, value any) (err error) {
+	if !IsValidName(name) {
+		err = notWellFormed("invalid attribute name %q", name)
+		return
+	}
+	attr := xml.Attr{Name: xml.Name{Local: name}, Value: formatValue(e.attrNumberFormatter(name), value)}
+	i := e.AttributeIndex(name)
+	count := len(e.Attr)
+	if i != -1 {
+		count-- // we'll be removed before we're inserted
+	}
+	if index < 0 || index > count {
+		err = fmt.Errorf("attribute index %d out of bounds in %s", index, e.Name.Local)
+		return
+	}
+	e.record()
+	if i != -1 {
+		attr.Name = e.Attr[i].Name // keep its namespace
+		e.Attr = slices.Delete(e.Attr, i, i+1)
+	}
+	e.Attr = slices.Insert(e.Attr, index, attr)
+	e.touch()
+	return
+}
+
+// sets the named attribute, placing it immediately before the attribute called before
+func (e *XMLElement) SetAttributeBefore(before, name string, value any) (err error) {
+	return e.setAttributeBeside(before, 0, name, value)
+}
+
+// sets the named attribute, placing it immediately after the attribute called after
+func (e *XMLElement) SetAttributeAfter(after, name string, value any) (err error) {
+	return e.setAttributeBeside(after, 1, name, value)
+}
+
+func (e *XMLElement) setAttributeBeside(anchor string, offset int, name string, value any) (err error) {
+	if !IsValidName(name) {
+		err = notWellFormed("invalid attribute name %q", name)
+		return
+	}
+	if anchor == name {
+		e.SetAttribute(name, value)
+		return
+	}
+	if !e.HasAttribute(anchor) {
+		err = fmt.Errorf("no attribute %s found in %s to place %s beside", anchor, e.Name.Local, name)
+		return
+	}
+	// subtle: remove ourselves first, so that the anchor's index is where it will be when we insert
+	e.record()
+	removed, had := e.removeAttribute(name)
+	index := e.AttributeIndex(anchor) + offset
+	if had {
+		e.Attr = slices.Insert(e.Attr, index, removed)
+		e.Attr[index].Value = formatValue(e.attrNumberFormatter(name), value)
+		e.touch()
+		return
+	}
+	return e.InsertAttributeAt(index, name, value)
+}
+
+// removes the named attribute (ok is true if we had it)
+func (e *XMLElement) RemoveAttribute(name string) (ok bool) {
+	if !e.HasAttribute(name) {
+		return
+	}
+	e.record()
+	_, ok = e.removeAttribute(name)
+	if ok {
+		e.touch()
+	}
+	return
+}
+
+func (e *XMLElement) removeAttribute(name string) (attr xml.Attr, ok bool) {
+	i := e.AttributeIndex(name)
+	if i == -1 {
+		return
+	}
+	attr, ok = e.Attr[i], true
+	e.Attr = slices.Delete(e.Attr, i, i+1)
+	return
+}
+
+////////////////////////////////////////////////////
+// typed getters
+
+// returns the named attribute's value, or an error if we don't have it
+func (e *XMLElement) AttrString(name string) (value string, err error) {
+	value, ok := e.Attribute(name)
+	if !ok {
+		err = fmt.Errorf("no attribute %s found in %s", name, e.Name.Local)
+	}
+	return
+}
+
+// returns the named attribute's value parsed as a float
+func (e *XMLElement) AttrFloat(name string) (value float64, err error) {
+	s, err := e.AttrString(name)
+	if err != nil {
+		return
+	}
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		err = fmt.Errorf("attribute %s in %s: %w", name, e.Name.Local, err)
+	}
+	return
+}
+
+// returns the named attribute's value parsed as an int
+func (e *XMLElement) AttrInt(name string) (value int64, err error) {
+	s, err := e.AttrString(name)
+	if err != nil {
+		return
+	}
+	value, err = strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("attribute %s in %s: %w", name, e.Name.Local, err)
+	}
+	return
+}
+
+// returns the named attribute's value parsed as a bool (1, t, true, 0, f, false, etc. - see strconv.ParseBool)
+func (e *XMLElement) AttrBool(name string) (value bool, err error) {
+	s, err := e.AttrString(name)
+	if err != nil {
+		return
+	}
+	value, err = strconv.ParseBool(s)
+	if err != nil {
+		err = fmt.Errorf("attribute %s in %s: %w", name, e.Name.Local, err)
+	}
+	return
+}
+
+// returns the named attribute's value, or def if we don't have it
+func (e *XMLElement) AttrOr(name string, def string) string {
+	if value, ok := e.Attribute(name); ok {
+		return value
+	}
+	return def
+}
+
+////////////////////////////////////////////////////
+// numeric updates
+
+// updates the named attribute to be scaled by the given input (it must exist and be numeric)
+func (e *XMLElement) ScaleAttrBy(name string, scale float64) (err error) {
+
+	// scaling by 1 is a noop
+	if scale == 1.0 {
+		return
+	}
+
+	value, err := e.AttrFloat(name)
+	if err != nil {
+		return
+	}
+
+	e.SetAttribute(name, value*scale)
+	return
+}
+
+// updates the named attribute to be its current value + adjustment (it must exist and be numeric)
+func (e *XMLElement) AdjustAttrBy(name string, adjustment float64) (err error) {
+
+	// offset by 0 is a noop
+	if adjustment == 0 {
+		return
+	}
+
+	value, err := e.AttrFloat(name)
+	if err != nil {
+		return
+	}
+
+	e.SetAttribute(name, value+adjustment)
+	return
+}
+
+////////////////////////////////////////////////////
+// attribute based search
+
+// true if we have the named attribute with the given value
+func (e *XMLElement) MatchesAttr(name, value string) bool {
+	v, ok := e.Attribute(name)
+	return ok && v == value
+}
+
+// true if we have all of the given attributes (Tag being the attribute name) with their given values
+func (e *XMLElement) MatchesAllAttrs(properties ...SearchProperty) bool {
+	for _, p := range properties {
+		if !e.MatchesAttr(p.Tag, p.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns our first child element with the named attribute set to value
+func (e *XMLElement) ChildWithAttr(name, value string) *XMLElement {
+	for c := range e.ChildElements() {
+		if c.MatchesAttr(name, value) {
+			return c
+		}
+	}
+	return nil
+}
+
+// returns our first child element with the given tag and the named attribute set to value
+func (e *XMLElement) ChildNamedWithAttr(tag, name, value string) *XMLElement {
+	for _, c := range e.ChildrenNamed(tag) {
+		if c.MatchesAttr(name, value) {
+			return c
+		}
+	}
+	return nil
+}
+
+// finds the first element with the named attribute set to value (breadth first, like Find)
+func (tree *XMLTree) FindByAttr(name, value string) (parent, element *XMLElement) {
+	return tree.FindUsing(func(element *XMLElement) bool { return element.MatchesAttr(name, value) })
+}
+
+// every element with the named attribute set to value (breadth first, like Find)
+func (tree *XMLTree) FindAllByAttr(name, value string) iter.Seq2[*XMLElement, *XMLElement] {
+	return tree.Matching(func(element *XMLElement) bool { return element.MatchesAttr(name, value) })
+}
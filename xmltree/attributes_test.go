@@ -0,0 +1,181 @@
+package xmltree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetAttribute(t *testing.T) {
+	e := readTree(t, `<a x="1" y="2" />`).Elements.Elements()[0]
+	e.SetAttribute("x", 3)
+	e.SetAttribute("z", 0.5)
+	e.SetAttribute("w", true)
+	if got, want := e.String(), `<a x="3" y="2" z="0.5" w="true" />`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if !e.RemoveAttribute("y") || e.RemoveAttribute("y") || e.HasAttribute("y") {
+		t.Error("RemoveAttribute")
+	}
+	if got, want := e.String(), `<a x="3" z="0.5" w="true" />`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlaceAttribute(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(e *XMLElement) error
+		want string
+	}{
+		{"insert first", func(e *XMLElement) error { return e.InsertAttributeAt(0, "w", 0) }, `<a w="0" x="1" y="2" z="3" />`},
+		{"insert last", func(e *XMLElement) error { return e.InsertAttributeAt(3, "w", 0) }, `<a x="1" y="2" z="3" w="0" />`},
+		{"move", func(e *XMLElement) error { return e.InsertAttributeAt(0, "z", 9) }, `<a z="9" x="1" y="2" />`},
+		{"move last", func(e *XMLElement) error { return e.InsertAttributeAt(2, "x", 9) }, `<a y="2" z="3" x="9" />`},
+		{"before", func(e *XMLElement) error { return e.SetAttributeBefore("y", "w", 0) }, `<a x="1" w="0" y="2" z="3" />`},
+		{"after", func(e *XMLElement) error { return e.SetAttributeAfter("y", "w", 0) }, `<a x="1" y="2" w="0" z="3" />`},
+		{"move before", func(e *XMLElement) error { return e.SetAttributeBefore("x", "z", 9) }, `<a z="9" x="1" y="2" />`},
+		{"move after", func(e *XMLElement) error { return e.SetAttributeAfter("z", "x", 9) }, `<a y="2" z="3" x="9" />`},
+		{"beside itself", func(e *XMLElement) error { return e.SetAttributeAfter("y", "y", 9) }, `<a x="1" y="9" z="3" />`},
+	}
+	for _, test := range tests {
+		e := readTree(t, `<a x="1" y="2" z="3" />`).Elements.Elements()[0]
+		if err := test.edit(e); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := e.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	e := readTree(t, `<a x="1" />`).Elements.Elements()[0]
+	for _, err := range []error{
+		e.InsertAttributeAt(2, "w", 0),
+		e.InsertAttributeAt(-1, "w", 0),
+		e.InsertAttributeAt(1, "x", 0),
+		e.SetAttributeBefore("missing", "w", 0),
+	} {
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+	if got := e.String(); got != `<a x="1" />` {
+		t.Errorf("failed edits changed the element: %q", got)
+	}
+}
+
+func TestAttributeNamesAreValidated(t *testing.T) {
+	e := MakeElement("a")
+	for _, name := range []string{"", "1x", "a b", "a=b", `"`} {
+		for _, err := range []error{
+			e.InsertAttributeAt(0, name, 1),
+			e.SetAttributeBefore("x", name, 1),
+			e.SetAttributeAfter(name, name, 1),
+		} {
+			if !errors.Is(err, ErrNotWellFormed) {
+				t.Errorf("%q: got %v, want %v", name, err, ErrNotWellFormed)
+			}
+		}
+
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrNotWellFormed) {
+					t.Errorf("SetAttribute(%q): got %v, want a panic with %v", name, err, ErrNotWellFormed)
+				}
+			}()
+			e.SetAttribute(name, 1)
+		}()
+	}
+	if len(e.Attr) != 0 {
+		t.Errorf("got attributes %v", e.Attr)
+	}
+
+	// queries report it rather than panicking
+	tree := readTree(t, `<a><b /></a>`)
+	if err := tree.Query("b").Attr("a b", 1).Err(); !errors.Is(err, ErrNotWellFormed) {
+		t.Errorf("Selection.Attr: got %v, want %v", err, ErrNotWellFormed)
+	}
+}
+
+func TestTypedAttributes(t *testing.T) {
+	e := readTree(t, `<a s="x" f="1.5" i="42" b="true" bad="z" />`).Elements.Elements()[0]
+
+	if v, err := e.AttrString("s"); err != nil || v != "x" {
+		t.Errorf("AttrString: got %q, %v", v, err)
+	}
+	if v, err := e.AttrFloat("f"); err != nil || v != 1.5 {
+		t.Errorf("AttrFloat: got %v, %v", v, err)
+	}
+	if v, err := e.AttrInt("i"); err != nil || v != 42 {
+		t.Errorf("AttrInt: got %v, %v", v, err)
+	}
+	if v, err := e.AttrBool("b"); err != nil || !v {
+		t.Errorf("AttrBool: got %v, %v", v, err)
+	}
+	if e.AttrOr("s", "d") != "x" || e.AttrOr("missing", "d") != "d" {
+		t.Error("AttrOr")
+	}
+
+	for name, get := range map[string]func(string) error{
+		"AttrString": func(n string) error { _, err := e.AttrString(n); return err },
+		"AttrFloat":  func(n string) error { _, err := e.AttrFloat(n); return err },
+		"AttrInt":    func(n string) error { _, err := e.AttrInt(n); return err },
+		"AttrBool":   func(n string) error { _, err := e.AttrBool(n); return err },
+	} {
+		if get("missing") == nil {
+			t.Errorf("%s: no error for a missing attribute", name)
+		}
+		if name != "AttrString" && get("bad") == nil {
+			t.Errorf("%s: no error for an unparsable value", name)
+		}
+	}
+
+	err := e.ScaleAttrBy("f", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.AdjustAttrBy("i", -2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.AttrOr("f", "") != "3" || e.AttrOr("i", "") != "40" {
+		t.Errorf("got f=%s, i=%s", e.AttrOr("f", ""), e.AttrOr("i", ""))
+	}
+	if e.ScaleAttrBy("bad", 2) == nil || e.AdjustAttrBy("missing", 1) == nil {
+		t.Error("numeric updates of non-numeric attributes")
+	}
+}
+
+func TestFindByAttr(t *testing.T) {
+	tree := readTree(t, `<a><b id="1" kind="x" /><c id="2" kind="x" /><b id="3" kind="y"><c id="4" kind="x" /></b></a>`)
+	a := tree.Elements.Elements()[0]
+
+	if c := a.ChildWithAttr("kind", "x"); c == nil || c.AttrOr("id", "") != "1" {
+		t.Errorf("ChildWithAttr: got %v", c)
+	}
+	if c := a.ChildNamedWithAttr("c", "kind", "x"); c == nil || c.AttrOr("id", "") != "2" {
+		t.Errorf("ChildNamedWithAttr: got %v", c)
+	}
+	if c := a.ChildWithAttr("kind", "z"); c != nil {
+		t.Errorf("ChildWithAttr: got %v", c)
+	}
+	if !a.Elements()[0].MatchesAllAttrs(SearchProperty{"id", "1"}, SearchProperty{"kind", "x"}) ||
+		a.Elements()[0].MatchesAllAttrs(SearchProperty{"id", "1"}, SearchProperty{"kind", "y"}) {
+		t.Error("MatchesAllAttrs")
+	}
+
+	parent, e := tree.FindByAttr("id", "4")
+	if e == nil || parent != a.Elements()[2] {
+		t.Errorf("FindByAttr: got %v in %v", e, parent)
+	}
+
+	var ids []string
+	for _, e := range tree.FindAllByAttr("kind", "x") {
+		ids = append(ids, e.AttrOr("id", ""))
+	}
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "2" || ids[2] != "4" {
+		t.Errorf("FindAllByAttr: got %v", ids)
+	}
+}
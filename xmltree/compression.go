@@ -0,0 +1,148 @@
+package xmltree
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// transparent compression for our streams and files
+// on read we detect compression from the stream's magic bytes, on write we choose it from the filename's extension
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// returns the compression implied by the filename's extension (e.g. data.xml.gz is gzip)
+func CompressionForFilename(filename string) Compression {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// returns the compression indicated by the magic bytes at the start of a stream
+func DetectCompression(header []byte) Compression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// returns a reader which decompresses the given stream as needed (plain streams are passed through)
+// warn: you must close the returned reader (this does not close the underlying stream)
+func NewDecompressingReader(stream io.Reader) (reader io.ReadCloser, compression Compression, err error) {
+
+	// peek at the magic bytes (a short stream simply isn't compressed)
+	buffered := bufio.NewReader(stream)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return
+	}
+	err = nil
+
+	compression = DetectCompression(header)
+	switch compression {
+	case CompressionGzip:
+		reader, err = gzip.NewReader(buffered)
+	case CompressionZstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(buffered)
+		if err != nil {
+			return
+		}
+		reader = decoder.IOReadCloser()
+	default:
+		reader = io.NopCloser(buffered)
+	}
+
+	return
+}
+
+// returns a writer which compresses onto the given stream
+// warn: you must close the returned writer to complete the compressed stream (this does not close the underlying stream)
+func NewCompressingWriter(stream io.Writer, compression Compression) (writer io.WriteCloser, err error) {
+	switch compression {
+	case CompressionNone:
+		writer = nopWriteCloser{stream}
+	case CompressionGzip:
+		writer = gzip.NewWriter(stream)
+	case CompressionZstd:
+		writer, err = zstd.NewWriter(stream)
+	default:
+		err = fmt.Errorf("unsupported compression: %v", compression)
+	}
+	return
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// reads the stream, decompressing it if needed
+func (tree *XMLTree) ReadCompressed(stream io.Reader) (err error) {
+
+	reader, _, err := NewDecompressingReader(stream)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	err = tree.Read(reader)
+	return
+}
+
+// encode ourself into stream using default encoding settings (no formatting), compressed as requested
+func (tree *XMLTree) WriteCompressed(stream io.Writer, compression Compression) (err error) {
+
+	writer, err := NewCompressingWriter(stream, compression)
+	if err != nil {
+		return
+	}
+
+	err = tree.Write(writer)
+	if err != nil {
+		writer.Close()
+		return
+	}
+
+	err = writer.Close()
+	return
+}
@@ -0,0 +1,99 @@
+package xmltree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressionForFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     Compression
+	}{
+		{"data.xml", CompressionNone},
+		{"data.xml.gz", CompressionGzip},
+		{"DATA.XML.GZ", CompressionGzip},
+		{"data.xml.gzip", CompressionGzip},
+		{"data.xml.zst", CompressionZstd},
+		{"data.xml.zstd", CompressionZstd},
+		{"data.gz.xml", CompressionNone},
+	}
+	for _, test := range tests {
+		if got := CompressionForFilename(test.filename); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.filename, got, test.want)
+		}
+	}
+}
+
+func TestCompressedStreamRoundTrip(t *testing.T) {
+	tree := readTree(t, `<a x="1"><b>text &amp; more</b></a>`)
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		buffer := &bytes.Buffer{}
+		err := tree.WriteCompressed(buffer, compression)
+		if err != nil {
+			t.Fatalf("%v: %v", compression, err)
+		}
+		if got := DetectCompression(buffer.Bytes()); got != compression {
+			t.Errorf("%v: written as %v", compression, got)
+		}
+
+		read := &XMLTree{}
+		err = read.ReadCompressed(buffer)
+		if err != nil {
+			t.Fatalf("%v: %v", compression, err)
+		}
+		if read.String() != tree.String() {
+			t.Errorf("%v: got %q, want %q", compression, read.String(), tree.String())
+		}
+	}
+}
+
+func TestReadCompressedShortStream(t *testing.T) {
+	// shorter than any magic number, so it can only be plain
+	tree := &XMLTree{}
+	err := tree.ReadCompressed(bytes.NewReader([]byte("<a/>")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.String(); got != "<a />" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCompressedFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tree := readTree(t, `<a><b>1</b></a>`)
+	for _, name := range []string{"plain.xml", "data.xml.gz", "data.xml.zst"} {
+		filename := filepath.Join(dir, name)
+		err := tree.WriteToFile(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := DetectCompression(contents), CompressionForFilename(filename); got != want {
+			t.Errorf("%s: written as %v, want %v", name, got, want)
+		}
+
+		// compression is detected from the contents, not the name
+		renamed := filepath.Join(dir, "renamed-"+name+".xml")
+		err = os.Rename(filename, renamed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, load := range []func(string) (*XMLTree, error){LoadFromFile, LoadFromFileIgnoreVersion} {
+			read, err := load(renamed)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if read.String() != tree.String() {
+				t.Errorf("%s: got %q, want %q", name, read.String(), tree.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package xmltree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// css selector style queries
+//  Tag  *  [attr]  [attr=value]  [attr^=prefix]  [attr$=suffix]  [attr*=text]  [attr~=word]
+//  A B (descendant)  A > B (child)  A + B (next sibling)  A ~ B (following sibling)  A, B (either)
+//  :first-child  :last-child  :only-child  :nth-child(an+b | odd | even)  :not(compound)
+//  :has(Tag)  :has(Tag=Value) - custom: we have a child Tag (whose text value is Value)
+// results are found breadth first (the same traversal as FindUsing)
+
+type Selector struct {
+	source       string
+	alternatives []*cssComplex
+}
+
+// compound selectors joined by combinators (stored right to left, as that's how we match)
+type cssComplex struct {
+	compounds   []*cssCompound
+	combinators []byte // combinators[i] joins compounds[i] to compounds[i+1] (' ', '>', '+', '~')
+}
+
+type cssCompound struct {
+	tag     string // empty or * for any
+	filters []cssFilter
+}
+
+type cssFilter func(v *elementVisit) bool
+
+type CSSSyntaxError struct {
+	Selector string
+	Offset   int
+	Msg      string
+}
+
+func (e *CSSSyntaxError) Error() string {
+	return fmt.Sprintf("css selector syntax error at offset %d in %q: %s", e.Offset, e.Selector, e.Msg)
+}
+
+func CompileSelector(source string) (s *Selector, err error) {
+	p := &cssParser{source: source}
+	s = &Selector{source: source}
+	for {
+		var complex *cssComplex
+		complex, err = p.parseComplex()
+		if err != nil {
+			s = nil
+			return
+		}
+		s.alternatives = append(s.alternatives, complex)
+
+		p.skipSpace()
+		if p.done() {
+			return
+		}
+		if !p.accept(',') {
+			err = p.fail("unexpected %q", p.source[p.offset:p.offset+1])
+			s = nil
+			return
+		}
+	}
+}
+
+// like CompileSelector, but panics if the selector is invalid (handy for package level vars)
+func MustCompileSelector(source string) *Selector {
+	s, err := CompileSelector(source)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *Selector) String() string {
+	return s.source
+}
+
+// true if the visited element matches any of our alternatives
+func (s *Selector) matches(v *elementVisit) bool {
+	for _, complex := range s.alternatives {
+		if complex.matches(0, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches compounds[i:] against v and its ancestors / siblings
+func (c *cssComplex) matches(i int, v *elementVisit) bool {
+
+	if !c.compounds[i].matches(v) {
+		return false
+	}
+	if i == len(c.compounds)-1 {
+		return true
+	}
+
+	switch c.combinators[i] {
+	case '>':
+		return v.parent != nil && c.matches(i+1, v.parent)
+	case ' ':
+		for p := v.parent; p != nil; p = p.parent {
+			if c.matches(i+1, p) {
+				return true
+			}
+		}
+	case '+':
+		return v.index > 0 && c.matches(i+1, v.sibling(v.index-1))
+	case '~':
+		for j := v.index - 1; j >= 0; j-- {
+			if c.matches(i+1, v.sibling(j)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns a visit for our sibling at index (sharing our parent)
+func (v *elementVisit) sibling(index int) *elementVisit {
+	return &elementVisit{element: v.siblings[index], parent: v.parent, siblings: v.siblings, index: index}
+}
+
+func (c *cssCompound) matches(v *elementVisit) bool {
+	if c.tag != "" && c.tag != "*" && v.element.Name.Local != c.tag {
+		return false
+	}
+	for _, f := range c.filters {
+		if !f(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the first element matching the selector (breadth first, like FindUsing)
+func (s *Selector) First(tree *XMLTree) (element *XMLElement) {
+	traverseBFS(tree.Elements.Elements(), nil, func(v *elementVisit) bool {
+		if s.matches(v) {
+			element = v.element
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// returns all elements matching the selector (breadth first, like FindUsing)
+func (s *Selector) All(tree *XMLTree) (elements []*XMLElement) {
+	traverseBFS(tree.Elements.Elements(), nil, func(v *elementVisit) bool {
+		if s.matches(v) {
+			elements = append(elements, v.element)
+		}
+		return true
+	})
+	return
+}
+
+// returns the first descendant of e matching the selector (e itself is never a match, but it is an ancestor for combinators)
+func (s *Selector) FirstIn(e *XMLElement) (element *XMLElement) {
+	traverseBFS(e.Elements(), &elementVisit{element: e, index: -1}, func(v *elementVisit) bool {
+		if s.matches(v) {
+			element = v.element
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// returns all descendants of e matching the selector (e itself is never a match, but it is an ancestor for combinators)
+func (s *Selector) AllIn(e *XMLElement) (elements []*XMLElement) {
+	traverseBFS(e.Elements(), &elementVisit{element: e, index: -1}, func(v *elementVisit) bool {
+		if s.matches(v) {
+			elements = append(elements, v.element)
+		}
+		return true
+	})
+	return
+}
+
+// returns the first element matching the css selector (nil if none do)
+func (tree *XMLTree) Select(selector string) (element *XMLElement, err error) {
+	s, err := CompileSelector(selector)
+	if err != nil {
+		return
+	}
+	element = s.First(tree)
+	return
+}
+
+// returns every element matching the css selector
+func (tree *XMLTree) SelectAll(selector string) (elements []*XMLElement, err error) {
+	s, err := CompileSelector(selector)
+	if err != nil {
+		return
+	}
+	elements = s.All(tree)
+	return
+}
+
+// returns the first of our descendants matching the css selector (nil if none do)
+func (e *XMLElement) Select(selector string) (element *XMLElement, err error) {
+	s, err := CompileSelector(selector)
+	if err != nil {
+		return
+	}
+	element = s.FirstIn(e)
+	return
+}
+
+// returns every one of our descendants matching the css selector
+func (e *XMLElement) SelectAll(selector string) (elements []*XMLElement, err error) {
+	s, err := CompileSelector(selector)
+	if err != nil {
+		return
+	}
+	elements = s.AllIn(e)
+	return
+}
+
+////////////////////////////////////////////////////
+// parser
+
+type cssParser struct {
+	source string
+	offset int
+}
+
+func (p *cssParser) fail(msg string, args ...any) error {
+	return &CSSSyntaxError{Selector: p.source, Offset: p.offset, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func (p *cssParser) done() bool {
+	return p.offset >= len(p.source)
+}
+
+func (p *cssParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.source[p.offset]
+}
+
+func (p *cssParser) accept(c byte) bool {
+	if p.peek() == c {
+		p.offset++
+		return true
+	}
+	return false
+}
+
+func (p *cssParser) skipSpace() (skipped bool) {
+	for !p.done() && strings.IndexByte(" \t\r\n", p.peek()) != -1 {
+		p.offset++
+		skipped = true
+	}
+	return
+}
+
+// reads a name (tag, attribute, pseudo-class)
+func (p *cssParser) readName() string {
+	start := p.offset
+	for !p.done() {
+		c := p.peek()
+		if c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			p.offset++
+			continue
+		}
+		break
+	}
+	return p.source[start:p.offset]
+}
+
+// reads a quoted string or a bare value (up to the given terminators)
+func (p *cssParser) readValue(terminators string) (value string, err error) {
+	if q := p.peek(); q == '"' || q == '\'' {
+		end := strings.IndexByte(p.source[p.offset+1:], q)
+		if end == -1 {
+			err = p.fail("unterminated string")
+			return
+		}
+		value = p.source[p.offset+1 : p.offset+1+end]
+		p.offset += end + 2
+		return
+	}
+	start := p.offset
+	for !p.done() && strings.IndexByte(terminators, p.peek()) == -1 {
+		p.offset++
+	}
+	value = strings.TrimSpace(p.source[start:p.offset])
+	return
+}
+
+func (p *cssParser) parseComplex() (complex *cssComplex, err error) {
+
+	p.skipSpace()
+
+	// parsed left to right, stored right to left
+	var compounds []*cssCompound
+	var combinators []byte
+	for {
+		var compound *cssCompound
+		compound, err = p.parseCompound()
+		if err != nil {
+			return
+		}
+		compounds = append(compounds, compound)
+
+		// combinator (or the end of this complex selector)
+		spaced := p.skipSpace()
+		switch next := p.peek(); {
+		case next == '>' || next == '+' || next == '~':
+			p.offset++
+			p.skipSpace()
+			combinators = append(combinators, next)
+		case next == 0 || next == ',':
+			complex = &cssComplex{}
+			for i := len(compounds) - 1; i >= 0; i-- {
+				complex.compounds = append(complex.compounds, compounds[i])
+			}
+			for i := len(combinators) - 1; i >= 0; i-- {
+				complex.combinators = append(complex.combinators, combinators[i])
+			}
+			return
+		case spaced:
+			combinators = append(combinators, ' ')
+		default:
+			err = p.fail("unexpected %q", next)
+			return
+		}
+	}
+}
+
+func (p *cssParser) parseCompound() (c *cssCompound, err error) {
+
+	c = &cssCompound{}
+	if p.accept('*') {
+		c.tag = "*"
+	} else {
+		c.tag = p.readName()
+	}
+
+	for {
+		switch p.peek() {
+		case '[':
+			var f cssFilter
+			f, err = p.parseAttribute()
+			if err != nil {
+				return
+			}
+			c.filters = append(c.filters, f)
+		case ':':
+			var f cssFilter
+			f, err = p.parsePseudo()
+			if err != nil {
+				return
+			}
+			c.filters = append(c.filters, f)
+		default:
+			if c.tag == "" && len(c.filters) == 0 {
+				err = p.fail("expected a selector")
+			}
+			return
+		}
+	}
+}
+
+func (p *cssParser) parseAttribute() (f cssFilter, err error) {
+
+	p.accept('[')
+	p.skipSpace()
+	name := p.readName()
+	if name == "" {
+		err = p.fail("expected an attribute name")
+		return
+	}
+	p.skipSpace()
+
+	// presence only
+	if p.accept(']') {
+		f = func(v *elementVisit) bool {
+			_, ok := v.element.Attribute(name)
+			return ok
+		}
+		return
+	}
+
+	// operator
+	op := ""
+	for _, candidate := range []string{"=", "^=", "$=", "*=", "~=", "|="} {
+		if strings.HasPrefix(p.source[p.offset:], candidate) {
+			op = candidate
+		}
+	}
+	if op == "" {
+		err = p.fail("expected an attribute operator")
+		return
+	}
+	p.offset += len(op)
+	p.skipSpace()
+
+	value, err := p.readValue("]")
+	if err != nil {
+		return
+	}
+	p.skipSpace()
+	if !p.accept(']') {
+		err = p.fail("expected ]")
+		return
+	}
+
+	test := cssAttributeTests[op]
+	f = func(v *elementVisit) bool {
+		actual, ok := v.element.Attribute(name)
+		return ok && test(actual, value)
+	}
+	return
+}
+
+var cssAttributeTests = map[string]func(actual, value string) bool{
+	"=":  func(actual, value string) bool { return actual == value },
+	"^=": func(actual, value string) bool { return value != "" && strings.HasPrefix(actual, value) },
+	"$=": func(actual, value string) bool { return value != "" && strings.HasSuffix(actual, value) },
+	"*=": func(actual, value string) bool { return value != "" && strings.Contains(actual, value) },
+	"~=": func(actual, value string) bool {
+		for _, word := range strings.Fields(actual) {
+			if word == value {
+				return true
+			}
+		}
+		return false
+	},
+	"|=": func(actual, value string) bool { return actual == value || strings.HasPrefix(actual, value+"-") },
+}
+
+func (p *cssParser) parsePseudo() (f cssFilter, err error) {
+
+	p.accept(':')
+	name := p.readName()
+
+	switch name {
+	case "first-child":
+		f = func(v *elementVisit) bool { return v.index == 0 }
+	case "last-child":
+		f = func(v *elementVisit) bool { return v.index >= 0 && v.index == len(v.siblings)-1 }
+	case "only-child":
+		f = func(v *elementVisit) bool { return v.index == 0 && len(v.siblings) == 1 }
+	case "nth-child", "nth-last-child":
+		var a, b int
+		a, b, err = p.parseNth()
+		if err != nil {
+			return
+		}
+		last := name == "nth-last-child"
+		f = func(v *elementVisit) bool {
+			if v.index < 0 {
+				return false
+			}
+			n := v.index + 1
+			if last {
+				n = len(v.siblings) - v.index
+			}
+			return cssNthMatches(a, b, n)
+		}
+	case "not":
+		if !p.accept('(') {
+			err = p.fail("expected (")
+			return
+		}
+		p.skipSpace()
+		var inner *cssCompound
+		inner, err = p.parseCompound()
+		if err != nil {
+			return
+		}
+		p.skipSpace()
+		if !p.accept(')') {
+			err = p.fail("expected )")
+			return
+		}
+		f = func(v *elementVisit) bool { return !inner.matches(v) }
+	case "has":
+		if !p.accept('(') {
+			err = p.fail("expected (")
+			return
+		}
+		p.skipSpace()
+		tag := p.readName()
+		if tag == "" {
+			err = p.fail("expected a child tag")
+			return
+		}
+		p.skipSpace()
+		if p.accept('=') {
+			p.skipSpace()
+			var value string
+			value, err = p.readValue(")")
+			if err != nil {
+				return
+			}
+			f = func(v *elementVisit) bool { return v.element.hasSimpleChild(tag, value) }
+		} else {
+			f = func(v *elementVisit) bool { return v.element.Child(tag) != nil }
+		}
+		p.skipSpace()
+		if !p.accept(')') {
+			err = p.fail("expected )")
+			return
+		}
+	default:
+		err = p.fail("unknown pseudo-class :%s", name)
+	}
+	return
+}
+
+// parses (an+b), (odd), (even) or (b)
+func (p *cssParser) parseNth() (a, b int, err error) {
+
+	if !p.accept('(') {
+		err = p.fail("expected (")
+		return
+	}
+	p.skipSpace()
+	expr, err := p.readValue(")")
+	if err != nil {
+		return
+	}
+	if !p.accept(')') {
+		err = p.fail("expected )")
+		return
+	}
+
+	expr = strings.ReplaceAll(strings.ToLower(expr), " ", "")
+	switch expr {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	an, bs, hasN := strings.Cut(expr, "n")
+	if !hasN {
+		b, err = strconv.Atoi(expr)
+		if err != nil {
+			err = p.fail("invalid nth expression %q", expr)
+		}
+		return
+	}
+
+	switch an {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		a, err = strconv.Atoi(an)
+		if err != nil {
+			err = p.fail("invalid nth expression %q", expr)
+			return
+		}
+	}
+	if bs != "" {
+		b, err = strconv.Atoi(strings.TrimPrefix(bs, "+"))
+		if err != nil {
+			err = p.fail("invalid nth expression %q", expr)
+		}
+	}
+	return
+}
+
+// true if n == a*k + b for some k >= 0
+func cssNthMatches(a, b, n int) bool {
+	if a == 0 {
+		return n == b
+	}
+	k := n - b
+	return k%a == 0 && k/a >= 0
+}
@@ -0,0 +1,84 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// debug dump of a tree (used by %#v)
+// each node is written on its own line as: type, name, position, attributes, value
+
+func dumpIndent(w io.Writer, depth int) {
+	io.WriteString(w, strings.Repeat("  ", depth))
+}
+
+func dumpValue(w io.Writer, label string, v *XMLValue, depth int) {
+	dumpIndent(w, depth)
+	io.WriteString(w, label)
+	dumpContents(w, v, depth)
+}
+
+// writes the remainder of the current line (our simple value, if any), then our children one per line
+func dumpContents(w io.Writer, v *XMLValue, depth int) {
+
+	switch t := v.contents.(type) {
+	case nil:
+		io.WriteString(w, " (empty)\n")
+	case string:
+		fmt.Fprintf(w, " %q\n", t)
+	case []any:
+		io.WriteString(w, "\n")
+		for _, c := range t {
+			dumpChild(w, c, depth+1)
+		}
+	default:
+		io.WriteString(w, "\n")
+		dumpChild(w, t, depth+1)
+	}
+}
+
+func dumpChild(w io.Writer, c any, depth int) {
+	switch t := c.(type) {
+	case *XMLElement:
+		dumpElement(w, t, depth)
+	case *XMLComment:
+		dumpIndent(w, depth)
+		fmt.Fprintf(w, "XMLComment %q\n", string(t.Comment))
+	case *XMLDirective:
+		dumpIndent(w, depth)
+		fmt.Fprintf(w, "XMLDirective %q\n", string(t.Directive))
+	case *XMLProcInst:
+		dumpIndent(w, depth)
+		fmt.Fprintf(w, "XMLProcInst %s %q\n", t.Target, string(t.Inst))
+	default:
+		dumpIndent(w, depth)
+		fmt.Fprintf(w, "%T (unknown)\n", c)
+	}
+}
+
+func dumpElement(w io.Writer, e *XMLElement, depth int) {
+	dumpIndent(w, depth)
+	fmt.Fprintf(w, "XMLElement <%s> @%s", dumpName(e.Name), e.pos)
+	for _, a := range e.Attr {
+		fmt.Fprintf(w, " %s=%q", dumpName(a.Name), a.Value)
+	}
+	dumpContents(w, &e.XMLValue, depth)
+}
+
+// decoded names carry their namespace's url rather than its prefix, so we write those as {url}local
+// (but xmlns declarations keep their prefix, since that's what the decoder gives us for them)
+func dumpName(name xml.Name) string {
+	if name.Space == "" || name.Space == "xmlns" {
+		return qualifiedName(name.Space, name.Local)
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+func qualifiedName(space, local string) string {
+	if space == "" {
+		return local
+	}
+	return space + ":" + local
+}
@@ -21,13 +21,19 @@ func SyntaxError(tokenizer Tokenizer, expected, found any) error {
 	return &xml.SyntaxError{Msg: fmt.Sprintf("expected: %v, found: %v", expected, found), Line: line}
 }
 
+// returns where the tokenizer currently is in the input
+func tokenPosition(tokenizer Tokenizer) Position {
+	line, column := tokenizer.InputPos()
+	return Position{Line: line, Column: column}
+}
+
 // reads from a file but ignores the version 1.1 (which is not supported)
 // NOTE: golang default xml parser does not support version 1.1, so we simply replace with 1.0
 // warn: this will work for xml files that do not actually use any 1.1 features, otherwise we'll fail to decode it properly
 func LoadFromFileIgnoreVersion(filename string) (tree *XMLTree, err error) {
 
 	// read the entire file
-	contents, err := os.ReadFile(filename)
+	contents, err := readFile(filename)
 	if err != nil {
 		return
 	}
@@ -44,6 +50,7 @@ func LoadFromFileIgnoreVersion(filename string) (tree *XMLTree, err error) {
 }
 
 // returns an XMLTree by reading in the given file
+// note: compressed files (e.g. .xml.gz or .xml.zst) are decompressed transparently
 func LoadFromFile(filename string) (tree *XMLTree, err error) {
 
 	// first we need a stream
@@ -55,7 +62,26 @@ func LoadFromFile(filename string) (tree *XMLTree, err error) {
 
 	// then we need to tokenize the stream
 	tree = new(XMLTree)
-	err = tree.Read(stream)
+	err = tree.ReadCompressed(stream)
+	return
+}
+
+// returns the entire (decompressed) contents of the given file
+func readFile(filename string) (contents []byte, err error) {
+
+	stream, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	reader, _, err := NewDecompressingReader(stream)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	contents, err = io.ReadAll(reader)
 	return
 }
 
@@ -87,7 +113,9 @@ func (value *XMLValue) DecodeRoot(tokenizer Tokenizer) (err error) {
 
 	for {
 
+		// subtle: the position before we read a token is where that token starts
 		var token xml.Token
+		pos := tokenPosition(tokenizer)
 		token, err = tokenizer.Token()
 		if err != nil {
 			return
@@ -112,7 +140,7 @@ func (value *XMLValue) DecodeRoot(tokenizer Tokenizer) (err error) {
 				err = SyntaxError(tokenizer, "only one root element", v)
 				return
 			}
-			root = &XMLElement{StartElement: v.Copy()}
+			root = newElement(v.Copy(), pos)
 			err = root.Decode(tokenizer)
 			if err != nil {
 				return
@@ -130,6 +158,8 @@ func (value *XMLValue) DecodeRoot(tokenizer Tokenizer) (err error) {
 
 func (value *XMLValue) append(item any) {
 
+	value.adopt(item)
+
 	// no value, then just store this one item
 	if value.contents == nil {
 		value.contents = item
@@ -152,7 +182,9 @@ func (e *XMLElement) Decode(tokenizer Tokenizer) (err error) {
 
 	for {
 
+		// subtle: the position before we read a token is where that token starts
 		var token xml.Token
+		pos := tokenPosition(tokenizer)
 		token, err = tokenizer.Token()
 		if err != nil {
 			return
@@ -169,7 +201,7 @@ func (e *XMLElement) Decode(tokenizer Tokenizer) (err error) {
 		case xml.ProcInst:
 			e.append(&XMLProcInst{v.Copy()})
 		case xml.StartElement:
-			child := &XMLElement{StartElement: v.Copy()}
+			child := newElement(v.Copy(), pos)
 			err = child.Decode(tokenizer)
 			if err != nil {
 				return
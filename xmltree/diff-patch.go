@@ -0,0 +1,351 @@
+package xmltree
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rendering a diff as an xml patch (rfc 5261, see patch.go)
+// we patch a clone of a as we go, so every selector is written against the tree as it will be when that operation runs
+// (which also proves that each operation applies)
+
+type diffPatcher struct {
+	d      *TreeDiff
+	tree   *XMLTree            // a clone of a, patched as we go
+	clones map[any]any         // a's elements and comments to their counterpart in tree
+	doc    *XMLElement         // the <diff> we're writing
+	roots  map[*XMLElement]any // b's new roots to what replaced a's old ones in tree
+}
+
+// an xml patch document which turns a into b
+// warn: the patch reproduces what the diff saw, so anything the options ignored (whitespace, comments, tolerance) isn't patched
+func (d *TreeDiff) Patch() (patch *XMLTree, err error) {
+	p := &diffPatcher{d: d, tree: &XMLTree{Elements: d.a.Elements.Clone()}, clones: map[any]any{}, doc: MakeElement("diff").makeEditable(), roots: map[*XMLElement]any{}}
+	p.tree.RelinkParents()
+	p.mapClones(&d.a.Elements, &p.tree.Elements)
+
+	// a root can't be removed (the document would be left without one), so a's old roots are replaced by b's new ones
+	var roots []*XMLElement
+	for _, c := range d.Changes {
+		if c.Kind == DiffInserted && c.B != nil && c.B.parent == nil {
+			roots = append(roots, c.B)
+		}
+	}
+
+	// deletes (elements first, since they may take deleted comments with them)
+	for _, c := range d.Changes {
+		if c.Kind != DiffDeleted || c.A == nil {
+			continue
+		}
+		if c.A.parent == nil && len(roots) != 0 {
+			err = p.replaceRoot(p.clones[c.A].(*XMLElement), roots[0])
+			roots = roots[1:]
+		} else {
+			err = p.remove(p.clones[c.A])
+		}
+		if err != nil {
+			return
+		}
+	}
+	for _, c := range d.deleted {
+		err = p.remove(p.clones[c])
+		if err != nil {
+			return
+		}
+	}
+
+	// modifications
+	for _, c := range d.Changes {
+		err = p.modify(c)
+		if err != nil {
+			return
+		}
+	}
+
+	// moves and inserts
+	err = p.arrange(&d.b.Elements, &p.tree.Elements)
+	if err != nil {
+		return
+	}
+
+	patch = &XMLTree{}
+	patch.Elements.SetContents(p.doc)
+	return
+}
+
+// walks a value and its clone together, mapping each item in one to its counterpart in the other
+func (p *diffPatcher) mapClones(a, clone *XMLValue) {
+	aItems, _ := a.items()
+	cItems, _ := clone.items()
+	for i, item := range aItems {
+		p.clones[item] = cItems[i]
+		if e, ok := item.(*XMLElement); ok {
+			p.mapClones(&e.XMLValue, &cItems[i].(*XMLElement).XMLValue)
+		}
+	}
+}
+
+// the xpath which selects item (an element, comment or processing instruction) in our tree
+func (p *diffPatcher) xpath(item any) string {
+	if e, ok := item.(*XMLElement); ok {
+		path := e.Path()
+		root := e.Root()
+		tops := p.tree.Elements.Elements()
+		if i := slices.Index(tops, root); i != -1 {
+			// subtle: Path doesn't know that the tree may have several roots with the same tag
+			path = pathSteps(tops)[i] + path[len(root.Name.Local):]
+		}
+		return "/" + path
+	}
+
+	value := p.valueOf(item)
+	parent := ""
+	if value.owner != nil {
+		parent = p.xpath(value.owner)
+	}
+	kind, same := "comment()", func(it any) bool { _, ok := it.(*XMLComment); return ok }
+	if _, ok := item.(*XMLProcInst); ok {
+		kind, same = "processing-instruction()", func(it any) bool { _, ok := it.(*XMLProcInst); return ok }
+	}
+	n := 0
+	items, _ := value.items()
+	for _, it := range items {
+		if same(it) {
+			n++
+		}
+		if it == item {
+			break
+		}
+	}
+	return parent + "/" + kind + "[" + strconv.Itoa(n) + "]"
+}
+
+// the value which holds item (which must be in our tree)
+func (p *diffPatcher) valueOf(item any) (value *XMLValue) {
+	if e, ok := item.(*XMLElement); ok && e.parent != nil {
+		return &e.parent.XMLValue
+	}
+	value = &p.tree.Elements
+	eachDFS(nil, &p.tree.Elements, func(_, e *XMLElement) bool {
+		if e.itemIndex(item) != -1 {
+			value = &e.XMLValue
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// writes an operation to the patch, and applies it to our tree
+func (p *diffPatcher) op(name, sel string, attrs map[string]string, contents any) (err error) {
+	e := MakeElement(name)
+	e.SetAttribute("sel", sel)
+	for _, k := range []string{"pos", "type"} {
+		if v, ok := attrs[k]; ok {
+			e.SetAttribute(k, v)
+		}
+	}
+	if contents != nil {
+		e.SetContents(contents)
+	}
+	p.doc.Append(e)
+
+	op := &patchOp{op: name, index: len(p.doc.Elements()), element: e, sel: sel}
+	err = op.parse()
+	if err == nil {
+		_, err = op.apply(p.tree)
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot express the diff as a patch: %w", op.fail(err))
+	}
+	return
+}
+
+func (p *diffPatcher) remove(item any) error {
+	return p.op("remove", p.xpath(item), nil, nil)
+}
+
+// replaces one of a's roots (in our tree) with a new one of b's
+func (p *diffPatcher) replaceRoot(old, root *XMLElement) (err error) {
+	index := p.tree.Elements.itemIndex(old)
+	err = p.op("replace", p.xpath(old), nil, root.Clone())
+	if err != nil {
+		return
+	}
+	items, _ := p.tree.Elements.items()
+	p.roots[root] = items[index]
+	return
+}
+
+// applies an attribute or value change to the counterpart of its element
+func (p *diffPatcher) modify(c DiffChange) (err error) {
+	if c.A == nil || c.B == nil || c.Kind == DiffMoved {
+		return
+	}
+	clone := p.clones[c.A].(*XMLElement)
+	sel := p.xpath(clone)
+	switch c.Kind {
+	case DiffAttrAdded:
+		return p.op("add", sel, map[string]string{"type": "@" + c.Attr}, c.After)
+	case DiffAttrRemoved:
+		return p.op("remove", sel+"/@"+c.Attr, nil, nil)
+	case DiffAttrChanged:
+		return p.op("replace", sel+"/@"+c.Attr, nil, c.After)
+	}
+
+	// text, which we can edit as text if there's text on both sides
+	before, wasText := diffText(clone)
+	after, isText := diffText(c.B)
+	switch {
+	case !wasText || !isText:
+	case before != "" && after != "":
+		return p.op("replace", sel+"/text()", nil, after)
+	case before != "" && after == "":
+		return p.op("remove", sel+"/text()", nil, nil)
+	case before == "" && strings.TrimSpace(after) != "":
+		return p.op("add", sel, nil, after)
+	}
+
+	// otherwise we replace the element wholesale (and its replacement becomes its counterpart)
+	value := p.valueOf(clone)
+	index := value.itemIndex(clone)
+	err = p.op("replace", sel, nil, c.B.Clone())
+	if err != nil {
+		return
+	}
+	items, _ := value.items()
+	p.clones[c.A] = items[index]
+	return
+}
+
+// puts the children of our counterpart of bv (cv) in b's order, inserting what's new, then does the same for each child
+func (p *diffPatcher) arrange(bv, cv *XMLValue) (err error) {
+	var anchor any // the item in cv after which the next of b's items goes (nil for first)
+	items, _ := bv.items()
+	for _, item := range items {
+		switch t := item.(type) {
+		case *XMLElement:
+			if replacement, ok := p.roots[t]; ok {
+				// already in place (and complete)
+				anchor = replacement
+				continue
+			}
+			a, matched := p.d.matches[t]
+			if !matched {
+				anchor, err = p.insert(cv, anchor, t.Clone())
+				if err != nil {
+					return
+				}
+				continue
+			}
+
+			clone := p.clones[a]
+			if p.d.moved[t] {
+				clone, err = p.move(cv, anchor, clone)
+				if err != nil {
+					return
+				}
+			}
+			anchor = clone
+
+			if !p.d.replaced[t] {
+				err = p.arrange(&t.XMLValue, &clone.(*XMLElement).XMLValue)
+				if err != nil {
+					return
+				}
+			}
+
+		case *XMLComment:
+			if p.d.inserted[t] {
+				anchor, err = p.insert(cv, anchor, &XMLComment{Comment: t.Copy()})
+				if err != nil {
+					return
+				}
+			} else if a, ok := p.d.comments[t]; ok {
+				clone := p.clones[a]
+				// comments aren't reported as moved, but they still have to end up between the right elements
+				if cv.itemIndex(clone) != cv.itemIndex(anchor)+1 {
+					clone, err = p.move(cv, anchor, clone)
+					if err != nil {
+						return
+					}
+				}
+				anchor = clone
+			}
+		}
+	}
+	return
+}
+
+// moves item (in our tree) to after anchor in cv, returning the copy of it which the patch inserted
+func (p *diffPatcher) move(cv *XMLValue, anchor, item any) (moved any, err error) {
+	err = p.remove(item)
+	if err != nil {
+		return
+	}
+	var copied any
+	switch t := item.(type) {
+	case *XMLElement:
+		copied = t.Clone()
+	case *XMLComment:
+		copied = &XMLComment{Comment: t.Copy()}
+	}
+	moved, err = p.insert(cv, anchor, copied)
+	if err == nil {
+		// subtle: the patch inserts a copy, so our counterparts are now in the copy
+		p.remapClones(item, moved)
+	}
+	return
+}
+
+// once an item has been replaced by its copy, points whatever was our counterpart in one at the other
+func (p *diffPatcher) remapClones(old, replacement any) {
+	counterparts := map[any]any{old: replacement}
+	var walk func(o, c *XMLValue)
+	walk = func(o, c *XMLValue) {
+		oItems, _ := o.items()
+		cItems, _ := c.items()
+		for i, item := range oItems {
+			counterparts[item] = cItems[i]
+			if e, ok := item.(*XMLElement); ok {
+				walk(&e.XMLValue, &cItems[i].(*XMLElement).XMLValue)
+			}
+		}
+	}
+	if e, ok := old.(*XMLElement); ok {
+		walk(&e.XMLValue, &replacement.(*XMLElement).XMLValue)
+	}
+	for a, c := range p.clones {
+		if n, ok := counterparts[c]; ok {
+			p.clones[a] = n
+		}
+	}
+}
+
+// adds item to cv after anchor (or first), returning what the patch inserted
+func (p *diffPatcher) insert(cv *XMLValue, anchor, item any) (inserted any, err error) {
+	index := 0
+	switch {
+	case anchor != nil:
+		err = p.op("add", p.xpath(anchor), map[string]string{"pos": "after"}, item)
+		index = cv.itemIndex(anchor) + 1
+	case cv.owner != nil:
+		err = p.op("add", p.xpath(cv.owner), map[string]string{"pos": "prepend"}, item)
+	default:
+		// the top level of the tree has no element to prepend to, so we go before whatever is first
+		items, _ := cv.items()
+		if len(items) == 0 {
+			err = fmt.Errorf("cannot express the diff as a patch: the patched document would have no root element to add to")
+			return
+		}
+		err = p.op("add", p.xpath(items[0]), map[string]string{"pos": "before"}, item)
+	}
+	if err != nil {
+		return
+	}
+	items, _ := cv.items()
+	inserted = items[index]
+	return
+}
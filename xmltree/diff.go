@@ -0,0 +1,374 @@
+package xmltree
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// structural diff: matches elements between two trees (by key, or by position among their same-tag siblings)
+// and reports what was inserted, deleted, moved or modified (attributes and values)
+// a diff renders as a report (String) or as an xml patch (rfc 5261) which turns the first tree into the second (Patch)
+
+type DiffOptions struct {
+	Keys             map[string]KeyFunc // how siblings with a given tag are matched (e.g. "Item": KeyByChild("Name")), "*" for any other tag; unkeyed tags (or elements without a key) match by position
+	IgnoreWhitespace bool               // compare text with leading, trailing and repeated whitespace ignored
+	IgnoreComments   bool
+	Tolerance        float64 // numbers (in values and attributes) which differ by no more than this are equal (so 1.0 and 1 are always equal)
+}
+
+type DiffKind int
+
+const (
+	DiffInserted     DiffKind = iota // an element (or comment) only in b
+	DiffDeleted                      // an element (or comment) only in a
+	DiffMoved                        // an element in both, but in a different order among its siblings
+	DiffValueChanged                 // an element whose text (or, if it changed between text and children, whose contents) differs
+	DiffAttrAdded
+	DiffAttrRemoved
+	DiffAttrChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffInserted:
+		return "inserted"
+	case DiffDeleted:
+		return "deleted"
+	case DiffMoved:
+		return "moved"
+	case DiffValueChanged:
+		return "value changed"
+	case DiffAttrAdded:
+		return "attribute added"
+	case DiffAttrRemoved:
+		return "attribute removed"
+	case DiffAttrChanged:
+		return "attribute changed"
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+type DiffChange struct {
+	Kind   DiffKind
+	Path   string      // the element's path (see At) in b for an insert, and in a otherwise (comments end in comment())
+	Attr   string      // the attribute (for attribute changes)
+	Before string      // the old value, attribute value, comment, or (for a move) path in a
+	After  string      // the new value, attribute value, comment, or (for a move) path in b
+	A, B   *XMLElement // the element in each tree (nil where it isn't, and for comments)
+}
+
+func (c DiffChange) String() string {
+	switch c.Kind {
+	case DiffInserted:
+		if c.B == nil {
+			return fmt.Sprintf("+ %s: %q", c.Path, c.After)
+		}
+		return "+ " + c.Path
+	case DiffDeleted:
+		if c.A == nil {
+			return fmt.Sprintf("- %s: %q", c.Path, c.Before)
+		}
+		return "- " + c.Path
+	case DiffMoved:
+		return fmt.Sprintf("~ %s: moved to %s", c.Path, c.After)
+	case DiffAttrAdded:
+		return fmt.Sprintf("* %s/@%s: added %q", c.Path, c.Attr, c.After)
+	case DiffAttrRemoved:
+		return fmt.Sprintf("* %s/@%s: removed %q", c.Path, c.Attr, c.Before)
+	case DiffAttrChanged:
+		return fmt.Sprintf("* %s/@%s: %q -> %q", c.Path, c.Attr, c.Before, c.After)
+	}
+	return fmt.Sprintf("* %s: %q -> %q", c.Path, c.Before, c.After)
+}
+
+type TreeDiff struct {
+	Changes []DiffChange // level by level: deletions, then (in b's order) inserts and each matched element's changes, then comments
+
+	a, b     *XMLTree
+	matches  map[*XMLElement]*XMLElement // b's elements to their match in a
+	moved    map[*XMLElement]bool        // b's elements which moved
+	replaced map[*XMLElement]bool        // b's elements whose contents changed between text and children
+	comments map[*XMLComment]*XMLComment // b's comments to their match in a
+	inserted map[*XMLComment]bool        // b's comments which a doesn't have
+	deleted  []*XMLComment               // a's comments which b doesn't have
+}
+
+// true if the trees are the same (as far as the options care)
+func (d *TreeDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// the changes of the given kind
+func (d *TreeDiff) Of(kind DiffKind) (changes []DiffChange) {
+	for _, c := range d.Changes {
+		if c.Kind == kind {
+			changes = append(changes, c)
+		}
+	}
+	return
+}
+
+// a report of the changes, one per line (+ inserted, - deleted, ~ moved, * modified)
+func (d *TreeDiff) String() string {
+	sb := &strings.Builder{}
+	for _, c := range d.Changes {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// compares a with b
+func Diff(a, b *XMLTree, opts DiffOptions) (d *TreeDiff) {
+	d = &TreeDiff{
+		a:        a,
+		b:        b,
+		matches:  map[*XMLElement]*XMLElement{},
+		moved:    map[*XMLElement]bool{},
+		replaced: map[*XMLElement]bool{},
+		comments: map[*XMLComment]*XMLComment{},
+		inserted: map[*XMLComment]bool{},
+	}
+	d.level(&opts, nil, nil, &a.Elements, &b.Elements)
+	return
+}
+
+// matches the children of av with those of bv (the values of a and b, which are nil at the top level)
+func (d *TreeDiff) level(opts *DiffOptions, a, b *XMLElement, av, bv *XMLValue) {
+	aKids, bKids := av.Elements(), bv.Elements()
+	aKeys, bKeys := opts.keys(aKids), opts.keys(bKids)
+
+	// pair up elements with the same key
+	byKey := map[string]int{}
+	for i, k := range aKeys {
+		byKey[k] = i
+	}
+	matched := make([]int, len(aKids)) // a's index to b's (or -1)
+	for i := range matched {
+		matched[i] = -1
+	}
+	for j, k := range bKeys {
+		if i, ok := byKey[k]; ok {
+			matched[i] = j
+			d.matches[bKids[j]] = aKids[i]
+		}
+	}
+
+	for i, e := range aKids {
+		if matched[i] == -1 {
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffDeleted, Path: e.Path(), A: e})
+		}
+	}
+
+	// whatever isn't in the longest run of matches that kept their order has moved
+	var order []int
+	for _, j := range matched {
+		if j != -1 {
+			order = append(order, j)
+		}
+	}
+	kept := map[int]bool{}
+	for _, j := range longestIncreasing(order) {
+		kept[j] = true
+	}
+
+	for j, e := range bKids {
+		match, ok := d.matches[e]
+		if !ok {
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffInserted, Path: e.Path(), B: e})
+			continue
+		}
+		if !kept[j] {
+			d.moved[e] = true
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffMoved, Path: match.Path(), Before: match.Path(), After: e.Path(), A: match, B: e})
+		}
+		d.compare(opts, match, e)
+	}
+
+	if !opts.IgnoreComments {
+		d.compareComments(a, b, av, bv)
+	}
+}
+
+// the matching key of each element: its tag, and its key (or position among its same-tag siblings), made unique
+func (o *DiffOptions) keys(elements []*XMLElement) (keys []string) {
+	positions := map[string]int{}
+	seen := map[string]int{}
+	for _, e := range elements {
+		tag := e.Name.Local
+		key, ok := "", false
+		if f := o.keyFunc(tag); f != nil {
+			key, ok = f(e)
+		}
+		if ok {
+			key = "=" + key
+		} else {
+			positions[tag]++
+			key = "#" + strconv.Itoa(positions[tag])
+		}
+		key = tag + "\x00" + key
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			// duplicate keys pair up in order
+			key += "\x00" + strconv.Itoa(n)
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+func (o *DiffOptions) keyFunc(tag string) KeyFunc {
+	if f, ok := o.Keys[tag]; ok {
+		return f
+	}
+	return o.Keys["*"]
+}
+
+// the values of a longest strictly increasing subsequence of s
+func longestIncreasing(s []int) (run []int) {
+	var tails []int // index into s of the smallest tail of a run of each length
+	prev := make([]int, len(s))
+	for i, v := range s {
+		n, _ := slices.BinarySearchFunc(tails, v, func(t, v int) int { return s[t] - v })
+		if n > 0 {
+			prev[i] = tails[n-1]
+		} else {
+			prev[i] = -1
+		}
+		if n == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[n] = i
+		}
+	}
+	if len(tails) == 0 {
+		return
+	}
+	for i := tails[len(tails)-1]; i != -1; i = prev[i] {
+		run = append(run, s[i])
+	}
+	slices.Reverse(run)
+	return
+}
+
+// compares the attributes and contents of a matched pair
+func (d *TreeDiff) compare(opts *DiffOptions, a, b *XMLElement) {
+	for _, attr := range a.Attr {
+		name := attr.Name.Local
+		switch value, ok := b.Attribute(name); {
+		case !ok:
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffAttrRemoved, Path: a.Path(), Attr: name, Before: attr.Value, A: a, B: b})
+		case !opts.equal(attr.Value, value):
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffAttrChanged, Path: a.Path(), Attr: name, Before: attr.Value, After: value, A: a, B: b})
+		}
+	}
+	for _, attr := range b.Attr {
+		if !a.HasAttribute(attr.Name.Local) {
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffAttrAdded, Path: a.Path(), Attr: attr.Name.Local, After: attr.Value, A: a, B: b})
+		}
+	}
+
+	at, aText := diffText(a)
+	bt, bText := diffText(b)
+	switch {
+	case aText && bText:
+		if !opts.equal(at, bt) {
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffValueChanged, Path: a.Path(), Before: at, After: bt, A: a, B: b})
+		}
+	case aText || bText:
+		// between text and children: the contents as a whole changed
+		if aText && strings.TrimSpace(at) == "" || bText && strings.TrimSpace(bt) == "" {
+			// nothing to something is just the children's inserts (or deletes)
+			d.level(opts, a, b, &a.XMLValue, &b.XMLValue)
+			return
+		}
+		d.replaced[b] = true
+		d.Changes = append(d.Changes, DiffChange{Kind: DiffValueChanged, Path: a.Path(), Before: diffContents(a), After: diffContents(b), A: a, B: b})
+	default:
+		d.level(opts, a, b, &a.XMLValue, &b.XMLValue)
+	}
+}
+
+// our text, if we hold text rather than children
+func diffText(e *XMLElement) (text string, ok bool) {
+	switch t := e.contents.(type) {
+	case nil:
+		return "", true
+	case string:
+		return t, true
+	}
+	return
+}
+
+// our contents as xml
+func diffContents(e *XMLElement) string {
+	s := encodeToString(&XMLValue{contents: e.contents}, false)
+	return strings.TrimSpace(s)
+}
+
+// true if the texts are the same (as far as the options care)
+func (o *DiffOptions) equal(x, y string) bool {
+	if o.IgnoreWhitespace {
+		x, y = strings.Join(strings.Fields(x), " "), strings.Join(strings.Fields(y), " ")
+	}
+	if x == y {
+		return true
+	}
+	fx, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+	if err != nil {
+		return false
+	}
+	fy, err := strconv.ParseFloat(strings.TrimSpace(y), 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(fx-fy) <= o.Tolerance
+}
+
+// comments are matched by their text (in order), and can only be inserted or deleted
+func (d *TreeDiff) compareComments(a, b *XMLElement, av, bv *XMLValue) {
+	path := func(e *XMLElement) string {
+		if e == nil {
+			return "comment()"
+		}
+		return e.Path() + "/comment()"
+	}
+
+	unmatched := map[string][]*XMLComment{}
+	for _, c := range diffComments(av) {
+		text := string(c.Comment)
+		unmatched[text] = append(unmatched[text], c)
+	}
+	for _, c := range diffComments(bv) {
+		text := string(c.Comment)
+		if q := unmatched[text]; len(q) != 0 {
+			d.comments[c], unmatched[text] = q[0], q[1:]
+			continue
+		}
+		d.Changes = append(d.Changes, DiffChange{Kind: DiffInserted, Path: path(b), After: text})
+		d.inserted[c] = true
+	}
+
+	// what's left in a was deleted (reported in a's order)
+	for _, c := range diffComments(av) {
+		text := string(c.Comment)
+		if q := unmatched[text]; len(q) != 0 && q[0] == c {
+			unmatched[text] = q[1:]
+			d.Changes = append(d.Changes, DiffChange{Kind: DiffDeleted, Path: path(a), Before: text})
+			d.deleted = append(d.deleted, c)
+		}
+	}
+}
+
+func diffComments(v *XMLValue) (comments []*XMLComment) {
+	items, _ := v.items()
+	for _, item := range items {
+		if c, ok := item.(*XMLComment); ok {
+			comments = append(comments, c)
+		}
+	}
+	return
+}
@@ -0,0 +1,174 @@
+package xmltree
+
+import (
+	"strings"
+	"testing"
+)
+
+var diffKeys = DiffOptions{Keys: map[string]KeyFunc{"Item": KeyByChild("Name")}}
+
+// the diff's report, without its trailing newline
+func diffReport(a, b *XMLTree, opts DiffOptions) string {
+	return strings.TrimSuffix(Diff(a, b, opts).String(), "\n")
+}
+
+func TestDiffSame(t *testing.T) {
+	a := readTree(t, `<Items><Item id="1"><Name>Sword</Name></Item><!--x--></Items>`)
+	b := readTree(t, `<Items><Item id="1"><Name>Sword</Name></Item><!--x--></Items>`)
+	if d := Diff(a, b, DiffOptions{}); !d.Empty() {
+		t.Errorf("got changes:\n%s", d)
+	}
+}
+
+func TestDiffChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		opts DiffOptions
+		want string
+	}{
+		{"value", `<a><x>1</x></a>`, `<a><x>2</x></a>`, DiffOptions{},
+			`* a/x: "1" -> "2"`},
+		{"insert and delete by position", `<a><x>1</x></a>`, `<a><x>1</x><x>2</x><y /></a>`, DiffOptions{},
+			"+ a/x[2]\n+ a/y"},
+		{"delete", `<a><x /><y /></a>`, `<a><y /></a>`, DiffOptions{},
+			"- a/x"},
+		{"attributes", `<a p="1" q="2" />`, `<a q="3" r="4" />`, DiffOptions{},
+			"* a/@p: removed \"1\"\n* a/@q: \"2\" -> \"3\"\n* a/@r: added \"4\""},
+		{"keyed", `<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>C</Name></Item><Item><Name>A</Name><Cost>2</Cost></Item></Items>`, diffKeys,
+			"- Items/Item[2]\n+ Items/Item[1]\n* Items/Item[1]/Cost: \"1\" -> \"2\""},
+		{"unkeyed by position", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>B</Name></Item><Item><Name>A</Name></Item></Items>`, DiffOptions{},
+			"* Items/Item[1]/Name: \"A\" -> \"B\"\n* Items/Item[2]/Name: \"B\" -> \"A\""},
+		{"text to children", `<a><x>1</x></a>`, `<a><x><y /></x></a>`, DiffOptions{},
+			`* a/x: "1" -> "<y />"`},
+		{"empty to children", `<a><x /></a>`, `<a><x><y /></x></a>`, DiffOptions{},
+			"+ a/x/y"},
+		{"comments", `<a><!--one--><!--two--></a>`, `<a><!--two--><!--three--></a>`, DiffOptions{},
+			"+ a/comment(): \"three\"\n- a/comment(): \"one\""},
+		{"ignored comments", `<a><!--one--></a>`, `<a><!--two--></a>`, DiffOptions{IgnoreComments: true},
+			""},
+	}
+	for _, tt := range tests {
+		if got := diffReport(readTree(t, tt.a), readTree(t, tt.b), tt.opts); got != tt.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffMoves(t *testing.T) {
+	a := readTree(t, `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item><Item><Name>C</Name></Item><Item><Name>D</Name></Item></Items>`)
+	b := readTree(t, `<Items><Item><Name>B</Name></Item><Item><Name>C</Name></Item><Item><Name>D</Name></Item><Item><Name>A</Name></Item></Items>`)
+	d := Diff(a, b, diffKeys)
+
+	// only A moved: B, C and D kept their order
+	moves := d.Of(DiffMoved)
+	if len(moves) != 1 || len(d.Changes) != 1 {
+		t.Fatalf("got\n%s", d)
+	}
+	m := moves[0]
+	if m.Before != "Items/Item[1]" || m.After != "Items/Item[4]" || m.A.Elements()[0].StringValue() != "A" || m.B.Elements()[0].StringValue() != "A" {
+		t.Errorf("got %+v", m)
+	}
+	if got, want := d.String(), "~ Items/Item[1]: moved to Items/Item[4]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiffTolerance(t *testing.T) {
+	a := readTree(t, `<a v="1.0"><x>10</x><y>  some   text </y></a>`)
+	b := readTree(t, `<a v="1.0004"><x>10.5</x><y>some text</y></a>`)
+	tests := []struct {
+		opts DiffOptions
+		want string
+	}{
+		{DiffOptions{}, "* a/@v: \"1.0\" -> \"1.0004\"\n* a/x: \"10\" -> \"10.5\"\n* a/y: \"  some   text \" -> \"some text\""},
+		{DiffOptions{Tolerance: 0.001}, "* a/x: \"10\" -> \"10.5\"\n* a/y: \"  some   text \" -> \"some text\""},
+		{DiffOptions{Tolerance: 0.5, IgnoreWhitespace: true}, ""},
+	}
+	for _, tt := range tests {
+		if got := diffReport(a, b, tt.opts); got != tt.want {
+			t.Errorf("%+v:\ngot\n%s\nwant\n%s", tt.opts, got, tt.want)
+		}
+	}
+
+	// numbers which are equal are always equal, whatever their text
+	if got := diffReport(readTree(t, `<a>1</a>`), readTree(t, `<a>1.00</a>`), DiffOptions{}); got != "" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// checks that the diff's patch turns a into b
+func checkDiffPatch(t *testing.T, name, a, b string, opts DiffOptions) {
+	t.Helper()
+	ta, tb := readTree(t, a), readTree(t, b)
+	document, err := Diff(ta, tb, opts).Patch()
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	patch, err := ParsePatch(document)
+	if err != nil {
+		t.Errorf("%s: %v\n%s", name, err, document)
+		return
+	}
+	_, err = patch.Apply(ta, PatchOptions{})
+	if err != nil {
+		t.Errorf("%s: %v\n%s", name, err, document)
+		return
+	}
+	if d := Diff(ta, tb, opts); !d.Empty() {
+		t.Errorf("%s: patched a still differs from b:\n%s\npatch:\n%s", name, d, document)
+	}
+}
+
+func TestDiffPatchRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		opts DiffOptions
+	}{
+		{"same", `<a><x>1</x></a>`, `<a><x>1</x></a>`, DiffOptions{}},
+		{"values and attributes", `<a p="1" q="2"><x>1</x><y /></a>`, `<a q="3" r="4"><x>2</x><y>now</y></a>`, DiffOptions{}},
+		{"remove text", `<a><x>1</x></a>`, `<a><x /></a>`, DiffOptions{}},
+		{"inserts and deletes", `<a><x /><y /><z /></a>`, `<a><w /><y /><z><q /></z><v /></a>`, DiffOptions{}},
+		{"text to children", `<a><x>1</x></a>`, `<a><x><y>2</y></x></a>`, DiffOptions{}},
+		{"children to text", `<a><x><y>2</y></x></a>`, `<a><x>1</x></a>`, DiffOptions{}},
+		{"moves", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item><Item><Name>C</Name></Item></Items>`,
+			`<Items><Item><Name>C</Name></Item><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name></Item></Items>`, diffKeys},
+		{"move with inserts", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>N</Name></Item><Item><Name>B</Name></Item><Item><Name>M</Name></Item><Item><Name>A</Name></Item></Items>`, diffKeys},
+		{"comments", `<a><!--one--><x /><!--two--></a>`, `<a><x /><!--two--><!--three--></a>`, DiffOptions{}},
+		{"moved comment", `<a><!--c--><x /><y /></a>`, `<a><x /><!--c--><y /></a>`, DiffOptions{}},
+		{"tolerance", `<a><x>1.0</x><y>2</y></a>`, `<a><x>1.001</x><y>3</y></a>`, DiffOptions{Tolerance: 0.01}},
+	}
+	for _, tt := range tests {
+		checkDiffPatch(t, tt.name, tt.a, tt.b, tt.opts)
+	}
+}
+
+func TestDiffPatchReplacesChangedRoot(t *testing.T) {
+	a, b := readTree(t, "<a><x>1</x></a>"), readTree(t, "<b><x>1</x></b>")
+
+	document, err := Diff(a, b, DiffOptions{}).Patch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := document.Elements.Elements()[0].Elements()
+	if sel, _ := ops[0].Attribute("sel"); len(ops) != 1 || ops[0].Name.Local != "replace" || sel != "/a" {
+		t.Errorf("got %s, want a single <replace sel=\"/a\">", document)
+	}
+
+	patch, err := ParsePatch(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = patch.Apply(a, PatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(a, b, DiffOptions{}); !d.Empty() {
+		t.Errorf("patched a still differs from b:\n%s", d)
+	}
+}
@@ -15,40 +15,69 @@ type SearchProperty struct {
 // create a new element from scratch (it has no initial value)
 // warn: you must set the value after creating it - it's invalid as-is
 func MakeElement(name string) (e *XMLElement) {
-	e = &XMLElement{
-		StartElement: xml.StartElement{Name: xml.Name{Local: name}},
-	}
+	e = newElement(xml.StartElement{Name: xml.Name{Local: name}}, Position{})
 	return
 }
 
 // create a new element from scratch with the given initial value
 // warn: value must be a valid value (see SetValue)
 func MakeElementWithValue(name string, value any) (e *XMLElement) {
-	e = &XMLElement{
-		StartElement: xml.StartElement{Name: xml.Name{Local: name}},
-	}
+	e = newElement(xml.StartElement{Name: xml.Name{Local: name}}, Position{})
 	e.SetValue(value)
 	return
 }
 
+// every element must own its value so that its children know their parent
+func newElement(start xml.StartElement, pos Position) (e *XMLElement) {
+	e = &XMLElement{StartElement: start, pos: pos}
+	e.owner = e
+	return
+}
+
 // clone an element
-func (e *XMLElement) Clone() *XMLElement {
-	return &XMLElement{
+// note: the clone has no parent until you add it somewhere
+func (e *XMLElement) Clone() (clone *XMLElement) {
+	clone = &XMLElement{
 		StartElement: e.StartElement.Copy(),
 		XMLValue:     e.XMLValue.Clone(),
+		pos:          e.pos,
 	}
+	clone.own()
+	return
 }
 
 // clone an element and give it the specified local name
 func (e *XMLElement) CloneAs(name string) (child *XMLElement) {
-	child = &XMLElement{
-		StartElement: e.StartElement.Copy(),
-		XMLValue:     e.XMLValue.Clone(),
-	}
+	child = e.Clone()
 	child.Name.Local = name
 	return
 }
 
+// set our contents to the given value (see XMLValue.SetValue)
+// floats use any per-tag number formatting for our tag
+func (e *XMLElement) SetValue(value any) {
+	e.XMLValue.setValue(e.Name.Local, value)
+}
+
+// our contents must be a simple string which is a parsable number
+// updates it to be scaled by the given input (using any per-tag number formatting for our tag)
+func (e *XMLElement) ScaleBy(scale float64) (err error) {
+	if e == nil {
+		err = fmt.Errorf("nil XMLElement (probably no child by the given name)")
+		return
+	}
+	return e.XMLValue.scaleBy(e.Name.Local, scale)
+}
+
+// updates it to be current value + adjustment (using any per-tag number formatting for our tag)
+func (e *XMLElement) AdjustValue(adjustment float64) (err error) {
+	if e == nil {
+		err = fmt.Errorf("nil XMLElement (probably no child by the given name)")
+		return
+	}
+	return e.XMLValue.adjustValue(e.Name.Local, adjustment)
+}
+
 // returns the first matching element from the list of elements based on tag (name)
 func (e *XMLElement) Child(tag string) *XMLElement {
 	for _, e = range e.Elements() {
@@ -233,6 +262,43 @@ func (e *XMLElement) HasChildWithValue(tag string, value string) bool {
 	return e.ChildWithValue(tag, value) != nil
 }
 
+// sets our value, unless we hold children (an empty list of them is fine, as is whitespace)
+func (e *XMLElement) setValueUnlessParent(value any) (err error) {
+	// subtle: text which isn't whitespace makes items fail, but then we're simple (and so can be set) anyway
+	if items, _ := e.items(); len(items) != 0 {
+		err = fmt.Errorf("%s has children, so it cannot be set to a value", e.Name.Local)
+		return
+	}
+	if !e.IsSimple() {
+		e.replaceContents(nil)
+	}
+	e.SetValue(value)
+	return
+}
+
+// true if any child with the given tag has the given value (see simpleValue)
+// note: unlike HasChildWithValue, this never panics (so it's what queries use)
+func (e *XMLElement) hasSimpleChild(tag, value string) bool {
+	for _, c := range e.Elements() {
+		if v, ok := simpleValue(c); ok && c.Name.Local == tag && v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// the element's value for matching against (ok is false if it holds elements or other nodes, so it matches no value)
+// note: an empty element's value is "", whether it was decoded (<a />) or made (MakeElement)
+func simpleValue(e *XMLElement) (value string, ok bool) {
+	switch t := e.contents.(type) {
+	case string:
+		return t, true
+	case nil:
+		return "", true
+	}
+	return
+}
+
 // returns true if the given element has a sub element with specified tag and value
 func (e *XMLElement) HasChildWithValueOneOf(tag string, values ...string) bool {
 	return e.ChildWithValueOneOf(tag, values...) != nil
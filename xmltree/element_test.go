@@ -0,0 +1,34 @@
+package xmltree
+
+import "testing"
+
+func TestSimpleValue(t *testing.T) {
+	tree := readTree(t, `<Root><Stats>5</Stats><Stats /><Stats><A>1</A></Stats><Stats><!-- c --></Stats><Stats>  </Stats></Root>`)
+	made := MakeElement("Stats")
+	tests := []struct {
+		e     *XMLElement
+		value string
+		ok    bool
+	}{
+		{tree.Elements.Elements()[0].Elements()[0], "5", true},
+		{tree.Elements.Elements()[0].Elements()[1], "", true},
+		{tree.Elements.Elements()[0].Elements()[2], "", false},
+		{tree.Elements.Elements()[0].Elements()[3], "", false},
+		{tree.Elements.Elements()[0].Elements()[4], "  ", true},
+		{made, "", true},
+	}
+	for i, test := range tests {
+		value, ok := simpleValue(test.e)
+		if value != test.value || ok != test.ok {
+			t.Errorf("%d %s: got %q, %v, want %q, %v", i, test.e, value, ok, test.value, test.ok)
+		}
+	}
+
+	// any child with the tag may match (those holding elements just don't)
+	root := tree.Elements.Elements()[0]
+	for value, want := range map[string]bool{"5": true, "": true, "1": false, "  ": true} {
+		if got := root.hasSimpleChild("Stats", value); got != want {
+			t.Errorf("hasSimpleChild(Stats, %q): got %v, want %v", value, got, want)
+		}
+	}
+}
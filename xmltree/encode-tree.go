@@ -4,9 +4,12 @@ import (
 	"encoding/xml"
 	"io"
 	"os"
+
+	"github.com/lucky-wolf/xml-tree/etc"
 )
 
 // writes ourself out to the given file (file is created / truncated to just our contents)
+// note: the file is compressed if its extension calls for it (e.g. .xml.gz or .xml.zst)
 func (tree *XMLTree) WriteToFile(filename string) (err error) {
 
 	// first we need a stream
@@ -14,9 +17,17 @@ func (tree *XMLTree) WriteToFile(filename string) (err error) {
 	if err != nil {
 		return
 	}
-	defer stream.Close()
+	defer etc.DeferredError(&err, stream.Close)()
+
+	// which may need compressing
+	// subtle: this must be closed before the file is, to complete the compressed stream
+	writer, err := NewCompressingWriter(stream, CompressionForFilename(filename))
+	if err != nil {
+		return
+	}
+	defer etc.DeferredError(&err, writer.Close)()
 
-	encoder := NewEncoder(stream)
+	encoder := NewEncoder(writer)
 	defer encoder.Close()
 
 	// use default formating for a file
@@ -62,7 +73,7 @@ func (e *XMLValue) Encode(encoder FormattedEncoder) (err error) {
 
 	// simple case is just string contents
 	if v, ok := e.contents.(string); ok {
-		err = WriteEscapedText(v, encoder, false)
+		err = encodeText("", v, encoder)
 		return
 	}
 
@@ -114,6 +125,16 @@ func encodeChildren(e any, encoder FormattedEncoder) (err error) {
 	return
 }
 
+// true if we carry an xmlns="..." attribute (as opposed to xmlns:prefix="...", or some other namespace's xmlns)
+func (e *XMLElement) declaresDefaultNamespace() bool {
+	for _, a := range e.Attr {
+		if a.Name.Space == "" && a.Name.Local == "xmlns" {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *XMLElement) Encode(encoder FormattedEncoder) (err error) {
 
 	// write the start token with attributes
@@ -122,7 +143,8 @@ func (e *XMLElement) Encode(encoder FormattedEncoder) (err error) {
 		return
 	}
 
-	if e.Name.Space != "" {
+	// subtle: decoded elements usually already carry their xmlns attribute, so don't write it twice
+	if e.Name.Space != "" && !e.declaresDefaultNamespace() {
 		a := xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: e.Name.Space}
 		err = encoder.WriteByte(' ')
 		if err != nil {
@@ -134,18 +156,22 @@ func (e *XMLElement) Encode(encoder FormattedEncoder) (err error) {
 		}
 	}
 
-	for i := range e.Attr {
+	normalize := normalizationOf(encoder)
+	numbers := numberFormatterOf(encoder)
+	for _, a := range normalize.OrderAttributes(e.Name.Local, e.Attr) {
 		err = encoder.WriteByte(' ')
 		if err != nil {
 			return
 		}
-		err = EncodeAttr(e.Attr[i], encoder)
+		a.Value = normalize.AttrValue(e.Name.Local, a.Name.Local, a.Value)
+		a.Value = numbers.ReformatAttr(a.Name.Local, a.Value)
+		err = EncodeAttr(a, encoder)
 		if err != nil {
 			return
 		}
 	}
 
-	if e.Empty() {
+	if e.Empty() || (e.IsSimple() && normalize.Text(e.Name.Local, e.StringValue()) == "") {
 		_, err = encoder.WriteString(" />")
 	} else {
 		// finish the start tag
@@ -163,7 +189,12 @@ func (e *XMLElement) Encode(encoder FormattedEncoder) (err error) {
 		}
 
 		// ask XMLValue to express itself
-		err = e.XMLValue.Encode(encoder)
+		// subtle: a simple value is written here, as only we know its tag (for per-tag number formatting)
+		if v, ok := e.GetStringValue(); ok {
+			err = encodeText(e.Name.Local, v, encoder)
+		} else {
+			err = e.XMLValue.Encode(encoder)
+		}
 		if err != nil {
 			return
 		}
@@ -32,11 +32,16 @@ type FormattedEncoder interface {
 
 // represents our config choices for outputting an xml tree to a stream
 type encoder struct {
-	writer *bufio.Writer
-	prefix string
-	indent string
-	depth  int
-	closed bool
+	writer  *bufio.Writer
+	prefix  string
+	indent  string
+	depth   int
+	compact bool
+	closed  bool
+
+	normalize *Normalization
+	held      string // indentation not yet written (when stripping trailing space, it's dropped if the line ends there)
+	numbers   *NumberFormatter
 }
 
 // NewEncoder returns a new encoder that writes to w
@@ -51,6 +56,32 @@ func (e *encoder) Configure(prefix, indent string) {
 	e.indent = indent
 }
 
+// Configures this encoder to write everything on a single line (no newlines, prefix or indent)
+func (e *encoder) ConfigureCompact() {
+	e.compact = true
+}
+
+// Configures this encoder to normalize its output (nil turns normalization off)
+func (e *encoder) ConfigureNormalization(normalize *Normalization) {
+	e.normalize = normalize
+}
+
+// implements NormalizingEncoder
+func (e *encoder) Normalization() *Normalization {
+	return e.normalize
+}
+
+// Configures this encoder to rewrite non-integer numeric values with the given policy (nil leaves them all as they are)
+// note: a policy without a base style (NumberDefault) rewrites only the tags and attributes it overrides
+func (e *encoder) ConfigureNumberFormatter(numbers *NumberFormatter) {
+	e.numbers = numbers
+}
+
+// implements NumberFormattingEncoder
+func (e *encoder) NumberFormatter() *NumberFormatter {
+	return e.numbers
+}
+
 // Flushes any buffered XML to the underlying writer
 func (e *encoder) Flush() (err error) {
 	err = e.writer.Flush()
@@ -65,6 +96,10 @@ func (e *encoder) Close() (err error) {
 		return
 	}
 	e.closed = true
+	err = e.dropHeld()
+	if err != nil {
+		return
+	}
 	err = e.writer.Flush()
 	return
 }
@@ -75,7 +110,11 @@ func (e *encoder) Close() (err error) {
 func (p *encoder) Indent(newline bool, changeDepth int, indent bool) (err error) {
 
 	// terminate the current line, and write prefix + indent for start of new line
-	if newline {
+	if newline && !p.compact {
+		err = p.dropHeld()
+		if err != nil {
+			return
+		}
 		err = p.WriteByte('\n')
 		if err != nil {
 			return
@@ -92,35 +131,51 @@ func (p *encoder) Indent(newline bool, changeDepth int, indent bool) (err error)
 	// update our depth
 	p.depth = newdepth
 
-	if indent {
-		// always write the prefix
-		if len(p.prefix) > 0 {
-			_, err = p.WriteString(p.prefix)
-			if err != nil {
-				return
-			}
-		}
+	if indent && !p.compact {
+		// always write the prefix, then as many indents as our current depth requires
+		indentation := p.prefix + strings.Repeat(p.indent, p.depth)
 
-		// write as many indents as our current depth requires
-		if len(p.indent) > 0 {
-			for i := 0; i < p.depth; i++ {
-				_, err = p.WriteString(p.indent)
-				if err != nil {
-					return
-				}
-			}
+		// subtle: when stripping trailing space, we hold this back until we know the line doesn't end here
+		if p.normalize != nil && p.normalize.StripTrailingSpace {
+			p.held += indentation
+			return
 		}
+		_, err = p.WriteString(indentation)
 	}
 
 	return
 }
 
+// drops the trailing space of any held indentation (the line ends here), and writes the rest
+func (e *encoder) dropHeld() (err error) {
+	if len(e.held) != 0 {
+		_, err = e.writer.WriteString(strings.TrimRight(e.held, " \t"))
+		e.held = ""
+	}
+	return
+}
+
+// writes any held indentation (something follows it on the line)
+func (e *encoder) releaseHeld() (err error) {
+	if len(e.held) != 0 {
+		_, err = e.writer.WriteString(e.held)
+		e.held = ""
+	}
+	return
+}
+
 // Write implements io.Writer
 func (e *encoder) Write(b []byte) (n int, err error) {
 	if e.closed {
 		err = ErrClosed
 		return
 	}
+	if len(b) != 0 {
+		err = e.releaseHeld()
+		if err != nil {
+			return
+		}
+	}
 	n, err = e.writer.Write(b)
 	return
 }
@@ -131,6 +186,12 @@ func (e *encoder) WriteString(s string) (n int, err error) {
 		err = ErrClosed
 		return
 	}
+	if len(s) != 0 {
+		err = e.releaseHeld()
+		if err != nil {
+			return
+		}
+	}
 	n, err = e.writer.WriteString(s)
 	return
 }
@@ -141,6 +202,10 @@ func (e *encoder) WriteByte(c byte) (err error) {
 		err = ErrClosed
 		return
 	}
+	err = e.releaseHeld()
+	if err != nil {
+		return
+	}
 	err = e.writer.WriteByte(c)
 	return
 }
@@ -0,0 +1,231 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tree-wide grep (and replace) over tags, text values and attributes
+// results come in document order, each carrying its slash path (see At) and its source position (if it was decoded)
+
+// which parts of an element to search
+type GrepTarget int
+
+const (
+	GrepTags GrepTarget = 1 << iota
+	GrepText
+	GrepAttrNames
+	GrepAttrValues
+
+	GrepAttrs = GrepAttrNames | GrepAttrValues
+	GrepAll   = GrepTags | GrepText | GrepAttrs
+)
+
+func (t GrepTarget) String() string {
+	var parts []string
+	for _, p := range []struct {
+		target GrepTarget
+		name   string
+	}{{GrepTags, "tag"}, {GrepText, "text"}, {GrepAttrNames, "attr-name"}, {GrepAttrValues, "attr-value"}} {
+		if t&p.target != 0 {
+			parts = append(parts, p.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, "|")
+}
+
+// one place the pattern matched
+type GrepMatch struct {
+	Element  *XMLElement
+	Path     string     // the element's path (see At)
+	Position Position   // where the element was in its source (invalid if it was created in code)
+	Target   GrepTarget // which part of the element matched (a single target)
+	Attr     string     // the attribute's name (for attribute matches)
+	Text     string     // the whole of the text that matched (the tag, text value, attribute name or value)
+}
+
+func (m GrepMatch) String() string {
+	path := m.Path
+	if m.Attr != "" {
+		path += "/@" + m.Attr
+	}
+	return fmt.Sprintf("%s: %s [%s] %q", m.Position, path, m.Target, m.Text)
+}
+
+// converts a shell style glob (* ? and [...] classes, with [!...] for negation) into an anchored regexp
+func Glob(pattern string) (r *regexp.Regexp, err error) {
+	sb := &strings.Builder{}
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				err = fmt.Errorf("glob %q: unterminated [", pattern)
+				return
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// every match of r against the targets of every element in the tree
+func (tree *XMLTree) Grep(r *regexp.Regexp, targets GrepTarget) (matches []GrepMatch) {
+	tree.Walk(grepper(r, targets, &matches), nil)
+	return
+}
+
+// every match of r against the targets of us and our descendants (paths are relative to us)
+func (e *XMLElement) Grep(r *regexp.Regexp, targets GrepTarget) (matches []GrepMatch) {
+	e.Walk(grepper(r, targets, &matches), nil)
+	return
+}
+
+// every match of the glob against the targets of every element in the tree
+func (tree *XMLTree) GrepGlob(pattern string, targets GrepTarget) (matches []GrepMatch, err error) {
+	r, err := Glob(pattern)
+	if err != nil {
+		return
+	}
+	matches = tree.Grep(r, targets)
+	return
+}
+
+func grepper(r *regexp.Regexp, targets GrepTarget, matches *[]GrepMatch) WalkFunc {
+	return func(ctx *WalkContext, e *XMLElement) error {
+		found := func(target GrepTarget, text string, attr string) {
+			*matches = append(*matches, GrepMatch{Element: e, Path: ctx.Path(), Position: e.Position(), Target: target, Attr: attr, Text: text})
+		}
+
+		if targets&GrepTags != 0 && r.MatchString(e.Name.Local) {
+			found(GrepTags, e.Name.Local, "")
+		}
+		for _, a := range e.Attr {
+			if targets&GrepAttrNames != 0 && r.MatchString(a.Name.Local) {
+				found(GrepAttrNames, a.Name.Local, a.Name.Local)
+			}
+			if targets&GrepAttrValues != 0 && r.MatchString(a.Value) {
+				found(GrepAttrValues, a.Value, a.Name.Local)
+			}
+		}
+		if s, ok := e.GetStringValue(); ok && targets&GrepText != 0 && r.MatchString(s) {
+			found(GrepText, s, "")
+		}
+		return nil
+	}
+}
+
+// replaces every match of r within the matched text with replacement (which may use $1, ${name}, etc. as regexp.Expand does)
+// renaming a tag or attribute to an invalid name is an error (and leaves it as it was)
+// note: an attribute is found by its name, so it's an error if it has since been removed or renamed
+func (m *GrepMatch) Replace(r *regexp.Regexp, replacement string) (err error) {
+	e := m.Element
+	attr := -1
+	var current string
+	switch m.Target {
+	case GrepTags:
+		current = e.Name.Local
+	case GrepText:
+		var ok bool
+		current, ok = e.GetStringValue()
+		if !ok {
+			err = fmt.Errorf("%s: no longer has a text value", m.Path)
+			return
+		}
+	case GrepAttrNames, GrepAttrValues:
+		attr = e.AttributeIndex(m.Attr)
+		if attr == -1 {
+			err = fmt.Errorf("%s: attribute %s no longer exists", m.Path, m.Attr)
+			return
+		}
+		current = e.Attr[attr].Value
+		if m.Target == GrepAttrNames {
+			current = e.Attr[attr].Name.Local
+		}
+	default:
+		err = fmt.Errorf("%s: cannot replace a match of %s", m.Path, m.Target)
+		return
+	}
+
+	s := r.ReplaceAllString(current, replacement)
+	if s == current {
+		return
+	}
+	switch {
+	case m.Target == GrepTags && !IsValidName(s):
+		err = fmt.Errorf("%s: cannot rename %s to %q: %w", m.Path, current, s, ErrNotWellFormed)
+		return
+	case m.Target == GrepAttrNames && !IsValidName(s):
+		err = fmt.Errorf("%s: cannot rename attribute %s to %q: %w", m.Path, current, s, ErrNotWellFormed)
+		return
+	}
+
+	e.record()
+
+	switch m.Target {
+	case GrepTags:
+		e.Name.Local = s
+	case GrepText:
+		e.SetString(s)
+	case GrepAttrNames:
+		e.Attr[attr].Name.Local = s
+		m.Attr = s
+	case GrepAttrValues:
+		e.Attr[attr].Value = s
+	}
+
+	m.Text = s
+	e.touch()
+	return
+}
+
+// replaces every match of r in the targets of every element in the tree (see GrepMatch.Replace)
+// returns the matches that were replaced (every match is attempted; the errors of any that failed are joined)
+func (tree *XMLTree) ReplaceAll(r *regexp.Regexp, replacement string, targets GrepTarget) (replaced []GrepMatch, err error) {
+	return replaceAll(tree.Grep(r, targets), r, replacement)
+}
+
+// replaces every match of r in the targets of us and our descendants (see GrepMatch.Replace)
+func (e *XMLElement) ReplaceAll(r *regexp.Regexp, replacement string, targets GrepTarget) (replaced []GrepMatch, err error) {
+	return replaceAll(e.Grep(r, targets), r, replacement)
+}
+
+func replaceAll(matches []GrepMatch, r *regexp.Regexp, replacement string) (replaced []GrepMatch, err error) {
+	var errs []error
+	for i, m := range matches {
+		if e := m.Replace(r, replacement); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		replaced = append(replaced, m)
+
+		// subtle: an attribute's value match follows its name match, so it has to follow the rename too
+		if m.Target == GrepAttrNames {
+			for j := i + 1; j < len(matches); j++ {
+				if matches[j].Element == m.Element && matches[j].Attr == matches[i].Attr {
+					matches[j].Attr = m.Attr
+				}
+			}
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
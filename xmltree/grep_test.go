@@ -0,0 +1,156 @@
+package xmltree
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+const grepTestXML = `<Root><Item id="sword" kind="blade"><Name>Long Sword</Name></Item><Item id="axe"><Name>Axe</Name></Item></Root>`
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		miss    []string
+	}{
+		{"*Sword", []string{"Sword", "Long Sword"}, []string{"Swords", "sword"}},
+		{"A?e", []string{"Axe", "Ace"}, []string{"Ae", "Axes"}},
+		{"[ab]*", []string{"axe", "blade"}, []string{"cat", "Axe"}},
+		{"[!ab]*", []string{"cat", "Axe"}, []string{"axe", "blade"}},
+		{"a.b", []string{"a.b"}, []string{"axb"}},
+	}
+	for _, tt := range tests {
+		r, err := Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+			continue
+		}
+		for _, s := range tt.match {
+			if !r.MatchString(s) {
+				t.Errorf("%s should match %q", tt.pattern, s)
+			}
+		}
+		for _, s := range tt.miss {
+			if r.MatchString(s) {
+				t.Errorf("%s shouldn't match %q", tt.pattern, s)
+			}
+		}
+	}
+
+	if _, err := Glob("[ab"); err == nil {
+		t.Error("unterminated class should fail")
+	}
+}
+
+func TestGrep(t *testing.T) {
+	tree := readTree(t, grepTestXML)
+	tests := []struct {
+		pattern string
+		targets GrepTarget
+		want    []string
+	}{
+		{"^Item$", GrepTags, []string{"Root/Item[1] [tag] \"Item\"", "Root/Item[2] [tag] \"Item\""}},
+		{"Sword", GrepText, []string{"Root/Item[1]/Name [text] \"Long Sword\""}},
+		{"^id$", GrepAttrNames, []string{"Root/Item[1]/@id [attr-name] \"id\"", "Root/Item[2]/@id [attr-name] \"id\""}},
+		{"a", GrepAttrValues, []string{"Root/Item[1]/@kind [attr-value] \"blade\"", "Root/Item[2]/@id [attr-value] \"axe\""}},
+		{"(?i)axe", GrepAll, []string{"Root/Item[2]/@id [attr-value] \"axe\"", "Root/Item[2]/Name [text] \"Axe\""}},
+		{"nothing", GrepAll, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range tree.Grep(regexp.MustCompile(tt.pattern), tt.targets) {
+			s := m.String()
+			got = append(got, s[len(m.Position.String())+2:])
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.pattern, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %q, want %q", tt.pattern, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestGrepPositions(t *testing.T) {
+	tree := readTree(t, "<Root>\n\t<Item>x</Item>\n</Root>")
+	matches := tree.Grep(regexp.MustCompile("^x$"), GrepText)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches", len(matches))
+	}
+	if p := matches[0].Position; p.Line != 2 {
+		t.Errorf("got position %s, want line 2", p)
+	}
+}
+
+func TestGrepReplace(t *testing.T) {
+	tree := readTree(t, grepTestXML)
+	replaced, err := tree.ReplaceAll(regexp.MustCompile(`^(\w+) Sword$`), "${1} Blade", GrepText)
+	if err != nil || len(replaced) != 1 || replaced[0].Text != "Long Blade" {
+		t.Fatalf("got %v, %v", replaced, err)
+	}
+
+	_, err = tree.ReplaceAll(regexp.MustCompile(`^Item$`), "Weapon", GrepTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Root><Weapon id="sword" kind="blade"><Name>Long Blade</Name></Weapon><Weapon id="axe"><Name>Axe</Name></Weapon></Root>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+
+	// invalid names are refused
+	_, err = tree.ReplaceAll(regexp.MustCompile(`^Weapon$`), "1st", GrepTags)
+	if !errors.Is(err, ErrNotWellFormed) {
+		t.Errorf("got %v, want ErrNotWellFormed", err)
+	}
+	if got := tree.String(); got != want {
+		t.Errorf("failed rename changed the tree: %s", got)
+	}
+}
+
+func TestGrepReplaceAttributes(t *testing.T) {
+	tree := readTree(t, `<a id="id" x="1" />`)
+
+	// the name and the value of the same attribute both match, and the value follows the rename
+	replaced, err := tree.ReplaceAll(regexp.MustCompile(`^id$`), "key", GrepAttrs)
+	if err != nil || len(replaced) != 2 {
+		t.Fatalf("got %v, %v", replaced, err)
+	}
+	if got, want := tree.String(), `<a key="key" x="1" />`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestGrepReplaceStale(t *testing.T) {
+	tree := readTree(t, `<a x="1" y="2" />`)
+	e := tree.Elements.Elements()[0]
+	matches := tree.Grep(regexp.MustCompile(`^2$`), GrepAttrValues)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches", len(matches))
+	}
+
+	// the attribute moves, so we have to find it by name
+	e.RemoveAttribute("x")
+	err := matches[0].Replace(regexp.MustCompile(`2`), "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.String(), `<a y="3" />`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// and once it's gone, there's nothing to replace
+	e.RemoveAttribute("y")
+	e.SetAttribute("z", 3)
+	err = matches[0].Replace(regexp.MustCompile(`3`), "4")
+	if err == nil {
+		t.Error("replacing a removed attribute should fail")
+	}
+	if got, want := tree.String(), `<a z="3" />`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
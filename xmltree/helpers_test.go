@@ -0,0 +1,17 @@
+package xmltree
+
+import (
+	"strings"
+	"testing"
+)
+
+// reads a tree from the given xml (failing the test if it won't parse)
+func readTree(t *testing.T, s string) *XMLTree {
+	t.Helper()
+	tree := &XMLTree{}
+	err := tree.Read(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
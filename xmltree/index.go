@@ -0,0 +1,205 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keyed lookup indexes
+// an index maps keys to the elements selected by an xpath, giving O(1) lookups instead of a search per lookup
+// every edit made through our API is counted on the root of the subtree it touches, so an index can tell it's stale
+// warn: changes made directly to exported fields (e.g. e.Attr or e.Name) aren't counted, though lookups do recheck
+// that the element they find still has the key it was indexed under
+
+var (
+	ErrStaleIndex   = errors.New("index is stale: the tree has been edited since it was built (see Rebuild)")
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+// returns the key to index an element by (or false if it shouldn't be indexed)
+type KeyFunc func(e *XMLElement) (key string, ok bool)
+
+// keys elements by the value of their child with the given tag
+func KeyByChild(tag string) KeyFunc {
+	return func(e *XMLElement) (key string, ok bool) {
+		key, err := e.StringValueOf(tag)
+		return key, err == nil
+	}
+}
+
+// keys elements by the value of the given attribute
+func KeyByAttr(name string) KeyFunc {
+	return func(e *XMLElement) (key string, ok bool) {
+		return e.Attribute(name)
+	}
+}
+
+// keys elements by their own (simple) value
+func KeyByValue(e *XMLElement) (key string, ok bool) {
+	return e.GetStringValue()
+}
+
+// parses a key spec of the form Tag=Child (see KeyByChild) or Tag=@attr (see KeyByAttr), as the command line tools take
+// note: the tag isn't checked, so that callers may give it their own meaning (e.g. * for any tag)
+func ParseKeySpec(spec string) (tag string, key KeyFunc, err error) {
+	tag, name, ok := strings.Cut(spec, "=")
+	attr, isAttr := strings.CutPrefix(name, "@")
+	if !ok || tag == "" || !IsValidName(attr) {
+		err = fmt.Errorf("invalid key %q: expected Tag=Child or Tag=@attr", spec)
+		return
+	}
+	if isAttr {
+		key = KeyByAttr(attr)
+	} else {
+		key = KeyByChild(name)
+	}
+	return
+}
+
+// counts an edit to our contents against the root of the subtree we belong to
+func (v *XMLValue) touch() {
+	if v.owner != nil {
+		v.owner.Root().edits++
+	}
+}
+
+// the state of one of the tree's top level elements at the time we were built
+type indexedRoot struct {
+	element *XMLElement
+	edits   uint64
+}
+
+type KeyIndex struct {
+	tree     *XMLTree
+	path     string
+	key      KeyFunc
+	roots    []indexedRoot
+	keys     []string // in document order of first appearance
+	elements map[string][]*XMLElement
+}
+
+// builds an index of the elements selected by path (an xpath), keyed by key
+// note: elements which key says not to index are simply left out
+func (tree *XMLTree) IndexBy(path string, key KeyFunc) (index *KeyIndex, err error) {
+	index = &KeyIndex{tree: tree, path: path, key: key}
+	err = index.Rebuild()
+	if err != nil {
+		index = nil
+	}
+	return
+}
+
+// brings us back up to date with our tree
+func (x *KeyIndex) Rebuild() (err error) {
+	elements, err := x.tree.XPathElements(x.path)
+	if err != nil {
+		return
+	}
+
+	x.keys = nil
+	x.elements = map[string][]*XMLElement{}
+	for _, e := range elements {
+		k, ok := x.key(e)
+		if !ok {
+			continue
+		}
+		if _, found := x.elements[k]; !found {
+			x.keys = append(x.keys, k)
+		}
+		x.elements[k] = append(x.elements[k], e)
+	}
+
+	x.roots = nil
+	x.tree.Elements.eachElement(func(e *XMLElement) bool {
+		x.roots = append(x.roots, indexedRoot{e, e.edits})
+		return true
+	})
+
+	return
+}
+
+// true if our tree has been edited since we were built
+func (x *KeyIndex) Stale() bool {
+	i := 0
+	unchanged := x.tree.Elements.eachElement(func(e *XMLElement) bool {
+		if i == len(x.roots) || x.roots[i].element != e || e.edits != x.roots[i].edits || e.parent != nil {
+			return false
+		}
+		i++
+		return true
+	})
+	return !unchanged || i != len(x.roots)
+}
+
+// the element with the given key (nil if there is none)
+// errors if we're stale, or if more than one element has that key (in which case the first of them is returned)
+func (x *KeyIndex) Lookup(key string) (element *XMLElement, err error) {
+	elements, err := x.LookupAll(key)
+	if err != nil || len(elements) == 0 {
+		return
+	}
+
+	element = elements[0]
+	if len(elements) > 1 {
+		err = fmt.Errorf("%s: %q is shared by %d elements: %w", x.path, key, len(elements), ErrDuplicateKey)
+	}
+	return
+}
+
+// every element with the given key (in document order)
+// errors if we're stale
+func (x *KeyIndex) LookupAll(key string) (elements []*XMLElement, err error) {
+	if x.Stale() {
+		err = fmt.Errorf("%s: %w", x.path, ErrStaleIndex)
+		return
+	}
+
+	elements = x.elements[key]
+	for _, e := range elements {
+		if k, ok := x.key(e); !ok || k != key {
+			err = fmt.Errorf("%s: %q no longer has that key: %w", x.path, key, ErrStaleIndex)
+			elements = nil
+			return
+		}
+	}
+	return
+}
+
+// true if some element has the given key (and we're not stale)
+func (x *KeyIndex) Has(key string) bool {
+	elements, err := x.LookupAll(key)
+	return err == nil && len(elements) != 0
+}
+
+// every key we have (in document order of first appearance)
+func (x *KeyIndex) Keys() []string {
+	return x.keys
+}
+
+// the number of distinct keys we have
+func (x *KeyIndex) Len() int {
+	return len(x.keys)
+}
+
+// every key which is shared by more than one element, along with those elements
+func (x *KeyIndex) Duplicates() (duplicates map[string][]*XMLElement) {
+	duplicates = map[string][]*XMLElement{}
+	for k, elements := range x.elements {
+		if len(elements) > 1 {
+			duplicates[k] = elements
+		}
+	}
+	return
+}
+
+// errors (naming every duplicated key) unless every key is unique
+func (x *KeyIndex) Unique() (err error) {
+	var errs []error
+	for _, k := range x.keys {
+		if n := len(x.elements[k]); n > 1 {
+			errs = append(errs, fmt.Errorf("%s: %q is shared by %d elements: %w", x.path, k, n, ErrDuplicateKey))
+		}
+	}
+	return errors.Join(errs...)
+}
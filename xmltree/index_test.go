@@ -0,0 +1,149 @@
+package xmltree
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+const indexDoc = `<Items>
+	<Item id="1"><Name>hammer</Name></Item>
+	<Item id="2"><Name>saw</Name></Item>
+	<Item id="3"><Name>hammer</Name></Item>
+	<Item id="4" />
+</Items>`
+
+func TestIndexLookup(t *testing.T) {
+	tree := readTree(t, indexDoc)
+	items := tree.Elements.Elements()[0].Elements()
+
+	byID, err := tree.IndexBy("/Items/Item", KeyByAttr("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.Len() != 4 || byID.Unique() != nil {
+		t.Errorf("by id: %d keys, %v", byID.Len(), byID.Unique())
+	}
+	e, err := byID.Lookup("3")
+	if err != nil || e != items[2] {
+		t.Errorf("Lookup(3): got %v, %v", e, err)
+	}
+	e, err = byID.Lookup("5")
+	if err != nil || e != nil || byID.Has("5") {
+		t.Errorf("Lookup(5): got %v, %v", e, err)
+	}
+
+	// Item 4 has no Name, so it isn't indexed
+	byName, err := tree.IndexBy("/Items/Item", KeyByChild("Name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(byName.Keys(), []string{"hammer", "saw"}) {
+		t.Errorf("Keys: got %v", byName.Keys())
+	}
+	e, err = byName.Lookup("hammer")
+	if !errors.Is(err, ErrDuplicateKey) || e != items[0] {
+		t.Errorf("Lookup(hammer): got %v, %v", e, err)
+	}
+	all, err := byName.LookupAll("hammer")
+	if err != nil || !slices.Equal(all, []*XMLElement{items[0], items[2]}) {
+		t.Errorf("LookupAll(hammer): got %v, %v", all, err)
+	}
+	if d := byName.Duplicates(); len(d) != 1 || len(d["hammer"]) != 2 {
+		t.Errorf("Duplicates: got %v", d)
+	}
+	if err := byName.Unique(); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Unique: got %v", err)
+	}
+
+	byValue, err := tree.IndexBy("//Name", KeyByValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byValue.Len() != 2 {
+		t.Errorf("by value: got %v", byValue.Keys())
+	}
+
+	if _, err := tree.IndexBy("/Items/Item[", KeyByValue); err == nil {
+		t.Error("an invalid path built an index")
+	}
+}
+
+func TestIndexStaleness(t *testing.T) {
+	edits := []struct {
+		name string
+		edit func(tree *XMLTree)
+	}{
+		{"child value", func(tree *XMLTree) { tree.Elements.Elements()[0].Elements()[1].Child("Name").SetValue("axe") }},
+		{"attribute", func(tree *XMLTree) { tree.Elements.Elements()[0].Elements()[0].SetAttribute("id", "9") }},
+		{"removed", func(tree *XMLTree) { tree.Elements.Elements()[0].Elements()[0].Remove() }},
+		{"added", func(tree *XMLTree) { tree.Elements.Elements()[0].Append(MakeElement("Item")) }},
+		{"new root", func(tree *XMLTree) { tree.Elements.SetContents(MakeElement("Items")) }},
+	}
+	for _, test := range edits {
+		tree := readTree(t, indexDoc)
+		index, err := tree.IndexBy("/Items/Item", KeyByAttr("id"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index.Stale() {
+			t.Fatalf("%s: stale before any edit", test.name)
+		}
+
+		test.edit(tree)
+		if !index.Stale() {
+			t.Errorf("%s: not stale", test.name)
+		}
+		if _, err := index.Lookup("2"); !errors.Is(err, ErrStaleIndex) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrStaleIndex)
+		}
+
+		err = index.Rebuild()
+		if err != nil || index.Stale() {
+			t.Errorf("%s: still stale after Rebuild (%v)", test.name, err)
+		}
+	}
+}
+
+func TestIndexNoticesUncountedEdits(t *testing.T) {
+	tree := readTree(t, indexDoc)
+	index, err := tree.IndexBy("/Items/Item", KeyByAttr("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// editing the exported fields directly isn't counted, but the lookup still sees the key changed
+	tree.Elements.Elements()[0].Elements()[1].Attr[0].Value = "7"
+	if _, err := index.Lookup("2"); !errors.Is(err, ErrStaleIndex) {
+		t.Errorf("got %v, want %v", err, ErrStaleIndex)
+	}
+}
+
+func TestParseKeySpec(t *testing.T) {
+	e := readTree(t, `<Item id="7"><Name>saw</Name></Item>`).Elements.Elements()[0]
+	tests := []struct {
+		spec string
+		tag  string
+		key  string
+	}{
+		{"Item=Name", "Item", "saw"},
+		{"Item=@id", "Item", "7"},
+		{"*=@id", "*", "7"},
+	}
+	for _, tt := range tests {
+		tag, key, err := ParseKeySpec(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if k, ok := key(e); tag != tt.tag || !ok || k != tt.key {
+			t.Errorf("%s: got %s keyed by %q (%v), want %s keyed by %q", tt.spec, tag, k, ok, tt.tag, tt.key)
+		}
+	}
+
+	for _, spec := range []string{"", "Item", "Item=", "Item=@", "=Name", "Item=@1st", "Item=a b"} {
+		if _, _, err := ParseKeySpec(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
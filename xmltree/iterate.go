@@ -0,0 +1,155 @@
+package xmltree
+
+import "iter"
+
+// iterator based traversals
+// these all yield (parent, element) pairs, and stop as soon as the caller breaks out of the range loop
+// note: unlike Elements(), we walk our contents directly (no per-level slices are allocated)
+
+// calls yield for each of our child elements, returning false if yield did (i.e. the caller broke out)
+func (v *XMLValue) eachElement(yield func(*XMLElement) bool) bool {
+	if v == nil {
+		return true
+	}
+	switch t := v.contents.(type) {
+	case *XMLElement:
+		return yield(t)
+	case []any:
+		for _, c := range t {
+			if e, ok := c.(*XMLElement); ok && !yield(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// our child elements (without their parent, which is simply our owner)
+func (v *XMLValue) ChildElements() iter.Seq[*XMLElement] {
+	return func(yield func(*XMLElement) bool) {
+		v.eachElement(yield)
+	}
+}
+
+// depth first (document order): yields each element under v, then its descendants
+func eachDFS(parent *XMLElement, v *XMLValue, yield func(parent, element *XMLElement) bool) bool {
+	return v.eachElement(func(e *XMLElement) bool {
+		return yield(parent, e) && eachDFS(e, &e.XMLValue, yield)
+	})
+}
+
+// breadth first: yields all elements under v level by level
+func eachBFS(parent *XMLElement, v *XMLValue, yield func(parent, element *XMLElement) bool) {
+
+	type pair struct{ parent, element *XMLElement }
+	var queue []pair
+
+	v.eachElement(func(e *XMLElement) bool {
+		queue = append(queue, pair{parent, e})
+		return true
+	})
+
+	for len(queue) != 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if !yield(p.parent, p.element) {
+			return
+		}
+
+		p.element.eachElement(func(e *XMLElement) bool {
+			queue = append(queue, pair{p.element, e})
+			return true
+		})
+	}
+}
+
+// filters a sequence of (parent, element) by finder
+func matching(seq iter.Seq2[*XMLElement, *XMLElement], finder Finder) iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		for parent, element := range seq {
+			if finder(element) && !yield(parent, element) {
+				return
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////
+// trees (root elements have a nil parent)
+
+// every element in the tree, in document order (same as DescendantsDFS)
+func (tree *XMLTree) All() iter.Seq2[*XMLElement, *XMLElement] {
+	return tree.DescendantsDFS()
+}
+
+// every element in the tree, depth first (document order)
+func (tree *XMLTree) DescendantsDFS() iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		eachDFS(nil, &tree.Elements, yield)
+	}
+}
+
+// every element in the tree, breadth first (the same order FindUsing searches in)
+func (tree *XMLTree) DescendantsBFS() iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		eachBFS(nil, &tree.Elements, yield)
+	}
+}
+
+// every element your finder function responds true to (breadth first, like FindUsing)
+func (tree *XMLTree) Matching(finder Finder) iter.Seq2[*XMLElement, *XMLElement] {
+	return matching(tree.DescendantsBFS(), finder)
+}
+
+// every element which has that tag and value (the FindAll variant of Find)
+func (tree *XMLTree) FindAll(tag, value string) iter.Seq2[*XMLElement, *XMLElement] {
+	return tree.Matching(func(element *XMLElement) bool { return element.Matches(tag, value) })
+}
+
+// every element which has all of these key-value pairs (the FindAll variant of FindElementWithAll)
+func (tree *XMLTree) FindAllWithAll(properties ...SearchProperty) iter.Seq2[*XMLElement, *XMLElement] {
+	return tree.Matching(func(element *XMLElement) bool { return element.MatchesAll(properties...) })
+}
+
+////////////////////////////////////////////////////
+// elements (our direct children have us as their parent)
+
+// our child elements
+func (e *XMLElement) Children() iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		e.eachElement(func(c *XMLElement) bool { return yield(e, c) })
+	}
+}
+
+// our child elements with the given tag
+func (e *XMLElement) ChildrenNamed(tag string) iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		e.eachElement(func(c *XMLElement) bool { return c.Name.Local != tag || yield(e, c) })
+	}
+}
+
+// all of our descendants (not including us), in document order (same as DescendantsDFS)
+func (e *XMLElement) Descendants() iter.Seq2[*XMLElement, *XMLElement] {
+	return e.DescendantsDFS()
+}
+
+// all of our descendants (not including us), depth first (document order)
+func (e *XMLElement) DescendantsDFS() iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		eachDFS(e, &e.XMLValue, yield)
+	}
+}
+
+// all of our descendants (not including us), breadth first
+func (e *XMLElement) DescendantsBFS() iter.Seq2[*XMLElement, *XMLElement] {
+	return func(yield func(parent, element *XMLElement) bool) {
+		eachBFS(e, &e.XMLValue, yield)
+	}
+}
+
+// every descendant your finder function responds true to (breadth first, like FindUsing)
+// note: this is the finder flavor of Matching (which matches our children's tags against a regex)
+func (e *XMLElement) DescendantsMatching(finder Finder) iter.Seq2[*XMLElement, *XMLElement] {
+	return matching(e.DescendantsBFS(), finder)
+}
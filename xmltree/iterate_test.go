@@ -0,0 +1,86 @@
+package xmltree
+
+import (
+	"iter"
+	"strings"
+	"testing"
+)
+
+const iterateDoc = `<a><b><d /><e /></b><!-- c --><c><f><g /></f></c></a>`
+
+// the sequence as "parent>element" pairs ("-" for no parent)
+func pairs(seq iter.Seq2[*XMLElement, *XMLElement]) string {
+	var names []string
+	for parent, element := range seq {
+		p := "-"
+		if parent != nil {
+			p = parent.Name.Local
+		}
+		names = append(names, p+">"+element.Name.Local)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestIterators(t *testing.T) {
+	tree := readTree(t, iterateDoc)
+	a := tree.Elements.Elements()[0]
+	tests := []struct {
+		name string
+		seq  iter.Seq2[*XMLElement, *XMLElement]
+		want string
+	}{
+		{"All", tree.All(), "->a a>b b>d b>e a>c c>f f>g"},
+		{"DescendantsDFS", tree.DescendantsDFS(), "->a a>b b>d b>e a>c c>f f>g"},
+		{"DescendantsBFS", tree.DescendantsBFS(), "->a a>b a>c b>d b>e c>f f>g"},
+		{"Children", a.Children(), "a>b a>c"},
+		{"ChildrenNamed", a.ChildrenNamed("c"), "a>c"},
+		{"Descendants", a.Descendants(), "a>b b>d b>e a>c c>f f>g"},
+		{"element DescendantsBFS", a.DescendantsBFS(), "a>b a>c b>d b>e c>f f>g"},
+		{"Matching", tree.Matching(func(e *XMLElement) bool { return e.Empty() }), "b>d b>e f>g"},
+		{"DescendantsMatching", a.DescendantsMatching(func(e *XMLElement) bool { return !e.Empty() }), "a>b a>c c>f"},
+	}
+	for _, test := range tests {
+		if got := pairs(test.seq); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIteratorsBreakEarly(t *testing.T) {
+	tree := readTree(t, iterateDoc)
+	for _, seq := range []iter.Seq2[*XMLElement, *XMLElement]{tree.DescendantsDFS(), tree.DescendantsBFS()} {
+		count := 0
+		for range seq {
+			count++
+			if count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Errorf("got %d elements, want 3", count)
+		}
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	tree := readTree(t, `<a><Item><Name>x</Name><Kind>tool</Kind></Item><Item><Name>y</Name><Kind>tool</Kind></Item><Item><Name>x</Name><Kind>food</Kind></Item></a>`)
+
+	var found []string
+	for parent, e := range tree.FindAll("Name", "x") {
+		found = append(found, parent.Name.Local+">"+e.Name.Local+"="+e.StringValue())
+	}
+	if got := strings.Join(found, " "); got != "Item>Name=x Item>Name=x" {
+		t.Errorf("FindAll: got %q", got)
+	}
+
+	count := 0
+	for _, e := range tree.FindAllWithAll(SearchProperty{"Name", "x"}, SearchProperty{"Kind", "tool"}) {
+		count++
+		if e.Name.Local != "Item" {
+			t.Errorf("FindAllWithAll: got %s", e.Name.Local)
+		}
+	}
+	if count != 1 {
+		t.Errorf("FindAllWithAll: got %d, want 1", count)
+	}
+}
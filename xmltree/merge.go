@@ -0,0 +1,406 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// three-way merge: combines the changes two sides (ours and theirs) made to their common ancestor (base)
+// elements are matched as by Diff (by key, or by position among their same-tag siblings), so we merge the structure rather
+// than lines: edits to different elements, or to different attributes of one element, never conflict
+// a true conflict is marked by comments (as git marks lines) just before the element which holds it:
+// - both sides changed the same attribute or value differently: the element keeps ours, and the marker gives both
+// - one side changed what the other deleted, or both changed an element between text and children: both sides' versions of
+//   the element are kept, between markers (except for the root, of which a document has only one: the marker holds theirs)
+
+var ErrMergeConflict = errors.New("merge conflict")
+
+type MergeOptions struct {
+	DiffOptions         // how elements are matched, and which differences aren't changes
+	Ours, Theirs string // the labels in conflict markers (default ours and theirs)
+}
+
+type MergeConflict struct {
+	Path               string // the element's path (in ours, or in theirs if ours deleted it)
+	Reason             string
+	Base, Ours, Theirs *XMLElement // each side's version (nil where it has none)
+}
+
+func (c *MergeConflict) Error() string {
+	return fmt.Sprintf("%s: %s", c.Path, c.Reason)
+}
+
+func (c *MergeConflict) Unwrap() error {
+	return ErrMergeConflict
+}
+
+type MergeResult struct {
+	Tree      *XMLTree // the merged tree (with any conflicts marked)
+	Conflicts []*MergeConflict
+}
+
+// every conflict (joined), or nil
+func (r *MergeResult) Err() error {
+	errs := make([]error, len(r.Conflicts))
+	for i, c := range r.Conflicts {
+		errs[i] = c
+	}
+	return errors.Join(errs...)
+}
+
+type merger struct {
+	MergeOptions
+	result *MergeResult
+}
+
+// merges the changes ours and theirs each made to base
+// note: the merged tree shares nothing with the inputs
+func Merge3(base, ours, theirs *XMLTree, opts MergeOptions) (result *MergeResult) {
+	if opts.Ours == "" {
+		opts.Ours = "ours"
+	}
+	if opts.Theirs == "" {
+		opts.Theirs = "theirs"
+	}
+	m := &merger{MergeOptions: opts, result: &MergeResult{Tree: &XMLTree{}}}
+	m.result.Tree.Elements.SetContents(m.level(&base.Elements, &ours.Elements, &theirs.Elements, true))
+	return m.result
+}
+
+// the merged items for a key
+type mergeSlot struct {
+	key   string
+	items []any
+}
+
+// merges the items of three values (bv is nil for a value base doesn't have, top is true for the top level of a tree)
+func (m *merger) level(bv, ov, tv *XMLValue, top bool) (merged []any) {
+	// subtle: ignoring comments, we keep ours' (as if neither base nor theirs had any)
+	bKeys, bItems := m.keyed(bv, !m.IgnoreComments)
+	oKeys, oItems := m.keyed(ov, true)
+	tKeys, tItems := m.keyed(tv, !m.IgnoreComments)
+	resolve := func(key string) []any {
+		return m.item(bItems[key], oItems[key], tItems[key])
+	}
+
+	// we follow ours' order, unless only theirs reordered
+	first, second := oKeys, tKeys
+	if sameOrder(bKeys, oKeys) && !sameOrder(bKeys, tKeys) {
+		first, second = tKeys, oKeys
+	}
+
+	var slots []mergeSlot
+	for _, k := range first {
+		slots = append(slots, mergeSlot{k, resolve(k)})
+	}
+
+	// whatever only the second side has goes after whatever preceded it there
+	at := 0
+	for _, k := range second {
+		if i := slices.IndexFunc(slots, func(s mergeSlot) bool { return s.key == k }); i != -1 {
+			at = i + 1
+			continue
+		}
+		slots = slices.Insert(slots, at, mergeSlot{k, resolve(k)})
+		at++
+	}
+	if top {
+		m.oneRoot(slots, oItems)
+	}
+
+	for _, s := range slots {
+		merged = append(merged, s.items...)
+	}
+	return
+}
+
+// the items of a value, and their keys (in order)
+// elements are keyed as by Diff, and other items by their text (so they're only ever kept, added or deleted)
+func (m *merger) keyed(v *XMLValue, comments bool) (keys []string, items map[string]any) {
+	items = map[string]any{}
+	if v == nil {
+		return
+	}
+	all, _ := v.items()
+	elementKeys := m.keys(v.Elements())
+	seen := map[string]int{}
+	for _, item := range all {
+		var key string
+		switch t := item.(type) {
+		case *XMLElement:
+			key, elementKeys = elementKeys[0], elementKeys[1:]
+			keys = append(keys, key)
+			items[key] = item
+			continue
+		case *XMLComment:
+			if !comments {
+				continue
+			}
+			key = "<!--" + string(t.Comment)
+		case *XMLProcInst:
+			key = "<?" + t.Target + " " + string(t.Inst)
+		case *XMLDirective:
+			key = "<!" + string(t.Directive)
+		}
+		seen[key]++
+		key += "\x00" + strconv.Itoa(seen[key])
+		keys = append(keys, key)
+		items[key] = item
+	}
+	return
+}
+
+// merges one item (nil on a side which doesn't have it), returning what goes in its place
+func (m *merger) item(b, o, t any) []any {
+	switch {
+	case o == nil && t == nil:
+		return nil
+	case b == nil && t == nil:
+		return []any{CloneContents(o)}
+	case b == nil && o == nil:
+		return []any{CloneContents(t)}
+	case o == nil:
+		if m.same(b, t) {
+			return nil
+		}
+		return m.conflict(b, o, t, fmt.Sprintf("deleted in %s but changed in %s", m.Ours, m.Theirs))
+	case t == nil:
+		if m.same(b, o) {
+			return nil
+		}
+		return m.conflict(b, o, t, fmt.Sprintf("changed in %s but deleted in %s", m.Ours, m.Theirs))
+	case m.same(o, t), b != nil && m.same(b, t):
+		return []any{CloneContents(o)}
+	case b != nil && m.same(b, o):
+		return []any{CloneContents(t)}
+	}
+
+	// subtle: anything else with the same key on both sides is the same (so it never gets here)
+	be, _ := b.(*XMLElement)
+	return m.element(be, o.(*XMLElement), t.(*XMLElement))
+}
+
+// a document has only the one root: where the sides disagree about which (or what) it is, we keep ours (theirs if ours has
+// none) and write any other into a conflict marker
+func (m *merger) oneRoot(slots []mergeSlot, oItems map[string]any) {
+	keep := -1
+	for i, s := range slots {
+		if slices.ContainsFunc(s.items, isElement) && (keep == -1 || oItems[s.key] != nil && oItems[slots[keep].key] == nil) {
+			keep = i
+		}
+	}
+	for i, s := range slots {
+		elements := 0
+		for j, item := range s.items {
+			e, ok := item.(*XMLElement)
+			if !ok {
+				continue
+			}
+			if elements++; i == keep && elements == 1 {
+				continue
+			}
+			if len(s.items) == 1 {
+				// it merged cleanly, so it isn't between markers already: each side replaced the root
+				m.record(nil, nil, e, "root element replaced in both")
+				s.items[j] = marker(fmt.Sprintf("<<<<<<< %s ======= %s >>>>>>> %s", m.Ours, e, m.Theirs))
+				continue
+			}
+			s.items[j] = marker(fmt.Sprint(e))
+		}
+	}
+}
+
+func isElement(item any) bool {
+	_, ok := item.(*XMLElement)
+	return ok
+}
+
+// merges an element both sides have (and changed)
+// conflicting attributes and values keep ours, and are marked just before the element
+func (m *merger) element(b, o, t *XMLElement) (items []any) {
+	var contents any
+	valueConflict := false
+	bt, bText := mergeText(b)
+	ot, oText := diffText(o)
+	tt, tText := diffText(t)
+	switch {
+	case bText && oText && tText:
+		switch {
+		case m.equal(ot, tt), m.equal(bt, tt):
+			contents = o.contents
+		case m.equal(bt, ot):
+			contents = t.contents
+		default:
+			contents = o.contents
+			valueConflict = true
+		}
+
+	case bText && strings.TrimSpace(bt) != "" || oText && strings.TrimSpace(ot) != "" || tText && strings.TrimSpace(tt) != "":
+		// between text and children: the contents as a whole changed
+		switch {
+		case m.sameContents(o, t), m.sameContents(b, t):
+			contents = CloneContents(o.contents)
+		case m.sameContents(b, o):
+			contents = CloneContents(t.contents)
+		default:
+			return m.conflict(b, o, t, "contents changed in both")
+		}
+
+	default:
+		var bv *XMLValue
+		if b != nil {
+			bv = &b.XMLValue
+		}
+		if merged := m.level(bv, &o.XMLValue, &t.XMLValue, false); len(merged) != 0 {
+			contents = merged
+		}
+	}
+
+	attrs, conflicts := m.attrs(b, o, t)
+	for _, n := range conflicts {
+		field := func(e *XMLElement) string {
+			if attr := mergeAttr(e, n); attr != nil {
+				return fmt.Sprintf("@%s=%q", n, attr.Value)
+			}
+			return fmt.Sprintf("(no @%s)", n)
+		}
+		items = append(items, m.fieldConflict(b, o, t, fmt.Sprintf("attribute %s changed in both", n), field(o), field(t)))
+	}
+	if valueConflict {
+		items = append(items, m.fieldConflict(b, o, t, "value changed in both", strconv.Quote(ot), strconv.Quote(tt)))
+	}
+
+	e := newElement(o.StartElement.Copy(), o.pos)
+	e.Attr = attrs
+	e.replaceContents(contents)
+	return append(items, e)
+}
+
+// merges the attributes of an element both sides have (conflicts are those both changed differently, which keep ours)
+func (m *merger) attrs(b, o, t *XMLElement) (attrs []xml.Attr, conflicts []string) {
+	names := []string{}
+	for _, e := range []*XMLElement{o, t} {
+		for _, attr := range e.Attr {
+			if !slices.Contains(names, attr.Name.Local) {
+				names = append(names, attr.Name.Local)
+			}
+		}
+	}
+
+	same := func(x, y *xml.Attr) bool {
+		return x == nil && y == nil || x != nil && y != nil && m.equal(x.Value, y.Value)
+	}
+	for _, n := range names {
+		ba, oa, ta := mergeAttr(b, n), mergeAttr(o, n), mergeAttr(t, n)
+		attr := oa
+		switch {
+		case same(oa, ta), same(ba, ta):
+		case same(ba, oa):
+			attr = ta
+		default:
+			conflicts = append(conflicts, n)
+		}
+		if attr != nil {
+			attrs = append(attrs, *attr)
+		}
+	}
+	return
+}
+
+// leaves both sides' versions between conflict markers (and records the conflict)
+func (m *merger) conflict(b, o, t any, reason string) (items []any) {
+	be, _ := b.(*XMLElement)
+	oe, _ := o.(*XMLElement)
+	te, _ := t.(*XMLElement)
+	m.record(be, oe, te, reason)
+
+	items = append(items, marker("<<<<<<< "+m.Ours))
+	if o != nil {
+		items = append(items, CloneContents(o))
+	}
+	items = append(items, marker("======="))
+	if t != nil {
+		items = append(items, CloneContents(t))
+	}
+	items = append(items, marker(">>>>>>> "+m.Theirs))
+	return
+}
+
+// records a conflict over one field of an element, returning its marker (which gives each side's version of the field)
+func (m *merger) fieldConflict(b, o, t *XMLElement, reason, ours, theirs string) *XMLComment {
+	m.record(b, o, t, reason)
+	return marker(fmt.Sprintf("<<<<<<< %s %s ======= %s >>>>>>> %s", m.Ours, ours, theirs, m.Theirs))
+}
+
+func (m *merger) record(b, o, t *XMLElement, reason string) {
+	c := &MergeConflict{Reason: reason, Base: b, Ours: o, Theirs: t}
+	if o != nil {
+		c.Path = o.Path()
+	} else {
+		c.Path = t.Path()
+	}
+	m.result.Conflicts = append(m.result.Conflicts, c)
+}
+
+// a conflict marker comment (with anything a comment can't hold broken up)
+func marker(s string) *XMLComment {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	return &XMLComment{Comment: xml.Comment(" " + s + " ")}
+}
+
+// true if x and y are the same (as far as the options care)
+func (m *merger) same(x, y any) bool {
+	return Diff(&XMLTree{Elements: XMLValue{contents: x}}, &XMLTree{Elements: XMLValue{contents: y}}, m.DiffOptions).Empty()
+}
+
+// true if the elements have the same contents (as far as the options care)
+func (m *merger) sameContents(x, y *XMLElement) bool {
+	xt, xText := mergeText(x)
+	yt, yText := mergeText(y)
+	if xText || yText {
+		return xText && yText && m.equal(xt, yt)
+	}
+	return Diff(&XMLTree{Elements: XMLValue{contents: x.contents}}, &XMLTree{Elements: XMLValue{contents: y.contents}}, m.DiffOptions).Empty()
+}
+
+// our text (see diffText), where an element base doesn't have is empty
+func mergeText(e *XMLElement) (text string, ok bool) {
+	if e == nil {
+		return "", true
+	}
+	return diffText(e)
+}
+
+// the named attribute (nil if e is, or doesn't have it)
+func mergeAttr(e *XMLElement, name string) *xml.Attr {
+	if e == nil {
+		return nil
+	}
+	if i := e.AttributeIndex(name); i != -1 {
+		return &e.Attr[i]
+	}
+	return nil
+}
+
+// true if the keys both have are in the same order in each
+func sameOrder(x, y []string) bool {
+	common := func(keys, other []string) (in []string) {
+		set := map[string]bool{}
+		for _, k := range other {
+			set[k] = true
+		}
+		for _, k := range keys {
+			if set[k] {
+				in = append(in, k)
+			}
+		}
+		return
+	}
+	return slices.Equal(common(x, y), common(y, x))
+}
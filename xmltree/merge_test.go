@@ -0,0 +1,145 @@
+package xmltree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var mergeKeys = MergeOptions{DiffOptions: diffKeys}
+
+func TestMergeClean(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		opts               MergeOptions
+		want               string
+	}{
+		{"unchanged", `<a><x>1</x></a>`, `<a><x>1</x></a>`, `<a><x>1</x></a>`, MergeOptions{},
+			`<a><x>1</x></a>`},
+		{"different elements", `<a><x>1</x><y>1</y></a>`, `<a><x>2</x><y>1</y></a>`, `<a><x>1</x><y>3</y></a>`, MergeOptions{},
+			`<a><x>2</x><y>3</y></a>`},
+		{"same change", `<a><x>1</x></a>`, `<a><x>2</x></a>`, `<a><x>2</x></a>`, MergeOptions{},
+			`<a><x>2</x></a>`},
+		{"different attributes", `<a p="1" q="1" />`, `<a p="2" q="1" />`, `<a p="1" q="3" r="4" />`, MergeOptions{},
+			`<a p="2" q="3" r="4" />`},
+		{"attribute removed", `<a p="1" q="1" />`, `<a q="1" />`, `<a p="1" q="2" />`, MergeOptions{},
+			`<a q="2" />`},
+		{"inserts on both sides", `<Items><Item><Name>A</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>C</Name></Item><Item><Name>A</Name></Item></Items>`, mergeKeys,
+			`<Items><Item><Name>C</Name></Item><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`},
+		{"unchanged deleted", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name></Item></Items>`, mergeKeys,
+			`<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`},
+		{"deleted on both sides", `<a><x /><y /></a>`, `<a><y /></a>`, `<a><y /></a>`, MergeOptions{},
+			`<a><y /></a>`},
+		{"only theirs reordered", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>B</Name></Item><Item><Name>A</Name></Item></Items>`, mergeKeys,
+			`<Items><Item><Name>B</Name></Item><Item><Name>A</Name><Cost>1</Cost></Item></Items>`},
+		{"comments", `<a><!--one--><x /></a>`, `<a><x /><!--two--></a>`, `<a><!--one--><x /></a>`, MergeOptions{},
+			`<a><x /><!--two--></a>`},
+		{"tolerance", `<a><x>1</x></a>`, `<a><x>1.0001</x></a>`, `<a><x>2</x></a>`, MergeOptions{DiffOptions: DiffOptions{Tolerance: 0.001}},
+			`<a><x>2</x></a>`},
+	}
+	for _, tt := range tests {
+		result := Merge3(readTree(t, tt.base), readTree(t, tt.ours), readTree(t, tt.theirs), tt.opts)
+		if err := result.Err(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := result.Tree.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeSharesNothing(t *testing.T) {
+	base, ours, theirs := readTree(t, `<a><x>1</x></a>`), readTree(t, `<a><x>2</x></a>`), readTree(t, `<a><x>1</x><y /></a>`)
+	result := Merge3(base, ours, theirs, MergeOptions{})
+	result.Tree.Elements.Elements()[0].Elements()[0].SetValue("changed")
+	if got := ours.String(); got != `<a><x>2</x></a>` {
+		t.Errorf("editing the merge changed ours: %s", got)
+	}
+}
+
+func TestMergeValueConflict(t *testing.T) {
+	base, ours, theirs := readTree(t, `<a><x>1</x></a>`), readTree(t, `<a><x>2</x></a>`), readTree(t, `<a><x>3</x></a>`)
+	result := Merge3(base, ours, theirs, MergeOptions{Ours: "mine", Theirs: "yours"})
+	if len(result.Conflicts) != 1 || !errors.Is(result.Err(), ErrMergeConflict) {
+		t.Fatalf("got %v", result.Err())
+	}
+	c := result.Conflicts[0]
+	if c.Path != "a/x" || c.Reason != "value changed in both" || c.Base == nil || c.Ours == nil || c.Theirs == nil {
+		t.Errorf("got %+v", c)
+	}
+	want := `<a><!-- <<<<<<< mine "2" ======= "3" >>>>>>> yours --><x>2</x></a>`
+	if got := result.Tree.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestMergeDeleteModifyConflicts(t *testing.T) {
+	base := `<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`
+	changed := `<Items><Item><Name>A</Name><Cost>2</Cost></Item></Items>`
+	deleted := `<Items />`
+	tests := []struct {
+		name         string
+		ours, theirs string
+		reason       string
+		want         string
+	}{
+		{"ours deleted", deleted, changed, "deleted in ours but changed in theirs",
+			`<Items><!-- <<<<<<< ours --><!-- ======= --><Item><Name>A</Name><Cost>2</Cost></Item><!-- >>>>>>> theirs --></Items>`},
+		{"theirs deleted", changed, deleted, "changed in ours but deleted in theirs",
+			`<Items><!-- <<<<<<< ours --><Item><Name>A</Name><Cost>2</Cost></Item><!-- ======= --><!-- >>>>>>> theirs --></Items>`},
+	}
+	for _, tt := range tests {
+		result := Merge3(readTree(t, base), readTree(t, tt.ours), readTree(t, tt.theirs), mergeKeys)
+		if len(result.Conflicts) != 1 {
+			t.Errorf("%s: got %v", tt.name, result.Err())
+			continue
+		}
+		c := result.Conflicts[0]
+		if c.Reason != tt.reason || c.Path != "Items/Item" || c.Base == nil || (c.Ours == nil) == (c.Theirs == nil) {
+			t.Errorf("%s: got %+v", tt.name, c)
+		}
+		if got := result.Tree.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeContentsConflict(t *testing.T) {
+	base, ours, theirs := readTree(t, `<a><x>1</x></a>`), readTree(t, `<a><x><y /></x></a>`), readTree(t, `<a><x><z /></x></a>`)
+	result := Merge3(base, ours, theirs, MergeOptions{})
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Reason != "contents changed in both" {
+		t.Fatalf("got %v", result.Err())
+	}
+	want := `<a><!-- <<<<<<< ours --><x><y /></x><!-- ======= --><x><z /></x><!-- >>>>>>> theirs --></a>`
+	if got := result.Tree.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestMergeConflictOnRootKeepsOneRoot(t *testing.T) {
+	base, ours, theirs := readTree(t, `<I v="1"><A>1</A><B>1</B></I>`), readTree(t, `<I v="2"><A>1</A><B>1</B></I>`), readTree(t, `<I v="3"><A>1</A><B>2</B></I>`)
+
+	result := Merge3(base, ours, theirs, MergeOptions{})
+	if len(result.Conflicts) != 1 || !errors.Is(result.Err(), ErrMergeConflict) {
+		t.Fatalf("got %v, want the one conflict over v", result.Err())
+	}
+
+	// the conflict is marked on the attribute, so the rest merges as usual
+	merged := result.Tree.String()
+	for _, want := range []string{`<!-- <<<<<<< ours @v="2" ======= @v="3" >>>>>>> theirs -->`, `<I v="2">`, `<B>2</B>`} {
+		if !strings.Contains(merged, want) {
+			t.Errorf("got %q, want it to contain %q", merged, want)
+		}
+	}
+	if strings.Count(merged, "<I") != 1 {
+		t.Errorf("got %q, want a single root", merged)
+	}
+	readTree(t, merged)
+}
@@ -0,0 +1,202 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// parent pointers and sibling navigation
+// every value knows which element owns it (nil at the top level of a tree), and every element knows its parent
+// Append, InsertAt, RemoveSpan, Reorder, Truncate, SetContents and decoding all keep these up to date
+// warn: elements made with a struct literal (rather than MakeElement, Clone or decoding) don't know to maintain
+// their children's parents until you call RelinkParents on them (or on the tree that contains them)
+
+var ErrNoParent = errors.New("element has no parent")
+
+// we become the parent of any elements in items
+// (at the top level of a tree, they join any transaction we're recording, and take on the tree's number formatting)
+func (v *XMLValue) adopt(items ...any) {
+	for _, item := range items {
+		if e, ok := item.(*XMLElement); ok {
+			e.parent = v.owner
+			if v.owner == nil {
+				e.journal = v.journal
+				e.numbers = v.numbers
+			}
+		}
+	}
+}
+
+// any elements in items which still think we're their parent are orphaned
+// (they stay in any transaction we're recording, so that rolling back restores them as they were, but leave the tree's number formatting)
+func (v *XMLValue) disown(items ...any) {
+	var tx *Transaction
+	if len(items) != 0 {
+		tx = v.transaction()
+	}
+	for _, item := range items {
+		if e, ok := item.(*XMLElement); ok && e.parent == v.owner {
+			e.parent = nil
+			e.journal = tx
+			e.numbers = nil
+		}
+	}
+}
+
+// swaps out our contents wholesale (orphaning our old children and adopting the new ones)
+func (v *XMLValue) replaceContents(contents any) {
+	v.record()
+	switch t := v.contents.(type) {
+	case *XMLElement:
+		v.disown(t)
+	case []any:
+		v.disown(t...)
+	}
+
+	v.contents = contents
+
+	switch t := contents.(type) {
+	case *XMLElement:
+		v.adopt(t)
+	case []any:
+		v.adopt(t...)
+	}
+
+	v.touch()
+}
+
+// we own our value, and so are the parent of our children
+func (e *XMLElement) own() {
+	e.owner = e
+	e.eachElement(func(c *XMLElement) bool {
+		c.parent = e
+		return true
+	})
+}
+
+// rebuilds every parent pointer in the tree (only needed if you've assembled elements by hand)
+func (tree *XMLTree) RelinkParents() {
+	tree.Elements.owner = nil
+	tree.Elements.eachElement(func(e *XMLElement) bool {
+		e.parent = nil
+		e.RelinkParents()
+		return true
+	})
+}
+
+// rebuilds the parent pointers of all of our descendants (only needed if you've assembled elements by hand)
+func (e *XMLElement) RelinkParents() {
+	e.own()
+	e.eachElement(func(c *XMLElement) bool {
+		c.RelinkParents()
+		return true
+	})
+}
+
+// the element which contains us (nil if we're at the top level of a tree or aren't in one)
+func (e *XMLElement) Parent() *XMLElement {
+	return e.parent
+}
+
+// our topmost ancestor (which is us if we have no parent)
+func (e *XMLElement) Root() (root *XMLElement) {
+	for root = e; root.parent != nil; root = root.parent {
+	}
+	return
+}
+
+// our index in our parent's contents (the same index ChildIndex would give, so usable with InsertAt, RemoveSpan, etc.)
+// returns -1 if we have no parent
+func (e *XMLElement) Index() int {
+	if e.parent == nil {
+		return -1
+	}
+	switch t := e.parent.contents.(type) {
+	case *XMLElement:
+		if t == e {
+			return 0
+		}
+	case []any:
+		for i, c := range t {
+			if c == any(e) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// the element which follows us in our parent (comments etc. are skipped), or nil if we're the last one
+func (e *XMLElement) NextSibling() *XMLElement {
+	index := e.Index()
+	if index == -1 {
+		return nil
+	}
+	if t, ok := e.parent.contents.([]any); ok {
+		for _, c := range t[index+1:] {
+			if sibling, ok := c.(*XMLElement); ok {
+				return sibling
+			}
+		}
+	}
+	return nil
+}
+
+// the element which precedes us in our parent (comments etc. are skipped), or nil if we're the first one
+func (e *XMLElement) PrevSibling() *XMLElement {
+	index := e.Index()
+	if index == -1 {
+		return nil
+	}
+	if t, ok := e.parent.contents.([]any); ok {
+		for i := index - 1; i >= 0; i-- {
+			if sibling, ok := t[i].(*XMLElement); ok {
+				return sibling
+			}
+		}
+	}
+	return nil
+}
+
+// our index in our parent, ensuring that our parent's contents are a []any so they can be edited
+func (e *XMLElement) editableIndex() (index int, err error) {
+	index = e.Index()
+	if index == -1 {
+		err = fmt.Errorf("%s: %w", e.Name.Local, ErrNoParent)
+		return
+	}
+	if parent := e.parent; parent.contents == any(e) {
+		// subtle: this is an edit like any other, so a transaction must see it (to undo it along with whatever follows)
+		parent.replaceContents([]any{e})
+	}
+	return
+}
+
+// inserts sibling into our parent immediately before us
+// WARN! we'll use the element you hand us, if you need to copy it, use e.Clone() when calling us!
+func (e *XMLElement) InsertBefore(sibling *XMLElement) (err error) {
+	index, err := e.editableIndex()
+	if err != nil {
+		return
+	}
+	return e.parent.InsertAt(index, sibling)
+}
+
+// inserts sibling into our parent immediately after us
+// WARN! we'll use the element you hand us, if you need to copy it, use e.Clone() when calling us!
+func (e *XMLElement) InsertAfter(sibling *XMLElement) (err error) {
+	index, err := e.editableIndex()
+	if err != nil {
+		return
+	}
+	return e.parent.InsertAt(index+1, sibling)
+}
+
+// removes us from our parent (afterwards we have no parent, but are otherwise intact)
+func (e *XMLElement) Remove() (err error) {
+	index, err := e.editableIndex()
+	if err != nil {
+		return
+	}
+	return e.parent.RemoveSpan(index, 1)
+}
@@ -0,0 +1,134 @@
+package xmltree
+
+import (
+	"errors"
+	"testing"
+)
+
+// fails the test unless every element's parent is the element that holds it
+func checkParents(t *testing.T, tree *XMLTree) {
+	t.Helper()
+	for parent, e := range tree.All() {
+		if e.Parent() != parent {
+			t.Errorf("%s: parent is %v, want %v", e.Path(), e.Parent(), parent)
+		}
+		if parent != nil && e.Root() != tree.Elements.Elements()[0] {
+			t.Errorf("%s: wrong root %s", e.Path(), e.Root().Name.Local)
+		}
+	}
+}
+
+func TestParentsAfterDecode(t *testing.T) {
+	tree := readTree(t, `<a><b><c /></b><!-- x --><d /></a>`)
+	checkParents(t, tree)
+
+	a := tree.Elements.Elements()[0]
+	b, d := a.Child("b"), a.Child("d")
+	if b.Index() != a.ChildIndex("b") || d.Index() != a.ChildIndex("d") || d.Index() != 2 {
+		t.Errorf("Index: got %d and %d", b.Index(), d.Index())
+	}
+	if a.Index() != -1 || a.Parent() != nil || a.Root() != a {
+		t.Errorf("root: index %d, parent %v", a.Index(), a.Parent())
+	}
+
+	// siblings skip comments
+	if b.NextSibling() != d || d.PrevSibling() != b || b.PrevSibling() != nil || d.NextSibling() != nil {
+		t.Errorf("siblings: %v %v %v %v", b.NextSibling(), d.PrevSibling(), b.PrevSibling(), d.NextSibling())
+	}
+	if c := b.Child("c"); c.NextSibling() != nil || c.PrevSibling() != nil || c.Index() != 0 {
+		t.Errorf("lone child: %v %v %d", c.NextSibling(), c.PrevSibling(), c.Index())
+	}
+}
+
+func TestParentsFollowEdits(t *testing.T) {
+	tree := readTree(t, `<a><b /><c /><d /><e /></a>`)
+	a := tree.Elements.Elements()[0]
+	b, c, e := a.Child("b"), a.Child("c"), a.Child("e")
+
+	f := MakeElement("f")
+	g := MakeElement("g")
+	steps := []struct {
+		name string
+		edit func() error
+	}{
+		{"Append", func() error { return a.Append(f) }},
+		{"InsertAt", func() error { return a.InsertAt(0, g) }},
+		{"Reorder", func() error { return a.Reorder(0, 3) }},
+		{"RemoveSpan", func() error { return a.RemoveSpan(a.ChildIndex("b"), 1) }},
+		{"Truncate", func() error { return a.Truncate(3) }},
+	}
+	for _, step := range steps {
+		if err := step.edit(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		checkParents(t, tree)
+	}
+
+	if got := tree.String(); got != "<a><c /><d /><g /></a>" {
+		t.Errorf("got %q", got)
+	}
+	for _, removed := range []*XMLElement{b, e, f} {
+		if removed.Parent() != nil {
+			t.Errorf("%s still has a parent", removed.Name.Local)
+		}
+	}
+	if c.Parent() != a || g.Parent() != a {
+		t.Errorf("kept elements lost their parent")
+	}
+}
+
+func TestInsertBesideAndRemove(t *testing.T) {
+	tree := readTree(t, `<a><b><c /></b></a>`)
+	b := tree.Elements.Elements()[0].Child("b")
+	c := b.Child("c")
+
+	err := c.InsertBefore(MakeElement("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.InsertAfter(MakeElement("y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkParents(t, tree)
+	if got := tree.String(); got != "<a><b><x /><y /></b></a>" {
+		t.Errorf("got %q", got)
+	}
+
+	if err := c.Remove(); !errors.Is(err, ErrNoParent) {
+		t.Errorf("removing a removed element: got %v, want %v", err, ErrNoParent)
+	}
+}
+
+func TestRemoveLoneChildUndoes(t *testing.T) {
+	tree := readTree(t, `<a><b><c /></b></a>`)
+	c := tree.Elements.Elements()[0].Child("b").Child("c")
+	want := tree.String()
+
+	tx, err := tree.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	checkParents(t, tree)
+
+	// the parent's contents are back to a lone element (not a list holding it)
+	if b := tree.Elements.Elements()[0].Child("b"); b.contents != any(c) {
+		t.Errorf("contents are %T", b.contents)
+	}
+}
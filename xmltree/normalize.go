@@ -0,0 +1,145 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// deterministic output, so that the same data always encodes to the same bytes regardless of which tool wrote it
+// normalizing already normalized output changes nothing (so this is safe to use as a git clean filter)
+
+type Normalization struct {
+	SortAttributes     bool                // sort attributes alphabetically (after any that are listed in AttributeOrder)
+	AttributeOrder     map[string][]string // per-tag attribute order: listed attributes come first, in this order
+	CollapseWhitespace bool                // trim simple values and collapse internal runs of whitespace to a single space
+	NormalizeNumbers   []string            // fields whose numbers are rewritten in canonical form (e.g. 01.50 -> 1.5): Tag for a value, Tag/@attr for an attribute (Tag may be *)
+	StripTrailingSpace bool                // never end a line with indentation (text and comments are left as they are)
+}
+
+// note: normalizing numbers changes values as text (1.10 -> 1.1, 007 -> 7), which is why it is limited to the fields listed
+// don't list fields which merely look numeric (versions, ids, codes and the like)
+
+// the usual choice for version control
+func DefaultNormalization() *Normalization {
+	return &Normalization{
+		SortAttributes:     true,
+		CollapseWhitespace: true,
+		StripTrailingSpace: true,
+	}
+}
+
+// encoders which support normalization implement this
+type NormalizingEncoder interface {
+	Normalization() *Normalization
+}
+
+// returns the normalization for the given encoder (nil if none)
+func normalizationOf(encoder any) *Normalization {
+	if n, ok := encoder.(NormalizingEncoder); ok {
+		return n.Normalization()
+	}
+	return nil
+}
+
+// returns the attributes of the given element in the order they should be written
+// note: the element itself is never modified
+func (n *Normalization) OrderAttributes(tag string, attrs []xml.Attr) []xml.Attr {
+
+	if n == nil || len(attrs) < 2 || (!n.SortAttributes && len(n.AttributeOrder[tag]) == 0) {
+		return attrs
+	}
+
+	order := n.AttributeOrder[tag]
+	rank := func(a xml.Attr) int {
+		i := slices.Index(order, qualifiedName(a.Name.Space, a.Name.Local))
+		if i == -1 {
+			return len(order)
+		}
+		return i
+	}
+
+	sorted := slices.Clone(attrs)
+	slices.SortStableFunc(sorted, func(a, b xml.Attr) int {
+		ra, rb := rank(a), rank(b)
+		if ra != rb || !n.SortAttributes {
+			return ra - rb
+		}
+		return strings.Compare(qualifiedName(a.Name.Space, a.Name.Local), qualifiedName(b.Name.Space, b.Name.Local))
+	})
+	return sorted
+}
+
+// returns the normalized form of the given tag's simple value
+func (n *Normalization) Text(tag, s string) string {
+	if n == nil {
+		return s
+	}
+	if n.CollapseWhitespace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	if n.numeric(tag, "") {
+		s = CanonicalNumber(s)
+	}
+	return s
+}
+
+// returns the normalized form of the given tag's attribute value
+func (n *Normalization) AttrValue(tag, name, s string) string {
+	if n == nil || !n.numeric(tag, name) {
+		return s
+	}
+	return CanonicalNumber(s)
+}
+
+// true if the given field (attr is empty for the value) is listed in NormalizeNumbers
+func (n *Normalization) numeric(tag, attr string) bool {
+	field := func(tag string) string {
+		if attr == "" {
+			return tag
+		}
+		return tag + "/@" + attr
+	}
+	return slices.Contains(n.NormalizeNumbers, field(tag)) || slices.Contains(n.NormalizeNumbers, field("*"))
+}
+
+// only plain decimal notation is considered numeric (so names such as "Inf" or "0x10" are left alone)
+var decimalNumber = regexp.MustCompile(`^\s*[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?\s*$`)
+
+// returns the canonical form of s if it is a decimal number, otherwise returns s unchanged
+// integers are written without sign or leading zeros, and other values in the shortest form that parses back to the same float64
+func CanonicalNumber(s string) string {
+
+	if !decimalNumber.MatchString(s) {
+		return s
+	}
+	t := strings.TrimSpace(s)
+
+	// integers are kept exact (even beyond float64 precision)
+	if !strings.ContainsAny(t, ".eE") {
+		negative := strings.HasPrefix(t, "-")
+		t = strings.TrimLeft(strings.TrimLeft(t, "+-"), "0")
+		switch {
+		case t == "":
+			return "0"
+		case negative:
+			return "-" + t
+		}
+		return t
+	}
+
+	f, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return s
+	}
+	return shortestNumber(f)
+}
+
+// writes the simple value of the given tag, applying the encoder's normalization and number formatting (if any)
+func encodeText(tag, s string, encoder FormattedEncoder) error {
+	s = normalizationOf(encoder).Text(tag, s)
+	s = numberFormatterOf(encoder).Reformat(tag, s)
+	return WriteEscapedText(s, encoder, false)
+}
@@ -0,0 +1,99 @@
+package xmltree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripTrailingSpaceOnlyStripsIndentation(t *testing.T) {
+	tree := readTree(t, "<a><!-- hello \nworld  \n--><b>x  \ny  </b><c /></a>")
+	// an element holding no children still gets its (empty) line of indentation
+	tree.Elements.Elements()[0].Child("c").SetContents([]any{})
+
+	encode := func(normalize *Normalization) string {
+		sb := &strings.Builder{}
+		encoder := NewEncoder(sb)
+		encoder.Configure("", "\t")
+		encoder.ConfigureNormalization(normalize)
+		err := tree.Encode(encoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sb.String()
+	}
+
+	plain := encode(nil)
+	if want := "<a>\n\t<!-- hello \nworld  \n-->\n\t<b>x  \ny  </b>\n\t<c>\n\t\t\n\t</c>\n</a>\n"; plain != want {
+		t.Errorf("plain: got %q, want %q", plain, want)
+	}
+	stripped := encode(&Normalization{StripTrailingSpace: true})
+	if want := "<a>\n\t<!-- hello \nworld  \n-->\n\t<b>x  \ny  </b>\n\t<c>\n\n\t</c>\n</a>\n"; stripped != want {
+		t.Errorf("stripped: got %q, want %q", stripped, want)
+	}
+}
+
+func TestStripTrailingSpaceKeepsVisiblePrefix(t *testing.T) {
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	encoder.Configure("# ", "  ")
+	encoder.ConfigureNormalization(&Normalization{StripTrailingSpace: true})
+	for _, err := range []error{
+		encoder.Indent(false, 1, true),
+		encoder.Indent(true, 0, true),
+		func() error { _, err := encoder.WriteString("x"); return err }(),
+		encoder.Indent(true, 0, true),
+		encoder.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := sb.String(), "#\n#   x\n#"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeIsIdempotent(t *testing.T) {
+	normalize := DefaultNormalization()
+	normalize.NormalizeNumbers = []string{"Cost"}
+	encode := func(s string) string {
+		sb := &strings.Builder{}
+		encoder := NewEncoder(sb)
+		encoder.Configure("", "\t")
+		encoder.ConfigureNormalization(normalize)
+		err := readTree(t, s).Encode(encoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sb.String()
+	}
+
+	once := encode(`<a z="1" b="2"><Cost>  01.50 </Cost><Name> two   words </Name></a>`)
+	if want := "<a b=\"2\" z=\"1\">\n\t<Cost>1.5</Cost>\n\t<Name>two words</Name>\n</a>\n"; once != want {
+		t.Errorf("got %q, want %q", once, want)
+	}
+	if twice := encode(once); twice != once {
+		t.Errorf("normalizing again: got %q, want %q", twice, once)
+	}
+}
+
+func TestNormalizeNumbersOnlyListedFields(t *testing.T) {
+	n := &Normalization{NormalizeNumbers: []string{"Cost", "Item/@weight"}}
+	tests := []struct{ tag, attr, in, want string }{
+		{"Cost", "", "01.50", "1.5"},
+		{"Version", "", "1.10", "1.10"},
+		{"Id", "", "007", "007"},
+		{"Item", "weight", "2.0", "2"},
+		{"Item", "version", "1.10", "1.10"},
+		{"Other", "weight", "2.0", "2.0"},
+	}
+	for _, test := range tests {
+		got := n.Text(test.tag, test.in)
+		if test.attr != "" {
+			got = n.AttrValue(test.tag, test.attr, test.in)
+		}
+		if got != test.want {
+			t.Errorf("%s/@%s %q: got %q, want %q", test.tag, test.attr, test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package xmltree
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lucky-wolf/xml-tree/format"
+)
+
+// number formatting policy
+// every numeric writer (SetValue, ScaleBy, AdjustValue, SetAttribute and the helpers built on them) formats floats through
+// their tree's policy (see XMLTree.SetNumberFormatter), and an encoder can reformat what it writes (see ConfigureNumberFormatter)
+// integers are always written exactly, and are never reformatted
+
+type NumberStyle int
+
+const (
+	NumberDefault     NumberStyle = iota // no style of its own: writers use the shortest form, encoders leave values as they are
+	NumberEngineering                    // natural decimal for "human" sized values, engineering notation for large/small ones (e.g. 1.23457e+06)
+	NumberPlain                          // decimal without an exponent (only the fractional digits are rounded)
+	NumberShortest                       // the shortest form which parses back to the exact same float64
+)
+
+type NumberFormatter struct {
+	Style       NumberStyle
+	Significant int                         // significant digits (ignored by NumberShortest, 6 if not given)
+	Tags        map[string]*NumberFormatter // per-tag overrides for simple values (e.g. Percent -> plain with 3 digits)
+	Attrs       map[string]*NumberFormatter // per-name overrides for attribute values
+}
+
+// what a nil formatter (or a tree without one) uses: the shortest form, which never loses digits (so 1234567 stays 1234567)
+var noNumberFormatter = &NumberFormatter{}
+
+// returns the formatter to use for the values of the given tag
+func (f *NumberFormatter) For(tag string) *NumberFormatter {
+	if f == nil {
+		return noNumberFormatter
+	}
+	if o := f.Tags[tag]; o != nil {
+		return o
+	}
+	return f
+}
+
+// returns the formatter to use for the values of the named attribute
+func (f *NumberFormatter) ForAttr(name string) *NumberFormatter {
+	if f == nil {
+		return noNumberFormatter
+	}
+	if o := f.Attrs[name]; o != nil {
+		return o
+	}
+	return f
+}
+
+// formats the value for the given tag (tag may be empty)
+func (f *NumberFormatter) Format(tag string, value float64) string {
+	return f.For(tag).format(value)
+}
+
+// formats the value for the named attribute
+func (f *NumberFormatter) FormatAttr(name string, value float64) string {
+	return f.ForAttr(name).format(value)
+}
+
+// formats the value using our own style (ignoring our overrides)
+func (f *NumberFormatter) format(value float64) string {
+
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	significant := f.Significant
+	if significant <= 0 {
+		significant = 6
+	}
+
+	switch f.Style {
+	case NumberPlain:
+		return format.Mantissa(value, significant)
+	case NumberEngineering:
+		return format.Natural(value, significant)
+	default:
+		return shortestNumber(value)
+	}
+}
+
+// rewrites s using the given tag's formatter iff that has a style of its own and s is a non-integer decimal number
+// note: a formatter without a base style (NumberDefault) rewrites only the tags it overrides, as not every value
+// which looks like a decimal is a number (e.g. a version of 1.10)
+func (f *NumberFormatter) Reformat(tag, s string) string {
+	if f == nil {
+		return s
+	}
+	return f.For(tag).reformat(s)
+}
+
+// rewrites s using the named attribute's formatter (see Reformat)
+func (f *NumberFormatter) ReformatAttr(name, s string) string {
+	if f == nil {
+		return s
+	}
+	return f.ForAttr(name).reformat(s)
+}
+
+func (f *NumberFormatter) reformat(s string) string {
+	if f.Style == NumberDefault || !decimalNumber.MatchString(s) || !strings.ContainsAny(s, ".eE") {
+		return s
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return s
+	}
+	return f.format(value)
+}
+
+// sets the number formatting every numeric writer uses on this tree (nil restores the default: the shortest exact form)
+// note: this governs writing values into the tree, encoding leaves them as they are unless the encoder is configured too
+func (tree *XMLTree) SetNumberFormatter(f *NumberFormatter) {
+	tree.Elements.numbers = f
+	tree.Elements.eachElement(func(e *XMLElement) bool {
+		e.numbers = f
+		return true
+	})
+}
+
+// the tree's number formatting (nil if it uses the default)
+func (tree *XMLTree) NumberFormatter() *NumberFormatter {
+	return tree.Elements.numbers
+}
+
+// the formatter for our value (tag defaults to our element's name)
+func (v *XMLValue) numberFormatter(tag string) *NumberFormatter {
+	f := v.numbers
+	if v.owner != nil {
+		f = v.owner.Root().numbers
+		if tag == "" {
+			tag = v.owner.Name.Local
+		}
+	}
+	return f.For(tag)
+}
+
+// the formatter for the named attribute of ours
+func (e *XMLElement) attrNumberFormatter(name string) *NumberFormatter {
+	return e.Root().numbers.ForAttr(name)
+}
+
+// shortest decimal which parses back to the same float64 (exponent only for extreme magnitudes)
+func shortestNumber(value float64) string {
+	if value == 0 {
+		return "0"
+	}
+	if abs := math.Abs(value); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'e', -1, 64)
+}
+
+// encoders which reformat numbers on output implement this
+type NumberFormattingEncoder interface {
+	NumberFormatter() *NumberFormatter
+}
+
+// returns the number formatter for the given encoder (nil if none)
+func numberFormatterOf(encoder any) *NumberFormatter {
+	if n, ok := encoder.(NumberFormattingEncoder); ok {
+		return n.NumberFormatter()
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package xmltree
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNumberStyles(t *testing.T) {
+	tenth := 0.1
+	tests := []struct {
+		f     *NumberFormatter
+		value float64
+		want  string
+	}{
+		{nil, 1234567, "1234567"},
+		{nil, tenth + 0.2, "0.30000000000000004"},
+		{nil, 1e-9, "1e-09"},
+		{&NumberFormatter{}, 2.5, "2.5"},
+		{&NumberFormatter{Style: NumberShortest, Significant: 2}, 1234.5678, "1234.5678"},
+		{&NumberFormatter{Style: NumberEngineering}, 1234567, "1.23457e+06"},
+		{&NumberFormatter{Style: NumberEngineering, Significant: 3}, 3.14159, "3.14"},
+		{&NumberFormatter{Style: NumberPlain, Significant: 3}, 1234.5678, "1235"},
+		{&NumberFormatter{Style: NumberPlain, Significant: 3}, 1234567, "1234567"},
+		{nil, math.Inf(1), "+Inf"},
+	}
+	for _, test := range tests {
+		if got := test.f.Format("", test.value); got != test.want {
+			t.Errorf("%+v %v: got %q, want %q", test.f, test.value, got, test.want)
+		}
+	}
+}
+
+func TestNumberOverrides(t *testing.T) {
+	f := &NumberFormatter{
+		Style:       NumberPlain,
+		Significant: 2,
+		Tags:        map[string]*NumberFormatter{"Percent": {Style: NumberShortest}},
+		Attrs:       map[string]*NumberFormatter{"scale": {Style: NumberEngineering, Significant: 3}},
+	}
+	tests := []struct {
+		got, want string
+	}{
+		{f.Format("Cost", 1.2345), "1.2"},
+		{f.Format("Percent", 1.2345), "1.2345"},
+		{f.Format("scale", 1.2345), "1.2"},
+		{f.FormatAttr("scale", 1234567), "1.23e+06"},
+		// attributes don't share the tags' overrides
+		{f.FormatAttr("Percent", 1.2345), "1.2"},
+	}
+	for i, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%d: got %q, want %q", i, test.got, test.want)
+		}
+	}
+}
+
+func TestNumericWritersKeepDigits(t *testing.T) {
+	v := &XMLValue{}
+	v.SetValue(1234567.0)
+	if got := v.StringValue(); got != "1234567" {
+		t.Errorf("SetValue: got %q, want %q", got, "1234567")
+	}
+	v.ScaleBy(1.5)
+	if got := v.StringValue(); got != "1851850.5" {
+		t.Errorf("ScaleBy: got %q, want %q", got, "1851850.5")
+	}
+}
+
+func TestTreeNumberFormatter(t *testing.T) {
+	tree := readTree(t, `<a><Cost>1</Cost><Percent>1</Percent><Item weight="1" /></a>`)
+	other := readTree(t, `<a><Cost>1</Cost></a>`)
+	tree.SetNumberFormatter(&NumberFormatter{
+		Style:       NumberEngineering,
+		Significant: 3,
+		Tags:        map[string]*NumberFormatter{"Percent": {Style: NumberPlain, Significant: 1}},
+		Attrs:       map[string]*NumberFormatter{"weight": {Style: NumberPlain, Significant: 2}},
+	})
+
+	a := tree.Elements.Elements()[0]
+	a.Child("Cost").SetValue(3.14159)
+	a.Child("Percent").SetValue(0.25)
+	a.Child("Item").SetAttribute("weight", 2.0/3)
+	a.Child("Item").SetAttribute("scale", 2.0/3)
+	other.Elements.Elements()[0].Child("Cost").SetValue(3.14159)
+
+	want := `<a><Cost>3.14</Cost><Percent>0.3</Percent><Item weight="0.67" scale="0.667" /></a>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := other.String(); got != `<a><Cost>3.14159</Cost></a>` {
+		t.Errorf("another tree: got %q", got)
+	}
+
+	// the arithmetic helpers format the same way (a value uses its element's name for the per-tag overrides)
+	cost := a.Child("Cost")
+	cost.ScaleBy(2)
+	if got := cost.StringValue(); got != "6.28" {
+		t.Errorf("ScaleBy: got %q", got)
+	}
+	percent := a.Child("Percent")
+	percent.XMLValue.AdjustValue(0.125)
+	if got := percent.StringValue(); got != "0.4" {
+		t.Errorf("AdjustValue: got %q", got)
+	}
+
+	// an element removed from the tree is no longer the tree's to format
+	a.RemoveSpan(0, 1)
+	cost.SetValue(3.14159)
+	if got := cost.StringValue(); got != "3.14159" {
+		t.Errorf("removed: got %q", got)
+	}
+
+	// a new root takes on the tree's formatting
+	tree.Elements.SetContents(MakeElement("Cost"))
+	tree.Elements.Elements()[0].SetValue(3.14159)
+	if got := tree.String(); got != "<Cost>3.14</Cost>" {
+		t.Errorf("new root: got %q", got)
+	}
+}
+
+func TestReformat(t *testing.T) {
+	tree := readTree(t, `<a scale="0.123456" version="1.10"><Version>1.10</Version><Percent>0.123456</Percent><Count>10</Count></a>`)
+	encode := func(f *NumberFormatter) string {
+		sb := &strings.Builder{}
+		encoder := NewEncoder(sb)
+		encoder.ConfigureCompact()
+		encoder.ConfigureNumberFormatter(f)
+		err := tree.Encode(encoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		f    *NumberFormatter
+		want string
+	}{
+		{nil, `<a scale="0.123456" version="1.10"><Version>1.10</Version><Percent>0.123456</Percent><Count>10</Count></a>`},
+		// without a base style, only the overrides apply (and attributes have their own)
+		{&NumberFormatter{
+			Tags:  map[string]*NumberFormatter{"Percent": {Style: NumberPlain, Significant: 3}},
+			Attrs: map[string]*NumberFormatter{"scale": {Style: NumberPlain, Significant: 2}},
+		}, `<a scale="0.12" version="1.10"><Version>1.10</Version><Percent>0.123</Percent><Count>10</Count></a>`},
+		// a base style applies to everything (but integers)
+		{&NumberFormatter{Style: NumberShortest}, `<a scale="0.123456" version="1.1"><Version>1.1</Version><Percent>0.123456</Percent><Count>10</Count></a>`},
+		{&NumberFormatter{Style: NumberEngineering, Significant: 2}, `<a scale="0.12" version="1.1"><Version>1.1</Version><Percent>0.12</Percent><Count>10</Count></a>`},
+	}
+	for i, test := range tests {
+		if got := encode(test.f); got != test.want {
+			t.Errorf("%d: got %q, want %q", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package xmltree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// overlay conflicts: which elements and fields (values and attributes) more than one overlay touches
+// each overlay is applied to the base on its own, to see what it proposes, and then all of them in load order, to see what wins
+// a field is proposed by an overlay which sets it, or which adds, replaces or deletes an element holding it
+// note: overlays which change different fields of one element don't conflict (that's what field-level merging is for)
+
+// an overlay, and how it's known in reports
+type Overlay struct {
+	Name string
+	Tree *XMLTree
+}
+
+// what one overlay wants for a field (or element)
+type OverlayProposal struct {
+	Overlay  string
+	Action   OverlayAction
+	Value    string   // the value it proposes (for a field it sets, adds or replaces)
+	Position Position // the overlay's element which proposes it
+}
+
+func (p OverlayProposal) String() string {
+	if p.Action == OverlayDeleted || p.Value == "" {
+		return fmt.Sprintf("%s: %s", p.Overlay, p.Action)
+	}
+	return fmt.Sprintf("%s: %s %q", p.Overlay, p.Action, p.Value)
+}
+
+// true if the proposals are for the same thing (however they'd get there)
+func (p OverlayProposal) agrees(other OverlayProposal) bool {
+	deleted := p.Action == OverlayDeleted
+	return deleted == (other.Action == OverlayDeleted) && p.Value == other.Value
+}
+
+// an element or field which more than one overlay touches
+type OverlayConflict struct {
+	Path      string // the element's path in the merged tree (or in base, or the overlay which added it, if it didn't survive)
+	Attr      string // the attribute (for an attribute)
+	Element   bool   // true for the element as a whole (added, replaced or deleted), rather than its value
+	Proposals []OverlayProposal
+	Winner    string // the overlay whose proposal stands (the last to load)
+	Value     string // the merged value
+	Deleted   bool   // true if it isn't in the merged tree
+	Agreed    bool   // true if every overlay proposes the same thing
+}
+
+func (c *OverlayConflict) String() string {
+	where := c.Path
+	if c.Attr != "" {
+		where += "/@" + c.Attr
+	}
+	outcome := fmt.Sprintf("%q", c.Value)
+	switch {
+	case c.Deleted:
+		outcome = "deleted"
+	case c.Element:
+		outcome = "kept"
+	}
+	s := fmt.Sprintf("%s: %s wins (%s)", where, c.Winner, outcome)
+	if c.Agreed {
+		s += ", all agree"
+	}
+	return s
+}
+
+type OverlayConflictReport struct {
+	Conflicts []*OverlayConflict
+	Tree      *XMLTree // the merged tree
+}
+
+// the conflicts where the overlays don't all agree
+func (r *OverlayConflictReport) Disagreements() (conflicts []*OverlayConflict) {
+	for _, c := range r.Conflicts {
+		if !c.Agreed {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return
+}
+
+// a report of the conflicts, each with its proposals (indented) in load order
+func (r *OverlayConflictReport) String() string {
+	sb := &strings.Builder{}
+	for _, c := range r.Conflicts {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+		for _, p := range c.Proposals {
+			sb.WriteString("\t")
+			sb.WriteString(p.String())
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// the report as json
+func (r *OverlayConflictReport) WriteJSON(w io.Writer) (err error) {
+	type proposal struct {
+		Overlay string `json:"overlay"`
+		Action  string `json:"action"`
+		Value   string `json:"value,omitempty"`
+		Line    int    `json:"line,omitempty"`
+	}
+	type conflict struct {
+		Path      string     `json:"path"`
+		Attr      string     `json:"attr,omitempty"`
+		Element   bool       `json:"element,omitempty"`
+		Winner    string     `json:"winner"`
+		Value     string     `json:"value"`
+		Deleted   bool       `json:"deleted,omitempty"`
+		Agreed    bool       `json:"agreed"`
+		Proposals []proposal `json:"proposals"`
+	}
+	out := []conflict{}
+	for _, c := range r.Conflicts {
+		j := conflict{c.Path, c.Attr, c.Element, c.Winner, c.Value, c.Deleted, c.Agreed, nil}
+		for _, p := range c.Proposals {
+			j.Proposals = append(j.Proposals, proposal{p.Overlay, p.Action.String(), p.Value, p.Position.Line})
+		}
+		out = append(out, j)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// an element (by its key path, see OverlayMerger.ids), or one of its fields
+type overlayField struct {
+	id      string
+	attr    string
+	element bool
+}
+
+type overlayAnalysis struct {
+	order     []overlayField
+	proposals map[overlayField][]OverlayProposal
+	paths     map[overlayField]string // where each was first proposed (in case it's in neither the merged tree nor base)
+}
+
+// finds every element and field which more than one of the overlays touch (overlays are in load order)
+func AnalyzeOverlays(base *XMLTree, overlays []Overlay, opts OverlayOptions) (report *OverlayConflictReport, err error) {
+	a := &overlayAnalysis{proposals: map[overlayField][]OverlayProposal{}, paths: map[overlayField]string{}}
+	for _, o := range overlays {
+		err = a.propose(base, o, opts)
+		if err != nil {
+			return
+		}
+	}
+
+	// subtle: we need base's paths before the merge detaches whatever it deletes
+	merged := NewOverlayMerger(base, opts)
+	paths := map[string]string{}
+	for e, id := range merged.ids() {
+		paths[id] = e.Path()
+	}
+	for _, o := range overlays {
+		err = merged.Apply(o.Name, o.Tree)
+		if err != nil {
+			return
+		}
+	}
+	finals := invertIDs(merged.ids())
+
+	report = &OverlayConflictReport{Tree: merged.Tree()}
+	for _, f := range a.order {
+		proposals := a.proposals[f]
+		if len(proposals) < 2 {
+			continue
+		}
+		c := &OverlayConflict{Attr: f.attr, Element: f.element, Proposals: proposals, Agreed: true}
+		c.Winner = proposals[len(proposals)-1].Overlay
+		for _, p := range proposals[1:] {
+			if !p.agrees(proposals[0]) {
+				c.Agreed = false
+			}
+		}
+
+		e := finals[f.id]
+		switch {
+		case e == nil:
+			c.Deleted = true
+		case f.attr != "":
+			c.Value, c.Deleted = e.Attribute(f.attr)
+			c.Deleted = !c.Deleted
+		case !f.element:
+			c.Value, _ = diffText(e)
+		}
+		switch {
+		case e != nil:
+			c.Path = e.Path()
+		case paths[f.id] != "":
+			c.Path = paths[f.id]
+		default:
+			c.Path = a.paths[f]
+		}
+		report.Conflicts = append(report.Conflicts, c)
+	}
+	return
+}
+
+// applies an overlay to the base on its own, noting everything it proposes
+func (a *overlayAnalysis) propose(base *XMLTree, o Overlay, opts OverlayOptions) (err error) {
+	m := NewOverlayMerger(base, opts)
+	before := m.ids()
+	err = m.Apply(o.Name, o.Tree)
+	if err != nil {
+		return
+	}
+	after := m.ids()
+	// base's elements are known by where they were in base, even if the overlay moved their siblings
+	id := func(e *XMLElement) string {
+		if s, ok := before[e]; ok {
+			return s
+		}
+		return after[e]
+	}
+
+	add := func(f overlayField, p OverlayProposal, path string) {
+		proposals := a.proposals[f]
+		if n := len(proposals); n != 0 && proposals[n-1].Overlay == o.Name {
+			// the overlay's last word on it is what it proposes
+			proposals[n-1] = p
+			return
+		}
+		if len(proposals) == 0 {
+			a.order = append(a.order, f)
+			a.paths[f] = path
+		}
+		a.proposals[f] = append(proposals, p)
+	}
+
+	for _, t := range m.log {
+		e, touch := t.target.element, t.touch
+		p := OverlayProposal{Overlay: o.Name, Action: touch.Action, Position: touch.Position}
+		if touch.Action == OverlaySet {
+			p.Value = touch.Value
+			add(overlayField{id: id(e), attr: touch.Attr}, p, touch.Path)
+			continue
+		}
+
+		// an element as a whole: it proposes (or deletes) everything it holds
+		add(overlayField{id: id(e), element: true}, p, touch.Path)
+		fields := func(d *XMLElement, path string) {
+			if text, ok := diffText(d); ok {
+				if touch.Action != OverlayDeleted {
+					p.Value = text
+				}
+				add(overlayField{id: id(d)}, p, path)
+			}
+			for _, attr := range d.Attr {
+				if touch.Action != OverlayDeleted {
+					p.Value = attr.Value
+				}
+				add(overlayField{id: id(d), attr: attr.Name.Local}, p, path)
+			}
+		}
+		fields(e, touch.Path)
+		eachDFS(e, &e.XMLValue, func(_, d *XMLElement) bool {
+			// subtle: a deleted element is detached, so its descendants' paths are relative to it
+			fields(d, touch.Path+strings.TrimPrefix(d.Path(), e.Path()))
+			return true
+		})
+	}
+	return
+}
+
+// a key path for every element in our tree: the keys (see DiffOptions.keys) of it and each of its ancestors
+// unlike paths, these stay the same however an overlay adds to or deletes from a keyed element's siblings
+func (m *OverlayMerger) ids() (ids map[*XMLElement]string) {
+	ids = map[*XMLElement]string{}
+	var walk func(prefix string, v *XMLValue)
+	walk = func(prefix string, v *XMLValue) {
+		elements := v.Elements()
+		for i, key := range m.keys.keys(elements) {
+			id := prefix + "/" + key
+			ids[elements[i]] = id
+			walk(id, &elements[i].XMLValue)
+		}
+	}
+	walk("", &m.tree.Elements)
+	return
+}
+
+func invertIDs(ids map[*XMLElement]string) map[string]*XMLElement {
+	elements := make(map[string]*XMLElement, len(ids))
+	for e, id := range ids {
+		elements[id] = e
+	}
+	return elements
+}
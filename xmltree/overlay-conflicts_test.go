@@ -0,0 +1,123 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// analyzes the overlays (named a, b, c... in load order) against base
+func analyzeOverlays(t *testing.T, base string, overlays ...string) *OverlayConflictReport {
+	t.Helper()
+	var list []Overlay
+	for i, o := range overlays {
+		list = append(list, Overlay{Name: string(rune('a' + i)), Tree: readTree(t, o)})
+	}
+	report, err := AnalyzeOverlays(readTree(t, base), list, overlayKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestOverlayConflicts(t *testing.T) {
+	report := analyzeOverlays(t,
+		`<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name><Cost>2</Cost></Item><Item><Name>D</Name><Cost>4</Cost></Item></Items>`,
+		`<Items><Item><Name>A</Name><Cost>5</Cost></Item><Item rare="no"><Name>B</Name><Cost>3</Cost></Item><Item><Name>D</Name><Cost>8</Cost></Item></Items>`,
+		`<Items><Item><Name>A</Name><Cost>6</Cost><Weight>1</Weight></Item><Item rare="yes"><Name>B</Name><Cost>3</Cost></Item><Item merge="delete"><Name>D</Name></Item></Items>`,
+	)
+
+	// A's weight is only b's, and D as a whole and its name are only deleted by b, so none of them conflict
+	want := []OverlayConflict{
+		{Path: "Items/Item[1]/Cost", Winner: "b", Value: "6"},
+		{Path: "Items/Item[2]", Attr: "rare", Winner: "b", Value: "yes"},
+		{Path: "Items/Item[2]/Cost", Winner: "b", Value: "3", Agreed: true},
+		{Path: "Items/Item[3]/Cost", Winner: "b", Deleted: true}, // where it was in base
+	}
+	if len(report.Conflicts) != len(want) {
+		t.Fatalf("got\n%s", report)
+	}
+	for i, w := range want {
+		c := report.Conflicts[i]
+		if c.Path != w.Path || c.Attr != w.Attr || c.Element || c.Winner != w.Winner || c.Value != w.Value || c.Deleted != w.Deleted || c.Agreed != w.Agreed {
+			t.Errorf("got %+v, want %+v", c, w)
+		}
+		if len(c.Proposals) != 2 || c.Proposals[0].Overlay != "a" || c.Proposals[1].Overlay != "b" {
+			t.Errorf("%s: got proposals %v", c, c.Proposals)
+		}
+	}
+	if d := report.Disagreements(); len(d) != 3 || d[2] != report.Conflicts[3] {
+		t.Errorf("got disagreements %v", d)
+	}
+
+	wantReport := `Items/Item[1]/Cost: b wins ("6")
+	a: set "5"
+	b: set "6"
+Items/Item[2]/@rare: b wins ("yes")
+	a: set "no"
+	b: set "yes"
+Items/Item[2]/Cost: b wins ("3"), all agree
+	a: set "3"
+	b: set "3"
+Items/Item[3]/Cost: b wins (deleted)
+	a: set "8"
+	b: deleted
+`
+	if got := report.String(); got != wantReport {
+		t.Errorf("got\n%s\nwant\n%s", got, wantReport)
+	}
+}
+
+func TestOverlayConflictsOverElements(t *testing.T) {
+	base := `<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`
+	tests := []struct {
+		name     string
+		overlays []string
+		want     string
+	}{
+		{"added alike", []string{`<Items><Item><Name>C</Name></Item></Items>`, `<Items><Item><Name>C</Name></Item></Items>`},
+			"Items/Item[2]: b wins (kept), all agree\nItems/Item[2]/Name: b wins (\"C\"), all agree\n"},
+		{"replaced then set", []string{`<Items><Item merge="replace"><Name>A</Name><Cost>2</Cost></Item></Items>`, `<Items><Item><Name>A</Name><Cost>3</Cost></Item></Items>`},
+			"Items/Item/Cost: b wins (\"3\")\n"},
+		{"set then deleted", []string{`<Items><Item><Name>A</Name><Cost>2</Cost></Item></Items>`, `<Items><Item merge="delete"><Name>A</Name></Item></Items>`},
+			"Items/Item/Cost: b wins (deleted)\n"},
+		{"deleted alike", []string{`<Items><Item merge="delete"><Name>A</Name></Item></Items>`, `<Items><Item merge="delete"><Name>A</Name></Item></Items>`},
+			"Items/Item: b wins (deleted), all agree\nItems/Item/Name: b wins (deleted), all agree\nItems/Item/Cost: b wins (deleted), all agree\n"},
+		{"different fields", []string{`<Items><Item><Name>A</Name><Cost>2</Cost></Item></Items>`, `<Items><Item id="1"><Name>A</Name></Item></Items>`},
+			""},
+	}
+	for _, tt := range tests {
+		report := analyzeOverlays(t, base, tt.overlays...)
+		var got bytes.Buffer
+		for _, c := range report.Conflicts {
+			got.WriteString(c.String() + "\n")
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tt.name, got.String(), tt.want)
+		}
+	}
+}
+
+func TestOverlayConflictsJSON(t *testing.T) {
+	report := analyzeOverlays(t, `<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`,
+		`<Items><Item><Name>A</Name><Cost>2</Cost></Item></Items>`,
+		"<Items>\n<Item merge=\"delete\"><Name>A</Name></Item></Items>")
+	var buf bytes.Buffer
+	err := report.WriteJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	err = json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0]["path"] != "Items/Item/Cost" || got[0]["winner"] != "b" || got[0]["deleted"] != true || got[0]["agreed"] != false {
+		t.Fatalf("got %s", buf.String())
+	}
+	proposals := got[0]["proposals"].([]any)
+	last := proposals[1].(map[string]any)
+	if len(proposals) != 2 || last["overlay"] != "b" || last["action"] != "deleted" || last["value"] != nil || last["line"] != 2.0 {
+		t.Errorf("got %s", buf.String())
+	}
+}
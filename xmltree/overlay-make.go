@@ -0,0 +1,259 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// making overlays: the reverse of merging one, i.e. the smallest overlay which turns base into modified
+// the overlay holds only the elements which changed, and of those only the fields which changed (plus whatever they need to
+// find their match: their key, or for unkeyed elements, empty placeholders for their unchanged same-tag siblings before them)
+// what field-level merging can't express (a removed attribute, a cleared value) replaces the element wholesale
+// note: overlays can't reorder elements (an added one goes after its last same-tag sibling), so changes of order are left out
+// note: comments are carried only inside added or replaced elements
+
+type MakeOverlayOptions struct {
+	OverlayOptions
+	StrictOrder bool // fail if modified changed the order of elements (rather than leaving that out of the overlay)
+}
+
+type overlayMaker struct {
+	opts    MakeOverlayOptions
+	keys    DiffOptions
+	replace map[*XMLElement]bool // modified's elements which we replace wholesale
+}
+
+// the smallest overlay which turns base into modified (see OverlayMerger)
+func MakeOverlay(base, modified *XMLTree, opts MakeOverlayOptions) (overlay *XMLTree, err error) {
+	if opts.Directive == "" {
+		opts.Directive = "merge"
+	}
+	if !IsValidName(opts.Directive) {
+		err = notWellFormed("invalid directive attribute name %q", opts.Directive)
+		return
+	}
+	mk := &overlayMaker{opts: opts, keys: DiffOptions{Keys: opts.Keys}, replace: map[*XMLElement]bool{}}
+	for {
+		overlay = &XMLTree{}
+		overlay.Elements.SetContents(mk.level(&base.Elements, &modified.Elements))
+
+		// we check our work by merging it: wherever the result isn't modified, we replace the element wholesale and try again
+		m := NewOverlayMerger(base, opts.OverlayOptions)
+		err = m.Apply("overlay", overlay)
+		if err != nil {
+			return
+		}
+		d := Diff(m.Tree(), modified, DiffOptions{Keys: opts.Keys, IgnoreComments: true})
+		if !mk.replaceWhatDiffers(d) {
+			for _, c := range d.Changes {
+				switch {
+				case c.Kind != DiffMoved:
+					err = fmt.Errorf("cannot express the changes as an overlay: %s", c)
+					return
+				case opts.StrictOrder:
+					err = fmt.Errorf("cannot express a change of order as an overlay: %s", c)
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// marks the elements of modified which hold each difference for replacing (false if they all already are)
+func (mk *overlayMaker) replaceWhatDiffers(d *TreeDiff) (progress bool) {
+	counterparts := map[*XMLElement]*XMLElement{}
+	for b, a := range d.matches {
+		counterparts[a] = b
+	}
+	for _, c := range d.Changes {
+		var e *XMLElement
+		switch c.Kind {
+		case DiffMoved:
+			// replacing the parent would put everything in order, but at the cost of the whole overlay
+			continue
+		case DiffInserted:
+			// an element's siblings are its parent's to get right
+			e = c.B.parent
+		case DiffDeleted:
+			if c.A != nil && c.A.parent != nil {
+				e = counterparts[c.A.parent]
+			}
+		default:
+			e = c.B
+		}
+		if e != nil && !mk.replace[e] {
+			mk.replace[e] = true
+			progress = true
+		}
+	}
+	return
+}
+
+// the overlay's items for the children of modified's mv (bv is base's counterpart, nil if it has none)
+func (mk *overlayMaker) level(bv, mv *XMLValue) (items []any) {
+	bases, mods := bv.Elements(), mv.Elements()
+	byKey := map[string]*XMLElement{}
+	for i, key := range mk.keys.keys(bases) {
+		byKey[key] = bases[i]
+	}
+	modKeys := map[string]bool{}
+
+	// unkeyed elements find their match by position among their same-tag siblings, so we pad with placeholders
+	emitted := map[string]int{} // how many unkeyed elements of each tag we've put in the overlay
+	emit := func(e *XMLElement, position int) {
+		tag := e.Name.Local
+		for ; position != 0 && emitted[tag] < position-1; emitted[tag]++ {
+			items = append(items, newElement(xml.StartElement{Name: e.Name}, Position{}))
+		}
+		if position != 0 {
+			emitted[tag] = position
+		}
+		items = append(items, e)
+	}
+
+	positions := map[string]int{}
+	for i, key := range mk.keys.keys(mods) {
+		me := mods[i]
+		modKeys[key] = true
+		position := 0
+		if mk.unkeyed(me) {
+			positions[me.Name.Local]++
+			position = positions[me.Name.Local]
+		}
+
+		be := byKey[key]
+		switch {
+		case be == nil:
+			emit(me.Clone(), position)
+		default:
+			if oe := mk.element(be, me); oe != nil {
+				emit(oe, position)
+			}
+		}
+	}
+
+	// deletions
+	positions = map[string]int{}
+	for i, key := range mk.keys.keys(bases) {
+		be := bases[i]
+		position := 0
+		if mk.unkeyed(be) {
+			positions[be.Name.Local]++
+			position = positions[be.Name.Local]
+		}
+		if !modKeys[key] {
+			marker := newElement(xml.StartElement{Name: be.Name}, Position{})
+			marker.SetAttribute(mk.opts.Directive, "delete")
+			emit(mk.identify(marker, be), position)
+		}
+	}
+	return
+}
+
+// true if the element matches by position (rather than by key)
+func (mk *overlayMaker) unkeyed(e *XMLElement) bool {
+	f := mk.keys.keyFunc(e.Name.Local)
+	if f == nil {
+		return true
+	}
+	_, ok := f(e)
+	return !ok
+}
+
+// the overlay for a matched pair (nil if they're the same)
+func (mk *overlayMaker) element(be, me *XMLElement) (oe *XMLElement) {
+	if mk.replace[me] {
+		return mk.replaced(me)
+	}
+
+	oe = newElement(xml.StartElement{Name: me.Name}, Position{})
+	for _, attr := range me.Attr {
+		if value, ok := be.Attribute(attr.Name.Local); !ok || value != attr.Value {
+			oe.Attr = append(oe.Attr, attr)
+		}
+	}
+	for _, attr := range be.Attr {
+		if !me.HasAttribute(attr.Name.Local) {
+			// overlays can't remove attributes
+			return mk.replaced(me)
+		}
+	}
+
+	bt, bText := diffText(be)
+	mt, mText := diffText(me)
+	switch {
+	case mText && bText && bt == mt:
+	case mText && strings.TrimSpace(mt) == "":
+		// nor can they clear a value (an empty overlay element changes nothing)
+		return mk.replaced(me)
+	case mText:
+		oe.replaceContents(mt)
+	case bText && strings.TrimSpace(bt) != "":
+		// from text to children
+		oe.replaceContents(me.CloneContents())
+	default:
+		if items := mk.level(&be.XMLValue, &me.XMLValue); len(items) != 0 {
+			oe.replaceContents(items)
+		}
+	}
+
+	if len(oe.Attr) == 0 && oe.contents == nil {
+		return nil
+	}
+	return mk.identify(oe, me)
+}
+
+// a copy of the element which replaces its match wholesale
+func (mk *overlayMaker) replaced(me *XMLElement) (oe *XMLElement) {
+	oe = me.Clone()
+	oe.SetAttribute(mk.opts.Directive, "replace")
+	return
+}
+
+// gives the overlay's element (oe) whatever it needs of e's attributes and children to have e's key (and so find its match)
+func (mk *overlayMaker) identify(oe, e *XMLElement) *XMLElement {
+	if mk.unkeyed(e) {
+		return oe
+	}
+	f := mk.keys.keyFunc(e.Name.Local)
+	want, _ := f(e)
+	identified := func() bool {
+		key, ok := f(oe)
+		return ok && key == want
+	}
+	if identified() {
+		return oe
+	}
+
+	for _, attr := range e.Attr {
+		if oe.HasAttribute(attr.Name.Local) {
+			continue
+		}
+		oe.Attr = append(oe.Attr, attr)
+		if identified() {
+			return oe
+		}
+		oe.Attr = oe.Attr[:len(oe.Attr)-1]
+	}
+	if _, isText := oe.contents.(string); !isText {
+		for _, c := range e.Elements() {
+			clone := c.Clone()
+			oe.insertItems(0, clone)
+			if identified() {
+				return oe
+			}
+			oe.removeItem(clone)
+		}
+	}
+
+	// we can't tell what the key is made of, so we fall back on all of it
+	directive, _ := oe.Attribute(mk.opts.Directive)
+	if directive == "delete" {
+		oe = e.Clone()
+		oe.SetAttribute(mk.opts.Directive, "delete")
+		return oe
+	}
+	return mk.replaced(e)
+}
@@ -0,0 +1,114 @@
+package xmltree
+
+import "testing"
+
+var makeKeys = MakeOverlayOptions{OverlayOptions: overlayKeys}
+
+func TestMakeOverlay(t *testing.T) {
+	byValue := MakeOverlayOptions{OverlayOptions: OverlayOptions{Keys: map[string]KeyFunc{"Tag": KeyByValue}}}
+	tests := []struct {
+		name           string
+		base, modified string
+		opts           MakeOverlayOptions
+		want           string
+	}{
+		{"unchanged", `<Items><Item><Name>A</Name></Item></Items>`, `<Items><Item><Name>A</Name></Item></Items>`, makeKeys,
+			``},
+		{"changed field", `<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Weight>2</Weight></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>3</Cost><Weight>2</Weight></Item></Items>`, makeKeys,
+			`<Items><Item><Name>A</Name><Cost>3</Cost></Item></Items>`},
+		{"changed attribute", `<Items><Item id="1"><Name>A</Name></Item></Items>`, `<Items><Item id="2"><Name>A</Name></Item></Items>`, makeKeys,
+			`<Items><Item id="2"><Name>A</Name></Item></Items>`},
+		{"added", `<Items><Item><Name>A</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name></Item><Item><Name>B</Name><Cost>1</Cost></Item></Items>`, makeKeys,
+			`<Items><Item><Name>B</Name><Cost>1</Cost></Item></Items>`},
+		{"text to children", `<a><x>1</x></a>`, `<a><x><y>2</y></x></a>`, MakeOverlayOptions{},
+			`<a><x><y>2</y></x></a>`},
+
+		// deletion markers carry just enough to find their match
+		{"keyed deletion", `<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name></Item></Items>`,
+			`<Items><Item><Name>B</Name></Item></Items>`, makeKeys,
+			`<Items><Item merge="delete"><Name>A</Name></Item></Items>`},
+		{"attribute keyed deletion", `<Items><Item id="1" /><Item id="2" /></Items>`, `<Items><Item id="2" /></Items>`,
+			MakeOverlayOptions{OverlayOptions: OverlayOptions{Keys: map[string]KeyFunc{"Item": KeyByAttr("id")}}},
+			`<Items><Item merge="delete" id="1" /></Items>`},
+		{"value keyed deletion", `<Tags><Tag>x</Tag><Tag>y</Tag></Tags>`, `<Tags><Tag>x</Tag></Tags>`, byValue,
+			`<Tags><Tag merge="delete">y</Tag></Tags>`},
+		{"unkeyed deletion", `<a><x>1</x><x>2</x><x>3</x></a>`, `<a><x>1</x></a>`, MakeOverlayOptions{},
+			`<a><x /><x merge="delete" /><x merge="delete" /></a>`},
+		{"custom directive", `<Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items>`, `<Items><Item><Name>B</Name></Item></Items>`,
+			MakeOverlayOptions{OverlayOptions: OverlayOptions{Keys: overlayKeys.Keys, Directive: "mod"}},
+			`<Items><Item mod="delete"><Name>A</Name></Item></Items>`},
+
+		// unkeyed elements find their match by position, so the unchanged ones before them leave placeholders
+		{"unkeyed placeholders", `<a><x>1</x><y>1</y><x>2</x><x>3</x></a>`, `<a><x>1</x><y>1</y><x>2</x><x>4</x></a>`, MakeOverlayOptions{},
+			`<a><x /><x /><x>4</x></a>`},
+		{"unkeyed among keyed", `<Items><Item><Name>A</Name></Item><Item /><Item><Cost>1</Cost></Item></Items>`,
+			`<Items><Item><Name>A</Name></Item><Item /><Item><Cost>2</Cost></Item></Items>`, makeKeys,
+			`<Items><Item /><Item><Cost>2</Cost></Item></Items>`},
+		{"unkeyed added", `<a><x>1</x></a>`, `<a><x>1</x><x>2</x></a>`, MakeOverlayOptions{},
+			`<a><x /><x>2</x></a>`},
+
+		// what field-level merging can't express is replaced wholesale
+		{"removed attribute", `<Items><Item id="1" rare="yes"><Name>A</Name></Item></Items>`, `<Items><Item id="1"><Name>A</Name></Item></Items>`, makeKeys,
+			`<Items><Item id="1" merge="replace"><Name>A</Name></Item></Items>`},
+		{"cleared value", `<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`, `<Items><Item><Name>A</Name><Cost /></Item></Items>`, makeKeys,
+			`<Items><Item><Name>A</Name><Cost merge="replace" /></Item></Items>`},
+		{"children to text", `<a><x><y>2</y></x></a>`, `<a><x>1</x></a>`, MakeOverlayOptions{},
+			`<a><x>1</x></a>`},
+		{"emptied", `<a><x><y>2</y></x></a>`, `<a><x /></a>`, MakeOverlayOptions{},
+			`<a><x merge="replace" /></a>`},
+	}
+	for _, tt := range tests {
+		base, modified := readTree(t, tt.base), readTree(t, tt.modified)
+		overlay, err := MakeOverlay(base, modified, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := overlay.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+
+		// and the overlay does turn base into modified
+		m := NewOverlayMerger(base, tt.opts.OverlayOptions)
+		err = m.Apply("overlay", overlay)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if d := Diff(m.Tree(), modified, DiffOptions{Keys: tt.opts.Keys}); !d.Empty() {
+			t.Errorf("%s: merging the overlay gives %s, want %s", tt.name, m.Tree(), modified)
+		}
+	}
+}
+
+func TestMakeOverlayInvalidDirective(t *testing.T) {
+	tree := readTree(t, `<a />`)
+	_, err := MakeOverlay(tree, tree, MakeOverlayOptions{OverlayOptions: OverlayOptions{Directive: "not valid"}})
+	if err == nil {
+		t.Error("expected an error for the directive")
+	}
+}
+
+func TestMakeOverlayLeavesOutOrder(t *testing.T) {
+	base := readTree(t, "<Items><Item><Name>A</Name><C>1</C></Item><Item><Name>B</Name><C>2</C></Item></Items>")
+	modified := readTree(t, "<Items><Item><Name>B</Name><C>2</C></Item><Item><Name>A</Name><C>3</C></Item></Items>")
+	opts := makeKeys
+
+	// the swap can't be expressed, so only A's change is in the overlay
+	overlay, err := MakeOverlay(base, modified, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readTree(t, "<Items><Item><Name>A</Name><C>3</C></Item></Items>")
+	if d := Diff(overlay, want, DiffOptions{}); !d.Empty() {
+		t.Errorf("got %s, want %s", overlay, want)
+	}
+
+	opts.StrictOrder = true
+	_, err = MakeOverlay(base, modified, opts)
+	if err == nil {
+		t.Error("expected an error for the change of order")
+	}
+}
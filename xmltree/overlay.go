@@ -0,0 +1,394 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// overlays: partial documents which change a base tree, applied in load order (as mods are)
+// an overlay holds only what it changes: each of its elements finds the base element it changes by key (e.g. an <Item> by
+// its <Name>) or by position among its same-tag siblings, and changes only the fields (children and attributes) it holds
+//   <Items><Item><Name>Sword</Name><Damage>12</Damage></Item></Items>
+// a directive attribute (merge="..." by default) changes how an element applies:
+//   merge="replace"  replaces the matching element wholesale (or adds it, if there's no match)
+//   merge="delete"   deletes the matching element (if any)
+//   merge="append"   appends its children to the matching element's (e.g. to add to a list of unkeyed entries)
+//   merge="remove"   removes the matching element's children which match its children (by key, or else by value)
+// the merger remembers which overlay touched each value, and when (see Origin, History and Touches)
+
+var ErrOverlayInvalid = errors.New("invalid overlay")
+
+type OverlayOptions struct {
+	Keys      map[string]KeyFunc // how an overlay's elements with a given tag find the base elements they change ("*" for any other tag); unkeyed elements match by position among their same-tag siblings
+	Directive string             // the attribute holding merge directives (default "merge")
+}
+
+type OverlayAction int
+
+const (
+	OverlaySet      OverlayAction = iota // a value or attribute was set
+	OverlayAdded                         // an element was added
+	OverlayReplaced                      // an element (or its contents) was replaced wholesale
+	OverlayDeleted                       // an element was deleted
+)
+
+func (a OverlayAction) String() string {
+	switch a {
+	case OverlaySet:
+		return "set"
+	case OverlayAdded:
+		return "added"
+	case OverlayReplaced:
+		return "replaced"
+	case OverlayDeleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("OverlayAction(%d)", int(a))
+}
+
+// one overlay's change to an element (or to its value, or one of its attributes)
+type OverlayTouch struct {
+	Overlay  string
+	Action   OverlayAction
+	Path     string   // the element's path (see At)
+	Attr     string   // the attribute (for an attribute)
+	Value    string   // the value set (for OverlaySet)
+	Position Position // the overlay's element which did it
+}
+
+func (t OverlayTouch) String() string {
+	where := t.Path
+	if t.Attr != "" {
+		where += "/@" + t.Attr
+	}
+	if t.Action == OverlaySet {
+		return fmt.Sprintf("%s: %q (%s)", where, t.Value, t.Overlay)
+	}
+	return fmt.Sprintf("%s: %s by %s", where, t.Action, t.Overlay)
+}
+
+type OverlayMerger struct {
+	opts    OverlayOptions
+	keys    DiffOptions // how we match elements (see DiffOptions.keys)
+	tree    *XMLTree
+	history map[overlayTarget][]OverlayTouch
+	deleted []OverlayTouch
+	log     []overlayPending // every touch, in order
+
+	// while applying an overlay
+	name    string
+	pending []overlayPending
+}
+
+// what a touch was to: an element's value (attr is "") or one of its attributes
+type overlayTarget struct {
+	element *XMLElement
+	attr    string
+}
+
+type overlayPending struct {
+	target overlayTarget
+	touch  OverlayTouch
+}
+
+// a merger which applies overlays to a copy of base
+func NewOverlayMerger(base *XMLTree, opts OverlayOptions) (m *OverlayMerger) {
+	if opts.Directive == "" {
+		opts.Directive = "merge"
+	}
+	m = &OverlayMerger{
+		opts:    opts,
+		keys:    DiffOptions{Keys: opts.Keys},
+		tree:    &XMLTree{Elements: base.Elements.Clone()},
+		history: map[overlayTarget][]OverlayTouch{},
+	}
+	m.tree.RelinkParents()
+	return
+}
+
+// the merged tree (base with every overlay applied so far)
+func (m *OverlayMerger) Tree() *XMLTree {
+	return m.tree
+}
+
+// applies the overlay (name is how touches are attributed to it)
+// an overlay applies entirely or not at all
+func (m *OverlayMerger) Apply(name string, overlay *XMLTree) (err error) {
+	m.name, m.pending = name, nil
+	run := func() error {
+		return m.level(&m.tree.Elements, &overlay.Elements)
+	}
+
+	if tx := m.tree.Transaction(); tx != nil {
+		err = tx.Do("overlay "+name, run)
+	} else {
+		tx, _ = m.tree.Begin()
+		err = run()
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+
+	for _, p := range m.pending {
+		if p.touch.Action == OverlayDeleted {
+			m.deleted = append(m.deleted, p.touch)
+		} else {
+			m.history[p.target] = append(m.history[p.target], p.touch)
+		}
+	}
+	m.log = append(m.log, m.pending...)
+	m.pending = nil
+	return
+}
+
+// loads and applies an overlay (attributed to its filename)
+func (m *OverlayMerger) ApplyFile(filename string) (err error) {
+	overlay, err := LoadFromFile(filename)
+	if err != nil {
+		return
+	}
+	return m.Apply(filename, overlay)
+}
+
+// applies the overlay's elements in ov to the base's in bv
+func (m *OverlayMerger) level(bv, ov *XMLValue) (err error) {
+	overlays := ov.Elements()
+	if len(overlays) == 0 {
+		return
+	}
+
+	// subtle: we match against the base as it was before this level's edits (so an overlay's new elements never match its later ones)
+	bases := bv.Elements()
+	byKey := map[string]*XMLElement{}
+	for i, key := range m.keys.keys(bases) {
+		byKey[key] = bases[i]
+	}
+	for i, key := range m.keys.keys(overlays) {
+		err = m.element(bv, byKey[key], overlays[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// applies an overlay's element (oe) to its match (be, nil if it has none) among the children of bv
+func (m *OverlayMerger) element(bv *XMLValue, be, oe *XMLElement) (err error) {
+	directive, _ := oe.Attribute(m.opts.Directive)
+	switch directive {
+	case "delete":
+		if be != nil {
+			m.touch(be, OverlayTouch{Action: OverlayDeleted}, oe)
+			err = bv.removeItem(be)
+		}
+		return
+	case "replace":
+		if be == nil {
+			return m.add(bv, oe)
+		}
+		e := m.copyOf(oe)
+		err = bv.replaceItem(be, e)
+		if err == nil {
+			m.touch(e, OverlayTouch{Action: OverlayReplaced}, oe)
+		}
+		return
+	case "", "append", "remove":
+	default:
+		err = fmt.Errorf("%s: %s: unknown merge directive %q: %w", oe.Position(), oe.Name.Local, directive, ErrOverlayInvalid)
+		return
+	}
+
+	if be == nil {
+		if directive == "remove" {
+			// there's nothing to remove from
+			return
+		}
+		return m.add(bv, oe)
+	}
+
+	// fields: attributes...
+	for _, attr := range oe.Attr {
+		name := attr.Name.Local
+		if name == m.opts.Directive {
+			continue
+		}
+		if value, ok := be.Attribute(name); ok && value == attr.Value {
+			continue
+		}
+		be.SetAttribute(name, attr.Value)
+		m.touch(be, OverlayTouch{Action: OverlaySet, Attr: name, Value: attr.Value}, oe)
+	}
+
+	switch directive {
+	case "append":
+		for _, c := range oe.Elements() {
+			err = m.add(&be.XMLValue, c)
+			if err != nil {
+				return
+			}
+		}
+		return
+	case "remove":
+		return m.remove(be, oe)
+	}
+
+	// ...and contents (an overlay element which holds nothing changes only attributes)
+	text, isText := diffText(oe)
+	current, wasText := diffText(be)
+	switch {
+	case isText && strings.TrimSpace(text) == "":
+	case isText && wasText:
+		if text != current {
+			be.SetString(text)
+			m.touch(be, OverlayTouch{Action: OverlaySet, Value: text}, oe)
+		}
+	case isText || wasText && strings.TrimSpace(current) != "":
+		// between text and children: the contents as a whole are replaced
+		be.replaceContents(m.copyOf(oe).contents)
+		m.touch(be, OverlayTouch{Action: OverlayReplaced}, oe)
+	default:
+		err = m.level(&be.XMLValue, &oe.XMLValue)
+	}
+	return
+}
+
+// adds a copy of an overlay's element to bv (after any siblings with the same tag, so new entries join their list)
+func (m *OverlayMerger) add(bv *XMLValue, oe *XMLElement) (err error) {
+	items, err := bv.items()
+	if err != nil {
+		err = fmt.Errorf("%s: cannot add %s to a value: %w", oe.Position(), oe.Name.Local, ErrOverlayInvalid)
+		return
+	}
+	index := len(items)
+	for i, item := range items {
+		if e, ok := item.(*XMLElement); ok && e.Name.Local == oe.Name.Local {
+			index = i + 1
+		}
+	}
+
+	e := m.copyOf(oe)
+	err = bv.insertItems(index, e)
+	if err == nil {
+		m.touch(e, OverlayTouch{Action: OverlayAdded}, oe)
+	}
+	return
+}
+
+// removes be's children which match oe's children (by key, or else by value)
+func (m *OverlayMerger) remove(be, oe *XMLElement) (err error) {
+	for _, c := range oe.Elements() {
+		f := m.keys.keyFunc(c.Name.Local)
+		key, keyed := "", false
+		if f != nil {
+			key, keyed = f(c)
+		}
+		matches := func(e *XMLElement) bool {
+			if !keyed {
+				return m.sameValue(e, c)
+			}
+			k, ok := f(e)
+			return ok && k == key
+		}
+		for _, e := range be.Elements() {
+			if e.Name.Local == c.Name.Local && matches(e) {
+				m.touch(e, OverlayTouch{Action: OverlayDeleted}, c)
+				err = be.removeItem(e)
+				if err != nil {
+					return
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+// true if a base element has the value of an overlay's element (ignoring any directives it has)
+func (m *OverlayMerger) sameValue(e, oe *XMLElement) bool {
+	return Diff(&XMLTree{Elements: XMLValue{contents: e}}, &XMLTree{Elements: XMLValue{contents: m.copyOf(oe)}}, m.keys).Empty()
+}
+
+// a copy of an overlay's element, without its directives
+func (m *OverlayMerger) copyOf(oe *XMLElement) (e *XMLElement) {
+	e = oe.Clone()
+	e.RemoveAttribute(m.opts.Directive)
+	eachDFS(e, &e.XMLValue, func(_, c *XMLElement) bool {
+		c.RemoveAttribute(m.opts.Directive)
+		return true
+	})
+	return
+}
+
+// notes a touch by the overlay we're applying (which we keep if it applies)
+func (m *OverlayMerger) touch(e *XMLElement, touch OverlayTouch, oe *XMLElement) {
+	touch.Overlay, touch.Position, touch.Path = m.name, oe.Position(), e.Path()
+	m.pending = append(m.pending, overlayPending{overlayTarget{e, touch.Attr}, touch})
+}
+
+// the overlay which last touched the element's value ("" if it's the base's)
+func (m *OverlayMerger) Origin(e *XMLElement) string {
+	return m.origin(overlayTarget{e, ""})
+}
+
+// the overlay which last touched the element's attribute ("" if it's the base's)
+func (m *OverlayMerger) AttrOrigin(e *XMLElement, name string) string {
+	return m.origin(overlayTarget{e, name})
+}
+
+func (m *OverlayMerger) origin(target overlayTarget) string {
+	if h := m.history[target]; len(h) != 0 {
+		return h[len(h)-1].Overlay
+	}
+	// otherwise it's from whichever overlay added (or replaced) the element, or an ancestor
+	for e := target.element; e != nil; e = e.parent {
+		if h := m.history[overlayTarget{e, ""}]; len(h) != 0 {
+			if last := h[len(h)-1]; last.Action != OverlaySet {
+				return last.Overlay
+			}
+		}
+	}
+	return ""
+}
+
+// every touch to the element's value (attr "") or attribute, in load order
+func (m *OverlayMerger) History(e *XMLElement, attr string) []OverlayTouch {
+	return m.history[overlayTarget{e, attr}]
+}
+
+// the last touch to each element, value and attribute in the tree (in document order, with current paths),
+// then every deletion (with its path when it was deleted)
+func (m *OverlayMerger) Touches() (touches []OverlayTouch) {
+	last := func(target overlayTarget) {
+		if h := m.history[target]; len(h) != 0 {
+			touch := h[len(h)-1]
+			touch.Path = target.element.Path()
+			touches = append(touches, touch)
+		}
+	}
+	eachDFS(nil, &m.tree.Elements, func(_, e *XMLElement) bool {
+		last(overlayTarget{e, ""})
+		for _, attr := range e.Attr {
+			last(overlayTarget{e, attr.Name.Local})
+		}
+		return true
+	})
+	touches = append(touches, m.deleted...)
+	return
+}
+
+// a report of the touches, one per line
+func (m *OverlayMerger) String() string {
+	sb := &strings.Builder{}
+	for _, t := range m.Touches() {
+		sb.WriteString(t.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
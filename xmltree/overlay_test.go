@@ -0,0 +1,134 @@
+package xmltree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var overlayKeys = OverlayOptions{Keys: map[string]KeyFunc{"Item": KeyByChild("Name")}}
+
+// the single element at path in the merger's tree (failing the test if there isn't exactly one)
+func overlayElement(t *testing.T, m *OverlayMerger, path string) *XMLElement {
+	t.Helper()
+	elements, err := m.Tree().XPathElements(path)
+	if err != nil || len(elements) != 1 {
+		t.Fatalf("%s: got %d elements (%v)", path, len(elements), err)
+	}
+	return elements[0]
+}
+
+func TestOverlayApply(t *testing.T) {
+	base := `<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>x</Tag><Tag>y</Tag></Tags></Item><Item><Name>B</Name><Cost>2</Cost></Item></Items>`
+	tests := []struct {
+		name    string
+		overlay string
+		want    string
+	}{
+		{"fields", `<Items><Item id="2"><Name>B</Name><Cost>3</Cost></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>x</Tag><Tag>y</Tag></Tags></Item><Item id="2"><Name>B</Name><Cost>3</Cost></Item></Items>`},
+		{"added", `<Items><Item><Name>C</Name></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>x</Tag><Tag>y</Tag></Tags></Item><Item><Name>B</Name><Cost>2</Cost></Item><Item><Name>C</Name></Item></Items>`},
+		{"replace", `<Items><Item merge="replace"><Name>A</Name></Item></Items>`,
+			`<Items><Item><Name>A</Name></Item><Item><Name>B</Name><Cost>2</Cost></Item></Items>`},
+		{"delete", `<Items><Item merge="delete"><Name>A</Name></Item><Item merge="delete"><Name>Z</Name></Item></Items>`,
+			`<Items><Item><Name>B</Name><Cost>2</Cost></Item></Items>`},
+		{"append", `<Items><Item><Name>A</Name><Tags merge="append"><Tag>z</Tag></Tags></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>x</Tag><Tag>y</Tag><Tag>z</Tag></Tags></Item><Item><Name>B</Name><Cost>2</Cost></Item></Items>`},
+		{"remove", `<Items><Item><Name>A</Name><Tags merge="remove"><Tag>x</Tag></Tags></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>y</Tag></Tags></Item><Item><Name>B</Name><Cost>2</Cost></Item></Items>`},
+		{"text to children", `<Items><Item><Name>B</Name><Cost><Gold>2</Gold></Cost></Item></Items>`,
+			`<Items><Item id="1"><Name>A</Name><Cost>1</Cost><Tags><Tag>x</Tag><Tag>y</Tag></Tags></Item><Item><Name>B</Name><Cost><Gold>2</Gold></Cost></Item></Items>`},
+	}
+	for _, tt := range tests {
+		m := NewOverlayMerger(readTree(t, base), overlayKeys)
+		err := m.Apply("mod", readTree(t, tt.overlay))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := m.Tree().String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverlayAppliesEntirelyOrNotAtAll(t *testing.T) {
+	base := readTree(t, `<Items><Item><Name>A</Name><Cost>1</Cost></Item></Items>`)
+	m := NewOverlayMerger(base, overlayKeys)
+	err := m.Apply("bad", readTree(t, `<Items><Item><Name>A</Name><Cost>2</Cost></Item><Item merge="upsert"><Name>B</Name></Item></Items>`))
+	if !errors.Is(err, ErrOverlayInvalid) || !strings.HasPrefix(err.Error(), "bad: ") {
+		t.Fatalf("got %v", err)
+	}
+	if got, want := m.Tree().String(), base.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if touches := m.Touches(); len(touches) != 0 {
+		t.Errorf("got touches %v from an overlay which didn't apply", touches)
+	}
+}
+
+func TestOverlayProvenance(t *testing.T) {
+	m := NewOverlayMerger(readTree(t, `<Items><Item><Name>A</Name><Cost>1</Cost></Item><Item><Name>B</Name><Cost>2</Cost></Item><Item><Name>D</Name></Item></Items>`), overlayKeys)
+	overlays := []struct{ name, xml string }{
+		{"a", `<Items><Item><Name>A</Name><Cost>5</Cost></Item><Item><Name>C</Name><Cost>7</Cost></Item></Items>`},
+		{"b", `<Items><Item rare="yes"><Name>A</Name><Cost>6</Cost></Item><Item merge="delete"><Name>D</Name></Item></Items>`},
+	}
+	for _, o := range overlays {
+		err := m.Apply(o.name, readTree(t, o.xml))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, b, c := overlayElement(t, m, "/Items/Item[Name='A']"), overlayElement(t, m, "/Items/Item[Name='B']"), overlayElement(t, m, "/Items/Item[Name='C']")
+	cost := a.Elements()[1]
+	origins := []struct {
+		what string
+		got  string
+		want string
+	}{
+		{"A's cost", m.Origin(cost), "b"},
+		{"A's rare", m.AttrOrigin(a, "rare"), "b"},
+		{"A", m.Origin(a), ""},
+		{"B's cost", m.Origin(b.Elements()[1]), ""},
+		{"C", m.Origin(c), "a"},
+		{"C's cost", m.Origin(c.Elements()[1]), "a"}, // from the overlay which added C
+	}
+	for _, o := range origins {
+		if o.got != o.want {
+			t.Errorf("origin of %s: got %q, want %q", o.what, o.got, o.want)
+		}
+	}
+
+	// each overlay's touch, in load order
+	h := m.History(cost, "")
+	if len(h) != 2 || h[0].Overlay != "a" || h[0].Value != "5" || h[1].Overlay != "b" || h[1].Value != "6" {
+		t.Fatalf("got history %v", h)
+	}
+	if h[1].Action != OverlaySet || h[1].Path != "Items/Item[1]/Cost" || h[1].Position.Line != 1 {
+		t.Errorf("got %+v", h[1])
+	}
+	if h := m.History(b, ""); len(h) != 0 {
+		t.Errorf("got history %v for an untouched element", h)
+	}
+
+	// the last touch to each, with current paths, then the deletions
+	want := []string{
+		`Items/Item[1]/@rare: "yes" (b)`,
+		`Items/Item[1]/Cost: "6" (b)`,
+		`Items/Item[3]: added by a`,
+		`Items/Item[3]: deleted by b`,
+	}
+	touches := m.Touches()
+	var got []string
+	for _, touch := range touches {
+		got = append(got, touch.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if m.String() != strings.Join(want, "\n")+"\n" {
+		t.Errorf("got report\n%s", m)
+	}
+}
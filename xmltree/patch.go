@@ -0,0 +1,505 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// xml patch (rfc 5261): declarative <add>, <replace> and <remove> operations whose sel attribute is an xpath
+//
+//   <diff>
+//     <add sel="/Items"><Item><Name>Spear</Name></Item></add>
+//     <add sel="/Items/Item[Name='Sword']" type="@tier">2</add>
+//     <add sel="/Items/Item[Name='Sword']" pos="before"><!-- blades --></add>
+//     <replace sel="/Items/Item[Name='Axe']/Damage/text()">15</replace>
+//     <replace sel="/Items/Item[Name='Axe']/@id">9</replace>
+//     <remove sel="/Items/Item[Name='Club']"/>
+//   </diff>
+//
+// add: pos is append (the default), prepend, before or after; type="@name" adds an attribute (which must not exist yet)
+// replace: an element, comment or processing instruction by the single node within, or an attribute's or text's value
+// remove: an element, comment, processing instruction, attribute or text (ws is accepted, but since whitespace between
+// elements isn't kept, there is never any to remove)
+// every sel must select exactly one node (as the rfc requires), and namespace operations are not supported
+// a patch is atomic: if any operation fails, the tree is left as it was (unless you ask to keep going)
+
+var (
+	ErrPatchNoMatch   = errors.New("selector matched no node")
+	ErrPatchAmbiguous = errors.New("selector matched more than one node")
+	ErrPatchInvalid   = errors.New("invalid patch operation")
+)
+
+// a failed operation: which it was, where it was in the patch, and why
+type PatchError struct {
+	Op       string
+	Index    int      // the operation's position in the patch (1 based)
+	Position Position // where the operation was in the patch's source
+	Sel      string
+	Err      error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch %s: %s #%d sel=%q: %v", e.Position, e.Op, e.Index, e.Sel, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// one change an operation made (or would make, in a dry run)
+type PatchChange struct {
+	Op       string
+	Index    int      // the operation's position in the patch (1 based)
+	Position Position // where the operation was in the patch's source
+	Target   string   // the path of what changed (see At), with a final @attr or text() step for those
+	Before   string   // what was there (as xml, or the attribute or text value), empty for an add
+	After    string   // what is there now, empty for a remove
+}
+
+func (c PatchChange) String() string {
+	switch {
+	case c.Before == "":
+		return fmt.Sprintf("%s: %s %s: + %s", c.Position, c.Op, c.Target, c.After)
+	case c.After == "":
+		return fmt.Sprintf("%s: %s %s: - %s", c.Position, c.Op, c.Target, c.Before)
+	}
+	return fmt.Sprintf("%s: %s %s: %s -> %s", c.Position, c.Op, c.Target, c.Before, c.After)
+}
+
+type PatchOptions struct {
+	DryRun    bool // report what would change, but leave the tree as it was
+	KeepGoing bool // apply every operation that can be, rather than stopping (and undoing them all) at the first failure
+}
+
+type PatchResult struct {
+	Changes  []PatchChange
+	Failures []*PatchError
+}
+
+// every failure (joined), or nil
+func (r *PatchResult) Err() error {
+	errs := make([]error, len(r.Failures))
+	for i, f := range r.Failures {
+		errs[i] = f
+	}
+	return errors.Join(errs...)
+}
+
+// a parsed patch (safe to apply to many trees)
+type Patch struct {
+	ops []*patchOp
+}
+
+type patchOp struct {
+	op      string // add, replace or remove
+	index   int
+	element *XMLElement // the operation's element (for its position and contents)
+	sel     string
+	path    *XPath
+	pos     string // add: append, prepend, before or after
+	attr    string // add: type="@attr"
+}
+
+func (op *patchOp) fail(err error) *PatchError {
+	return &PatchError{Op: op.op, Index: op.index, Position: op.element.Position(), Sel: op.sel, Err: err}
+}
+
+// reads a patch document (any root element, usually <diff>, holding the operations)
+// every malformed operation is reported (joined)
+func ParsePatch(document *XMLTree) (patch *Patch, err error) {
+	roots := document.Elements.Elements()
+	if len(roots) != 1 {
+		err = fmt.Errorf("patch must have a single root element: %w", ErrPatchInvalid)
+		return
+	}
+
+	patch = &Patch{}
+	var errs []error
+	for i, e := range roots[0].Elements() {
+		op := &patchOp{op: e.Name.Local, index: i + 1, element: e}
+		op.sel, _ = e.Attribute("sel")
+		if e := op.parse(); e != nil {
+			errs = append(errs, op.fail(e))
+			continue
+		}
+		patch.ops = append(patch.ops, op)
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		patch = nil
+	}
+	return
+}
+
+func (op *patchOp) parse() (err error) {
+	switch op.op {
+	case "add", "replace", "remove":
+	default:
+		return fmt.Errorf("unknown operation <%s>: %w", op.op, ErrPatchInvalid)
+	}
+	if op.sel == "" {
+		return fmt.Errorf("missing sel: %w", ErrPatchInvalid)
+	}
+	op.path, err = CompileXPath(op.sel)
+	if err != nil {
+		return
+	}
+
+	e := op.element
+	switch op.op {
+	case "add":
+		op.pos, _ = e.Attribute("pos")
+		switch op.pos {
+		case "", "append", "prepend", "before", "after":
+		default:
+			return fmt.Errorf("invalid pos %q: %w", op.pos, ErrPatchInvalid)
+		}
+		if t, ok := e.Attribute("type"); ok {
+			name, isAttr := strings.CutPrefix(t, "@")
+			switch {
+			case isAttr && IsValidName(name):
+				op.attr = name
+			case strings.HasPrefix(t, "namespace::"):
+				return fmt.Errorf("namespace operations are not supported: %w", ErrPatchInvalid)
+			default:
+				return fmt.Errorf("invalid type %q: %w", t, ErrPatchInvalid)
+			}
+		}
+	case "remove":
+		switch ws, _ := e.Attribute("ws"); ws {
+		case "", "before", "after", "both":
+		default:
+			return fmt.Errorf("invalid ws %q: %w", ws, ErrPatchInvalid)
+		}
+		if len(op.items()) != 0 || op.text() != "" {
+			return fmt.Errorf("<remove> must be empty: %w", ErrPatchInvalid)
+		}
+	}
+	return
+}
+
+// the nodes within the operation (elements, comments and processing instructions), ignoring whitespace
+func (op *patchOp) items() (items []any) {
+	switch t := op.element.contents.(type) {
+	case []any:
+		for _, item := range t {
+			if _, ok := item.(*XMLDirective); !ok {
+				items = append(items, item)
+			}
+		}
+	case *XMLElement, *XMLComment, *XMLProcInst:
+		items = append(items, t)
+	}
+	return
+}
+
+// the text within the operation (if it holds text rather than nodes)
+func (op *patchOp) text() string {
+	s, _ := op.element.contents.(string)
+	return s
+}
+
+// loads a patch from a file
+func LoadPatch(filename string) (patch *Patch, err error) {
+	document, err := LoadFromFile(filename)
+	if err != nil {
+		return
+	}
+	return ParsePatch(document)
+}
+
+// parses and applies a patch document (see Patch.Apply)
+func (tree *XMLTree) ApplyPatch(document *XMLTree, options PatchOptions) (result *PatchResult, err error) {
+	patch, err := ParsePatch(document)
+	if err != nil {
+		return
+	}
+	return patch.Apply(tree, options)
+}
+
+var errPatchUndo = errors.New("undo the patch")
+
+// applies every operation in order (each sees the results of those before it)
+// the error is every failure (joined); unless options.KeepGoing, we stop at the first and the tree is left untouched
+// (this runs in a transaction, or as a single step of the tree's active transaction)
+func (p *Patch) Apply(tree *XMLTree, options PatchOptions) (result *PatchResult, err error) {
+	result = &PatchResult{}
+	run := func() error {
+		for _, op := range p.ops {
+			changes, e := op.apply(tree)
+			if e != nil {
+				result.Failures = append(result.Failures, op.fail(e))
+				if !options.KeepGoing {
+					result.Changes = nil
+					return errPatchUndo
+				}
+				continue
+			}
+			result.Changes = append(result.Changes, changes...)
+		}
+		if options.DryRun {
+			return errPatchUndo
+		}
+		return nil
+	}
+
+	if tx := tree.Transaction(); tx != nil {
+		tx.Do("patch", run)
+	} else {
+		tx, _ = tree.Begin()
+		if run() != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}
+
+	err = result.Err()
+	return
+}
+
+// the one node the operation selects
+func (op *patchOp) target(tree *XMLTree) (node *XPathNode, err error) {
+	result, err := op.path.Evaluate(tree)
+	if err != nil {
+		return
+	}
+	if !result.IsNodeSet() {
+		err = fmt.Errorf("selector is not a node-set: %w", ErrPatchInvalid)
+		return
+	}
+	switch nodes := result.Nodes(); len(nodes) {
+	case 0:
+		err = ErrPatchNoMatch
+	case 1:
+		node = nodes[0]
+	default:
+		err = fmt.Errorf("%w (%d)", ErrPatchAmbiguous, len(nodes))
+	}
+	return
+}
+
+func (op *patchOp) apply(tree *XMLTree) (changes []PatchChange, err error) {
+	node, err := op.target(tree)
+	if err != nil {
+		return
+	}
+
+	change := func(target, before, after string) {
+		changes = append(changes, PatchChange{Op: op.op, Index: op.index, Position: op.element.Position(), Target: target, Before: before, After: after})
+	}
+
+	switch op.op {
+	case "add":
+		err = op.add(node, change)
+	case "replace":
+		err = op.replace(node, change)
+	case "remove":
+		err = op.remove(node, change)
+	}
+	return
+}
+
+func (op *patchOp) add(node *XPathNode, change func(target, before, after string)) (err error) {
+	e := node.Element()
+
+	// an attribute
+	if op.attr != "" {
+		if node.Kind() != XPathElementNode {
+			return fmt.Errorf("can only add an attribute to an element, not a %s: %w", node.Kind(), ErrPatchInvalid)
+		}
+		if e.HasAttribute(op.attr) {
+			return fmt.Errorf("attribute %s already exists: %w", op.attr, ErrPatchInvalid)
+		}
+		e.SetAttribute(op.attr, op.text())
+		change(e.Path()+"/@"+op.attr, "", op.text())
+		return
+	}
+
+	items := CloneContents(op.items()).([]any)
+	if s := op.text(); len(items) == 0 && strings.TrimSpace(s) != "" {
+		// text (which can only be added to an empty element)
+		if node.Kind() != XPathElementNode || op.pos == "before" || op.pos == "after" {
+			return fmt.Errorf("can only add text within an element: %w", ErrPatchInvalid)
+		}
+		if !e.Empty() && !e.IsSimple() {
+			return fmt.Errorf("cannot add text to %s, which has children (mixed content is not supported)", e.Name.Local)
+		}
+		if current, _ := e.GetStringValue(); strings.TrimSpace(current) != "" {
+			return fmt.Errorf("%s already has text: %w", e.Name.Local, ErrPatchInvalid)
+		}
+		e.SetString(s)
+		change(e.Path()+"/text()", "", s)
+		return
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("nothing to add: %w", ErrPatchInvalid)
+	}
+
+	var value *XMLValue
+	var index int
+	switch op.pos {
+	case "", "append", "prepend":
+		if node.Kind() != XPathElementNode {
+			return fmt.Errorf("can only add children to an element, not a %s: %w", node.Kind(), ErrPatchInvalid)
+		}
+		value = &e.XMLValue
+		if op.pos != "prepend" {
+			children, e := value.items()
+			if e != nil {
+				return e
+			}
+			index = len(children)
+		}
+	default:
+		var item any
+		value, item, err = patchItem(node)
+		if err != nil {
+			return
+		}
+		index = value.itemIndex(item)
+		if op.pos == "after" {
+			index++
+		}
+	}
+
+	err = value.insertItems(index, items...)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		change(patchItemPath(value, item), "", patchItemXML(item))
+	}
+	return
+}
+
+func (op *patchOp) replace(node *XPathNode, change func(target, before, after string)) (err error) {
+	e := node.Element()
+	switch node.Kind() {
+	case XPathAttributeNode:
+		if len(op.items()) != 0 {
+			return fmt.Errorf("an attribute can only be replaced by text: %w", ErrPatchInvalid)
+		}
+		name := node.Attr().Name.Local
+		before := node.Attr().Value
+		e.SetAttribute(name, op.text())
+		change(e.Path()+"/@"+name, before, op.text())
+		return
+
+	case XPathTextNode:
+		if len(op.items()) != 0 {
+			return fmt.Errorf("text can only be replaced by text: %w", ErrPatchInvalid)
+		}
+		before, _ := e.GetStringValue()
+		e.SetString(op.text())
+		change(e.Path()+"/text()", before, op.text())
+		return
+	}
+
+	items := op.items()
+	if len(items) != 1 {
+		return fmt.Errorf("a %s must be replaced by exactly one node, not %d: %w", node.Kind(), len(items), ErrPatchInvalid)
+	}
+	value, item, err := patchItem(node)
+	if err != nil {
+		return
+	}
+	replacement := CloneContents(items[0])
+	before := patchItemXML(item)
+	err = value.replaceItem(item, replacement)
+	if err != nil {
+		return
+	}
+	change(patchItemPath(value, replacement), before, patchItemXML(replacement))
+	return
+}
+
+func (op *patchOp) remove(node *XPathNode, change func(target, before, after string)) (err error) {
+	e := node.Element()
+	switch node.Kind() {
+	case XPathAttributeNode:
+		name := node.Attr().Name.Local
+		before := node.Attr().Value
+		e.RemoveAttribute(name)
+		change(e.Path()+"/@"+name, before, "")
+		return
+
+	case XPathTextNode:
+		before, _ := e.GetStringValue()
+		e.replaceContents(nil)
+		change(e.Path()+"/text()", before, "")
+		return
+
+	case XPathElementNode:
+		// a document must keep its root (RFC 5261 4.5)
+		if e.parent == nil {
+			return fmt.Errorf("cannot remove the root element %s: %w", e.Name.Local, ErrPatchInvalid)
+		}
+	}
+
+	value, item, err := patchItem(node)
+	if err != nil {
+		return
+	}
+	target := patchItemPath(value, item)
+	before := patchItemXML(item)
+	err = value.removeItem(item)
+	if err != nil {
+		return
+	}
+	change(target, before, "")
+	return
+}
+
+// the contents the node is an item of, and the item itself
+func patchItem(node *XPathNode) (value *XMLValue, item any, err error) {
+	switch node.Kind() {
+	case XPathElementNode:
+		item = node.Element()
+	case XPathCommentNode, XPathProcInstNode:
+		item = node.Item()
+	default:
+		err = fmt.Errorf("cannot do that to a %s node: %w", node.Kind(), ErrPatchInvalid)
+		return
+	}
+	value = node.Parent().value
+	return
+}
+
+// the path of an item in value (elements have their own, others are described by their parent and kind)
+func patchItemPath(value *XMLValue, item any) string {
+	if e, ok := item.(*XMLElement); ok {
+		return e.Path()
+	}
+	path := ""
+	if value.owner != nil {
+		path = value.owner.Path() + "/"
+	}
+	switch item.(type) {
+	case *XMLComment:
+		return path + "comment()"
+	case *XMLProcInst:
+		return path + "processing-instruction()"
+	}
+	return path + "node()"
+}
+
+// an item as xml
+func patchItemXML(item any) string {
+	return strings.TrimSpace(encodeToString(&XMLValue{contents: item}, false))
+}
+
+// the changes (or failures) as text, one per line
+func (r *PatchResult) String() string {
+	sb := &strings.Builder{}
+	for _, c := range r.Changes {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+	}
+	for _, f := range r.Failures {
+		sb.WriteString(f.Error())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
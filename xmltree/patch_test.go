@@ -0,0 +1,250 @@
+package xmltree
+
+import (
+	"errors"
+	"testing"
+)
+
+const patchTestXML = `<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`
+
+// applies the operations (the body of a <diff>) to the document, returning the result
+func applyPatch(t *testing.T, document, ops string, options PatchOptions) (tree *XMLTree, result *PatchResult, err error) {
+	t.Helper()
+	tree = readTree(t, document)
+	patch, err := ParsePatch(readTree(t, "<diff>"+ops+"</diff>"))
+	if err != nil {
+		t.Fatalf("%s: %v", ops, err)
+	}
+	result, err = patch.Apply(tree, options)
+	return
+}
+
+func TestPatchOperations(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		want string
+	}{
+		// elements
+		{"add element", `<add sel="/Items"><Item id="3"><Name>Axe</Name></Item></add>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?><Item id="3"><Name>Axe</Name></Item></Items>`},
+		{"replace element", `<replace sel="/Items/Item[Name='Mace']"><Club /></replace>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Club /><?sort by-name?></Items>`},
+		{"remove element", `<remove sel="/Items/Item[@id='1']" />`,
+			`<Items><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+
+		// attributes
+		{"add attribute", `<add sel="/Items/Item[1]" type="@tier">2</add>`,
+			`<Items><Item id="1" tier="2"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"replace attribute", `<replace sel="/Items/Item[2]/@id">9</replace>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="9"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"remove attribute", `<remove sel="/Items/Item[2]/@id" />`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+
+		// text
+		{"add text", `<remove sel="/Items/Item[1]/Damage/text()" /><add sel="/Items/Item[1]/Damage">12</add>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>12</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"replace text", `<replace sel="/Items/Item[1]/Damage/text()">15</replace>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>15</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"remove text", `<remove sel="/Items/Item[1]/Damage/text()" />`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage /></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+
+		// comments
+		{"add comment", `<add sel="/Items/Item[1]" pos="before"><!--blades--></add>`,
+			`<Items><!--blades--><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"replace comment", `<replace sel="/Items/comment()"><!--maces--></replace>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--maces--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"remove comment", `<remove sel="/Items/comment()" />`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+
+		// processing instructions
+		{"add processing instruction", `<add sel="/Items" pos="prepend"><?check all?></add>`,
+			`<Items><?check all?><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`},
+		{"replace processing instruction", `<replace sel="/Items/processing-instruction()"><?sort by-id?></replace>`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-id?></Items>`},
+		{"remove processing instruction", `<remove sel="/Items/processing-instruction('sort')" />`,
+			`<Items><Item id="1"><Name>Sword</Name><Damage>10</Damage></Item><!--blunt--><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item></Items>`},
+	}
+	for _, tt := range tests {
+		tree, _, err := applyPatch(t, patchTestXML, tt.ops, PatchOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := tree.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatchPositions(t *testing.T) {
+	tests := []struct {
+		pos  string
+		want string
+	}{
+		{"", `<a><b /><c /><x /></a>`},
+		{"append", `<a><b /><c /><x /></a>`},
+		{"prepend", `<a><x /><b /><c /></a>`},
+		{"before", `<a><x /><b /><c /></a>`},
+		{"after", `<a><b /><x /><c /></a>`},
+	}
+	for _, tt := range tests {
+		sel := "/a"
+		if tt.pos == "before" || tt.pos == "after" {
+			sel = "/a/b"
+		}
+		ops := `<add sel="` + sel + `" pos="` + tt.pos + `"><x /></add>`
+		if tt.pos == "" {
+			ops = `<add sel="/a"><x /></add>`
+		}
+		tree, result, err := applyPatch(t, `<a><b /><c /></a>`, ops, PatchOptions{})
+		if err != nil {
+			t.Errorf("%q: %v", tt.pos, err)
+			continue
+		}
+		if got := tree.String(); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.pos, got, tt.want)
+		}
+		if len(result.Changes) != 1 || result.Changes[0].After != "<x />" {
+			t.Errorf("%q: got changes %v", tt.pos, result.Changes)
+		}
+	}
+}
+
+func TestPatchChanges(t *testing.T) {
+	_, result, err := applyPatch(t, patchTestXML, `<replace sel="/Items/Item[1]/@id">5</replace>
+<remove sel="/Items/Item[2]/Damage" />`, PatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PatchChange{
+		{Op: "replace", Index: 1, Target: "Items/Item[1]/@id", Before: "1", After: "5"},
+		{Op: "remove", Index: 2, Target: "Items/Item[2]/Damage", Before: "<Damage>8</Damage>"},
+	}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("got %v", result.Changes)
+	}
+	for i, c := range result.Changes {
+		if c.Position.Line != i+1 {
+			t.Errorf("change %d: got position %s", i, c.Position)
+		}
+		c.Position = Position{}
+		if c != want[i] {
+			t.Errorf("got %+v, want %+v", c, want[i])
+		}
+	}
+}
+
+func TestPatchFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		want error
+	}{
+		{"no match", `<remove sel="/Items/Item[3]" />`, ErrPatchNoMatch},
+		{"ambiguous", `<remove sel="/Items/Item" />`, ErrPatchAmbiguous},
+		{"existing attribute", `<add sel="/Items/Item[1]" type="@id">3</add>`, ErrPatchInvalid},
+		{"text beside", `<add sel="/Items/Item[1]" pos="after">text</add>`, ErrPatchInvalid},
+		{"text over text", `<add sel="/Items/Item[1]/Name">Blade</add>`, ErrPatchInvalid},
+		{"two replacements", `<replace sel="/Items/Item[1]"><a /><b /></replace>`, ErrPatchInvalid},
+		{"attribute by element", `<replace sel="/Items/Item[1]/@id"><a /></replace>`, ErrPatchInvalid},
+		{"nothing to add", `<add sel="/Items" />`, ErrPatchInvalid},
+		{"root", `<remove sel="/Items" />`, ErrPatchInvalid},
+	}
+	for _, tt := range tests {
+		tree, result, err := applyPatch(t, patchTestXML, tt.ops, PatchOptions{})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		var pe *PatchError
+		if !errors.As(err, &pe) || pe.Index != 1 {
+			t.Errorf("%s: got %v, want a PatchError for the first operation", tt.name, err)
+		}
+		if len(result.Changes) != 0 {
+			t.Errorf("%s: got changes %v", tt.name, result.Changes)
+		}
+		if got := tree.String(); got != patchTestXML {
+			t.Errorf("%s: the tree was changed: %s", tt.name, got)
+		}
+	}
+}
+
+func TestParsePatchFailures(t *testing.T) {
+	tests := []string{
+		`<diff><frob sel="/a" /></diff>`,
+		`<diff><remove /></diff>`,
+		`<diff><remove sel="/a[" /></diff>`,
+		`<diff><add sel="/a" pos="around"><b /></add></diff>`,
+		`<diff><add sel="/a" type="@1st">x</add></diff>`,
+	}
+	for _, s := range tests {
+		_, err := ParsePatch(readTree(t, s))
+		var pe *PatchError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: got %v, want a PatchError", s, err)
+		}
+	}
+
+	// every malformed operation is reported
+	_, err := ParsePatch(readTree(t, `<diff><frob /><remove sel="/a" /><add /></diff>`))
+	if err == nil || len(err.(interface{ Unwrap() []error }).Unwrap()) != 2 {
+		t.Errorf("got %v, want two errors", err)
+	}
+}
+
+func TestPatchIsAtomic(t *testing.T) {
+	ops := `<replace sel="/Items/Item[1]/@id">5</replace><remove sel="/Items/Nothing" /><remove sel="/Items/comment()" />`
+	tree, result, err := applyPatch(t, patchTestXML, ops, PatchOptions{})
+	if err == nil || len(result.Failures) != 1 || len(result.Changes) != 0 {
+		t.Fatalf("got %v, %v", result, err)
+	}
+	if got := tree.String(); got != patchTestXML {
+		t.Errorf("a failed patch changed the tree: %s", got)
+	}
+}
+
+func TestPatchKeepGoing(t *testing.T) {
+	ops := `<replace sel="/Items/Item[1]/@id">5</replace><remove sel="/Items/Nothing" /><remove sel="/Items/comment()" />`
+	tree, result, err := applyPatch(t, patchTestXML, ops, PatchOptions{KeepGoing: true})
+	if err == nil || len(result.Failures) != 1 || result.Failures[0].Index != 2 {
+		t.Fatalf("got %v, %v", result, err)
+	}
+	if len(result.Changes) != 2 {
+		t.Errorf("got changes %v", result.Changes)
+	}
+	want := `<Items><Item id="5"><Name>Sword</Name><Damage>10</Damage></Item><Item id="2"><Name>Mace</Name><Damage>8</Damage></Item><?sort by-name?></Items>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestPatchDryRun(t *testing.T) {
+	ops := `<replace sel="/Items/Item[1]/@id">5</replace><remove sel="/Items/comment()" />`
+	tree, result, err := applyPatch(t, patchTestXML, ops, PatchOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 2 {
+		t.Errorf("got changes %v", result.Changes)
+	}
+	if got := tree.String(); got != patchTestXML {
+		t.Errorf("a dry run changed the tree: %s", got)
+	}
+}
+
+func TestPatchInTransaction(t *testing.T) {
+	tree := readTree(t, patchTestXML)
+	tx, _ := tree.Begin()
+	_, err := tree.ApplyPatch(readTree(t, `<diff><remove sel="/Items/comment()" /></diff>`), PatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	undo, _ := tx.History()
+	if len(undo) != 1 || undo[0] != "patch" {
+		t.Errorf("got history %q, want the patch as one step", undo)
+	}
+	tx.Undo()
+	if got := tree.String(); got != patchTestXML {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,468 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// slash-path addressing
+// a path is a list of steps separated by slashes, e.g. Stats/Combat/Damage, where each step names a child element
+// (or * for any child), optionally followed by any number of predicates:
+//   [Name=Sword]     has a child Name whose value is Sword (quote the value to include ] or /, e.g. [Name='A/B'])
+//   [Name]           has a child Name
+//   [@id=3]          has the attribute id with value 3
+//   [@id]            has the attribute id
+//   [3]              is the 3rd of the children matched so far (counting from 1, as xpath does)
+// paths are relative to an element's children, or for a tree, to its top level (so the first step names the root)
+
+var ErrPathNotFound = errors.New("no matching element")
+
+// a path operation failed at the given step
+type PathError struct {
+	Path string // the whole path
+	Step int    // which step failed (counting from 1, or 0 if the path as a whole is at fault)
+	Text string // the text of that step
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if e.Step == 0 {
+		return fmt.Sprintf("path %q: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("path %q: step %d (%s): %v", e.Path, e.Step, e.Text, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+type pathPredicate struct {
+	index    int    // 1 based, or 0 for a key predicate
+	key      string // child tag or attribute name
+	attr     bool
+	value    string
+	hasValue bool
+}
+
+type pathStep struct {
+	text       string
+	tag        string // or * for any
+	predicates []pathPredicate
+}
+
+type elementPath struct {
+	source string
+	steps  []pathStep
+}
+
+func (p *elementPath) fail(step int, err error) error {
+	e := &PathError{Path: p.source, Step: step + 1, Err: err}
+	if step < len(p.steps) {
+		e.Text = p.steps[step].text
+	} else {
+		e.Step = 0
+	}
+	return e
+}
+
+func parsePath(source string) (path *elementPath, err error) {
+	path = &elementPath{source: source}
+	fail := func(step int, text, format string, args ...any) error {
+		return &PathError{Path: source, Step: step, Text: text, Err: fmt.Errorf(format, args...)}
+	}
+
+	s := strings.TrimPrefix(source, "/")
+	if s == "" {
+		err = fail(0, "", "empty path")
+		return
+	}
+
+	for len(s) != 0 {
+		n := len(path.steps) + 1
+
+		// the tag runs up to the first [ or /
+		end := strings.IndexAny(s, "[/")
+		if end == -1 {
+			end = len(s)
+		}
+		step := pathStep{tag: strings.TrimSpace(s[:end])}
+		rest := s[end:]
+
+		// then any number of predicates
+		for strings.HasPrefix(rest, "[") {
+			var predicate pathPredicate
+			predicate, rest, err = parsePathPredicate(rest[1:])
+			if err != nil {
+				err = fail(n, s[:len(s)-len(rest)], "%v", err)
+				return
+			}
+			step.predicates = append(step.predicates, predicate)
+		}
+
+		step.text = s[:len(s)-len(rest)]
+		if step.tag == "" {
+			err = fail(n, step.text, "missing element name")
+			return
+		}
+		if step.tag != "*" && !IsValidName(step.tag) {
+			err = fail(n, step.text, "invalid element name %q", step.tag)
+			return
+		}
+		if rest != "" && rest[0] != '/' {
+			err = fail(n, step.text, "unexpected %q", rest)
+			return
+		}
+		if rest == "/" {
+			err = fail(n+1, "", "missing element name")
+			return
+		}
+
+		path.steps = append(path.steps, step)
+		s = strings.TrimPrefix(rest, "/")
+	}
+
+	return
+}
+
+// parses the inside of a predicate (s follows the opening [) and returns what follows the closing ]
+func parsePathPredicate(s string) (predicate pathPredicate, rest string, err error) {
+
+	// the key (or index) runs up to = or ]
+	end := strings.IndexAny(s, "=]")
+	if end == -1 {
+		err = fmt.Errorf("unterminated [")
+		return
+	}
+	key := strings.TrimSpace(s[:end])
+	s = s[end:]
+
+	if s[0] == ']' {
+		rest = s[1:]
+		if i, e := strconv.Atoi(key); e == nil {
+			if i < 1 {
+				err = fmt.Errorf("index [%d] must be 1 or more", i)
+				return
+			}
+			predicate.index = i
+			return
+		}
+	} else {
+		// the value is either quoted or runs up to the ]
+		s = strings.TrimLeft(s[1:], " ")
+		if s != "" && (s[0] == '\'' || s[0] == '"') {
+			quote := strings.IndexByte(s[1:], s[0])
+			if quote == -1 {
+				err = fmt.Errorf("unterminated quote")
+				return
+			}
+			predicate.value = s[1 : quote+1]
+			s = strings.TrimLeft(s[quote+2:], " ")
+			if !strings.HasPrefix(s, "]") {
+				err = fmt.Errorf("expected ] after the quoted value")
+				return
+			}
+			rest = s[1:]
+		} else {
+			bracket := strings.IndexByte(s, ']')
+			if bracket == -1 {
+				err = fmt.Errorf("unterminated [")
+				return
+			}
+			predicate.value = strings.TrimSpace(s[:bracket])
+			rest = s[bracket+1:]
+		}
+		predicate.hasValue = true
+	}
+
+	predicate.attr = strings.HasPrefix(key, "@")
+	predicate.key = strings.TrimPrefix(key, "@")
+	if !IsValidName(predicate.key) {
+		err = fmt.Errorf("invalid name %q", predicate.key)
+	}
+	return
+}
+
+// true if e satisfies a key predicate
+func (p *pathPredicate) matches(e *XMLElement) bool {
+	if p.attr {
+		value, ok := e.Attribute(p.key)
+		return ok && (!p.hasValue || value == p.value)
+	}
+	if !p.hasValue {
+		return e.Child(p.key) != nil
+	}
+	return e.hasSimpleChild(p.key, p.value)
+}
+
+// the children of v which satisfy this step
+func (step *pathStep) match(v *XMLValue) (matches []*XMLElement) {
+	v.eachElement(func(e *XMLElement) bool {
+		if step.tag == "*" || e.Name.Local == step.tag {
+			matches = append(matches, e)
+		}
+		return true
+	})
+	for _, p := range step.predicates {
+		if p.index != 0 {
+			if p.index > len(matches) {
+				return nil
+			}
+			matches = matches[p.index-1 : p.index]
+			continue
+		}
+		kept := matches[:0]
+		for _, e := range matches {
+			if p.matches(e) {
+				kept = append(kept, e)
+			}
+		}
+		matches = kept
+	}
+	return
+}
+
+// describes where a step was looking for its match
+func describeValue(v *XMLValue) string {
+	if v.owner == nil {
+		return "the top level"
+	}
+	return v.owner.Name.Local
+}
+
+// the first element at the end of the path (in document order)
+// if there is none, the error names the deepest step that we failed to match
+func (p *elementPath) first(v *XMLValue) (element *XMLElement, err error) {
+	deepest, where := -1, v
+	var find func(v *XMLValue, i int) *XMLElement
+	find = func(v *XMLValue, i int) *XMLElement {
+		matches := p.steps[i].match(v)
+		if len(matches) == 0 && i > deepest {
+			deepest, where = i, v
+		}
+		for _, e := range matches {
+			if i == len(p.steps)-1 {
+				return e
+			}
+			if found := find(&e.XMLValue, i+1); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	element = find(v, 0)
+	if element == nil {
+		err = p.fail(deepest, fmt.Errorf("%w in %s", ErrPathNotFound, describeValue(where)))
+	}
+	return
+}
+
+// every element at the end of the path (in document order)
+func (p *elementPath) all(v *XMLValue) (elements []*XMLElement) {
+	values := []*XMLValue{v}
+	for i := range p.steps {
+		elements = nil
+		for _, v := range values {
+			elements = append(elements, p.steps[i].match(v)...)
+		}
+		values = values[:0]
+		for _, e := range elements {
+			values = append(values, &e.XMLValue)
+		}
+	}
+	return
+}
+
+// sets the value of the first element at the end of the path (which must not have children)
+func (p *elementPath) set(v *XMLValue, value any) (err error) {
+	element, err := p.first(v)
+	if err != nil {
+		return
+	}
+	err = element.setValueUnlessParent(value)
+	if err != nil {
+		err = p.fail(len(p.steps)-1, err)
+	}
+	return
+}
+
+// the first element at the end of the path, creating whatever steps are missing
+// note: if the whole path doesn't exist, we follow the first match for each step that does
+func (p *elementPath) ensure(v *XMLValue) (element *XMLElement, err error) {
+	element, err = p.first(v)
+	if err == nil {
+		return
+	}
+	err = nil
+
+	// follow the steps which exist
+	i := 0
+	for ; i < len(p.steps); i++ {
+		matches := p.steps[i].match(v)
+		if len(matches) == 0 {
+			break
+		}
+		element = matches[0]
+		v = &element.XMLValue
+	}
+	if i == len(p.steps) {
+		return
+	}
+
+	// subtle: we make the missing steps on their own, and attach them only once they've all been made
+	// (so that failing part way along leaves the tree as it was)
+	var top *XMLElement
+	parent, missing := v, i
+	for ; i < len(p.steps); i++ {
+		var e *XMLElement
+		e, err = p.steps[i].create(parent)
+		if err == nil && top != nil {
+			err = parent.makeEditable().Append(e)
+		}
+		if err != nil {
+			err = p.fail(i, err)
+			element = nil
+			return
+		}
+		if top == nil {
+			top = e
+		}
+		element = e
+		parent = &e.XMLValue
+	}
+
+	err = v.makeEditable().Append(top)
+	if err != nil {
+		err = p.fail(missing, err)
+		element = nil
+	}
+	return
+}
+
+// makes a new element which satisfies this step as a child of v (which is left for the caller to attach it to)
+func (step *pathStep) create(v *XMLValue) (e *XMLElement, err error) {
+	if step.tag == "*" {
+		err = fmt.Errorf("%w in %s (and cannot create a wildcard)", ErrPathNotFound, describeValue(v))
+		return
+	}
+	if v.owner == nil {
+		err = fmt.Errorf("%w in %s (and cannot create a second root)", ErrPathNotFound, describeValue(v))
+		return
+	}
+
+	e = MakeElement(step.tag)
+	for _, p := range step.predicates {
+		switch {
+		case p.index != 0:
+			// we can only create the next one in line
+			if n := len((&pathStep{tag: step.tag}).match(v)); p.index != n+1 {
+				err = fmt.Errorf("%w in %s (and cannot create [%d] when there are %d)", ErrPathNotFound, describeValue(v), p.index, n)
+				return
+			}
+		case p.attr:
+			e.SetAttribute(p.key, p.value)
+		default:
+			_, err = e.makeEditable().SetAppendChild(p.key, p.value)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ensures our contents can have children appended to them (errors are left for Append to report)
+func (v *XMLValue) makeEditable() *XMLValue {
+	if s, ok := v.contents.(string); v.contents == nil || (ok && strings.TrimSpace(s) == "") {
+		v.replaceContents([]any{})
+	}
+	return v
+}
+
+func (e *XMLElement) makeEditable() *XMLElement {
+	e.XMLValue.makeEditable()
+	return e
+}
+
+////////////////////////////////////////////////////
+// elements (paths are relative to our children)
+
+// the first element at the end of the path, or an error naming the step which had no match
+func (e *XMLElement) At(path string) (element *XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.first(&e.XMLValue)
+}
+
+// every element at the end of the path (errors only if the path is malformed)
+func (e *XMLElement) AllAt(path string) (elements []*XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	elements = p.all(&e.XMLValue)
+	return
+}
+
+// sets the value of the first element at the end of the path (which must already exist, see EnsurePath)
+func (e *XMLElement) SetAt(path string, value any) (err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.set(&e.XMLValue, value)
+}
+
+// the first element at the end of the path, creating any missing elements along the way
+// key predicates are honored when creating, e.g. Item[Name=Sword] creates an Item with a Name child of Sword
+func (e *XMLElement) EnsurePath(path string) (element *XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.ensure(&e.XMLValue)
+}
+
+////////////////////////////////////////////////////
+// trees (paths start at the top level, so the first step names the root)
+
+// the first element at the end of the path, or an error naming the step which had no match
+func (tree *XMLTree) At(path string) (element *XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.first(&tree.Elements)
+}
+
+// every element at the end of the path (errors only if the path is malformed)
+func (tree *XMLTree) AllAt(path string) (elements []*XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	elements = p.all(&tree.Elements)
+	return
+}
+
+// sets the value of the first element at the end of the path (which must already exist, see EnsurePath)
+func (tree *XMLTree) SetAt(path string, value any) (err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.set(&tree.Elements, value)
+}
+
+// the first element at the end of the path, creating any missing elements along the way (except the root)
+func (tree *XMLTree) EnsurePath(path string) (element *XMLElement, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return
+	}
+	return p.ensure(&tree.Elements)
+}
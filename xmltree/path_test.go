@@ -0,0 +1,176 @@
+package xmltree
+
+import (
+	"errors"
+	"testing"
+)
+
+const pathTestXML = `<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>3</Armor></Item><Empty /></Root>`
+
+func TestAt(t *testing.T) {
+	tree := readTree(t, pathTestXML)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"Root/Item/Name", "Sword"},
+		{"Root/Item[2]/Name", "Shield"},
+		{"Root/Item[Name=Shield]/Armor", "3"},
+		{"Root/Item[@id=2]/Name", "Shield"},
+		{"Root/Item[Armor]/Name", "Shield"},
+		{"Root/*[@id]/Name", "Sword"},
+		{"Root/Item/Armor", "3"}, // the first Item has no Armor, so we go on to the next
+	}
+	for _, tt := range tests {
+		e, err := tree.At(tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if got := e.StringValue(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAtNotFound(t *testing.T) {
+	tree := readTree(t, pathTestXML)
+	_, err := tree.At("Root/Item[Name=Bow]/Damage")
+	var pe *PathError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("got %v, want a PathError for a missing element", err)
+	}
+	if pe.Step != 2 || pe.Text != "Item[Name=Bow]" {
+		t.Errorf("got step %d (%s), want step 2 (Item[Name=Bow])", pe.Step, pe.Text)
+	}
+
+	_, err = tree.At("Root/Item[")
+	if err == nil || errors.Is(err, ErrPathNotFound) {
+		t.Errorf("malformed path: got %v", err)
+	}
+}
+
+func TestAllAt(t *testing.T) {
+	tree := readTree(t, pathTestXML)
+	elements, err := tree.AllAt("Root/Item/Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range elements {
+		got = append(got, e.StringValue())
+	}
+	if len(got) != 2 || got[0] != "Sword" || got[1] != "Shield" {
+		t.Errorf("got %q", got)
+	}
+
+	root := tree.Elements.Elements()[0]
+	elements, err = root.AllAt("Item/Nothing")
+	if err != nil || len(elements) != 0 {
+		t.Errorf("got %d elements, %v", len(elements), err)
+	}
+}
+
+func TestSetAt(t *testing.T) {
+	tree := readTree(t, pathTestXML)
+	err := tree.SetAt("Root/Item[@id=2]/Armor", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetAt("Root/Empty", "now")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>4</Armor></Item><Empty>now</Empty></Root>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+
+	// children can't be replaced by a value
+	err = tree.SetAt("Root/Item", "x")
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Step != 2 {
+		t.Errorf("got %v, want an error at step 2", err)
+	}
+	if got := tree.String(); got != want {
+		t.Errorf("failed SetAt changed the tree: %s", got)
+	}
+}
+
+func TestSetAtEmptiedElement(t *testing.T) {
+	tree := readTree(t, `<Root><List><A /></List></Root>`)
+	list, err := tree.At("Root/List")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Elements()[0].Remove()
+	if list.IsSimple() {
+		t.Fatal("expected the emptied list to still hold a list")
+	}
+	err = tree.SetAt("Root/List", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.String(), `<Root><List>x</List></Root>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestEnsurePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"existing", "Root/Item[Name=Sword]/Damage", pathTestXML},
+		{"leaf", "Root/Item[@id=2]/Damage",
+			`<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>3</Armor><Damage /></Item><Empty /></Root>`},
+		{"keys", "Root/Item[Name=Bow][@id=3]/Range",
+			`<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>3</Armor></Item><Empty /><Item id="3"><Name>Bow</Name><Range /></Item></Root>`},
+		{"next index", "Root/Item[3]",
+			`<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>3</Armor></Item><Empty /><Item /></Root>`},
+		{"into empty", "Root/Empty/A/B",
+			`<Root><Item id="1"><Name>Sword</Name><Damage>5</Damage></Item><Item id="2"><Name>Shield</Name><Armor>3</Armor></Item><Empty><A><B /></A></Empty></Root>`},
+	}
+	for _, tt := range tests {
+		tree := readTree(t, pathTestXML)
+		e, err := tree.EnsurePath(tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if found, _ := tree.At(tt.path); found != e {
+			t.Errorf("%s: the element returned isn't the one at the path", tt.name)
+		}
+		if got := tree.String(); got != tt.want {
+			t.Errorf("%s: got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnsurePathFailureLeavesTree(t *testing.T) {
+	tests := []struct {
+		path string
+		step int
+	}{
+		{"Root/New/Item[2]", 3}, // New would be created, but its 2nd Item can't be
+		{"Root/New/*", 3},
+		{"Root/Item[4]/Name", 2},
+		{"Other/Item", 1},
+	}
+	for _, tt := range tests {
+		tree := readTree(t, pathTestXML)
+		e, err := tree.EnsurePath(tt.path)
+		var pe *PathError
+		if !errors.As(err, &pe) || e != nil {
+			t.Errorf("%s: got %v, %v, want a PathError", tt.path, e, err)
+			continue
+		}
+		if pe.Step != tt.step {
+			t.Errorf("%s: got step %d, want %d", tt.path, pe.Step, tt.step)
+		}
+		if got := tree.String(); got != pathTestXML {
+			t.Errorf("%s: failure changed the tree: %s", tt.path, got)
+		}
+	}
+}
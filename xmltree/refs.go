@@ -0,0 +1,341 @@
+package xmltree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// cross reference checking: elements which refer to others by key (e.g. <Weapon>LaserMk2</Weapon> to <Item><Name>LaserMk2</Name>)
+// rules are checked across every document added to a checker, so references may cross files
+
+// the values selected by Source must each match the key of some element selected by Target
+type RefRule struct {
+	Name      string  // how problems are labelled (defaults to "Source -> Target")
+	Source    string  // an xpath selecting the referring elements
+	SourceKey KeyFunc // the reference a source holds (defaults to its own value)
+	Target    string  // an xpath selecting the referable elements
+	TargetKey KeyFunc // the key a target is known by (defaults to its own value)
+}
+
+func (r *RefRule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Source + " -> " + r.Target
+}
+
+// where an element is: its document, slash path (see At) and source position
+type RefLocation struct {
+	Element  *XMLElement `json:"-"`
+	Document string      `json:"document,omitempty"`
+	Path     string      `json:"path"`
+	Position Position    `json:"-"`
+}
+
+func (l RefLocation) String() string {
+	s := l.Position.String() + ": " + l.Path
+	if l.Document != "" {
+		s = l.Document + ":" + s
+	}
+	return s
+}
+
+func (l RefLocation) MarshalJSON() ([]byte, error) {
+	type location RefLocation
+	return json.Marshal(struct {
+		location
+		Line   int `json:"line,omitempty"`
+		Column int `json:"column,omitempty"`
+	}{location(l), l.Position.Line, l.Position.Column})
+}
+
+type RefProblemKind int
+
+const (
+	RefDangling  RefProblemKind = iota // a reference to a key no target has
+	RefDuplicate                       // a key more than one target has
+	RefUnused                          // a target nothing refers to
+)
+
+func (k RefProblemKind) String() string {
+	switch k {
+	case RefDangling:
+		return "dangling reference"
+	case RefDuplicate:
+		return "duplicate key"
+	case RefUnused:
+		return "unused target"
+	}
+	return fmt.Sprintf("RefProblemKind(%d)", int(k))
+}
+
+type RefProblem struct {
+	Kind   RefProblemKind
+	Rule   string
+	Key    string
+	At     RefLocation   // the source (dangling), the first target with the key (duplicate), or the target (unused)
+	Others []RefLocation // the other targets with the same key (duplicate)
+}
+
+func (p RefProblem) String() string {
+	s := fmt.Sprintf("%s: %s: %s %q", p.At, p.Rule, p.Kind, p.Key)
+	for _, o := range p.Others {
+		s += "\n\talso at " + o.String()
+	}
+	return s
+}
+
+func (p RefProblem) Error() string {
+	return p.String()
+}
+
+// a resolved reference: a source and the target it refers to
+type RefEdge struct {
+	Rule string      `json:"rule"`
+	Key  string      `json:"key"`
+	From RefLocation `json:"from"`
+	To   RefLocation `json:"to"`
+}
+
+type RefReport struct {
+	Problems []RefProblem // by rule (its duplicate keys, dangling references, then unused targets), each in document order
+	Edges    []RefEdge    // every reference that resolved (to each target with its key)
+}
+
+// the problems of the given kind
+func (r *RefReport) Of(kind RefProblemKind) (problems []RefProblem) {
+	for _, p := range r.Problems {
+		if p.Kind == kind {
+			problems = append(problems, p)
+		}
+	}
+	return
+}
+
+// the dangling references and duplicate keys (joined), or nil
+// unused targets are not errors (data is often defined before anything uses it), see Of(RefUnused)
+func (r *RefReport) Err() error {
+	var errs []error
+	for _, p := range r.Problems {
+		if p.Kind != RefUnused {
+			errs = append(errs, p)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checks reference rules across a set of documents
+type RefChecker struct {
+	rules     []RefRule
+	documents []refDocument
+}
+
+type refDocument struct {
+	name string
+	tree *XMLTree
+}
+
+func NewRefChecker(rules ...RefRule) *RefChecker {
+	return &RefChecker{rules: rules}
+}
+
+// adds a rule to check
+func (c *RefChecker) AddRule(rule RefRule) {
+	c.rules = append(c.rules, rule)
+}
+
+// adds a document to check (name is how its locations are reported)
+func (c *RefChecker) AddTree(name string, tree *XMLTree) {
+	c.documents = append(c.documents, refDocument{name, tree})
+}
+
+// loads and adds a document to check
+func (c *RefChecker) AddFile(filename string) (err error) {
+	tree, err := LoadFromFile(filename)
+	if err != nil {
+		return
+	}
+	c.AddTree(filename, tree)
+	return
+}
+
+// checks the rules against a single tree
+func (tree *XMLTree) CheckRefs(rules ...RefRule) (report *RefReport, err error) {
+	c := NewRefChecker(rules...)
+	c.AddTree("", tree)
+	return c.Check()
+}
+
+// checks every rule across every document
+// the error is for rules which can't be run (e.g. an invalid xpath), problems with the data are in the report
+func (c *RefChecker) Check() (report *RefReport, err error) {
+	report = &RefReport{}
+	for i := range c.rules {
+		err = c.check(&c.rules[i], report)
+		if err != nil {
+			report = nil
+			return
+		}
+	}
+	return
+}
+
+type refTarget struct {
+	refKeyed
+	used bool
+}
+
+func (c *RefChecker) check(rule *RefRule, report *RefReport) (err error) {
+	name := rule.String()
+	sources, err := c.locate(rule.Source, rule.SourceKey)
+	if err != nil {
+		return fmt.Errorf("%s: source: %w", name, err)
+	}
+	targets, err := c.locate(rule.Target, rule.TargetKey)
+	if err != nil {
+		return fmt.Errorf("%s: target: %w", name, err)
+	}
+
+	byKey := map[string][]*refTarget{}
+	var keys []string
+	var all []*refTarget
+	for _, t := range targets {
+		target := &refTarget{refKeyed: t}
+		if byKey[t.key] == nil {
+			keys = append(keys, t.key)
+		}
+		byKey[t.key] = append(byKey[t.key], target)
+		all = append(all, target)
+	}
+	for _, key := range keys {
+		if matches := byKey[key]; len(matches) > 1 {
+			others := make([]RefLocation, 0, len(matches)-1)
+			for _, m := range matches[1:] {
+				others = append(others, m.RefLocation)
+			}
+			report.Problems = append(report.Problems, RefProblem{Kind: RefDuplicate, Rule: name, Key: key, At: matches[0].RefLocation, Others: others})
+		}
+	}
+
+	for _, s := range sources {
+		matches := byKey[s.key]
+		if len(matches) == 0 {
+			report.Problems = append(report.Problems, RefProblem{Kind: RefDangling, Rule: name, Key: s.key, At: s.RefLocation})
+			continue
+		}
+		for _, m := range matches {
+			m.used = true
+			report.Edges = append(report.Edges, RefEdge{Rule: name, Key: s.key, From: s.RefLocation, To: m.RefLocation})
+		}
+	}
+
+	for _, t := range all {
+		if !t.used {
+			report.Problems = append(report.Problems, RefProblem{Kind: RefUnused, Rule: name, Key: t.key, At: t.RefLocation})
+		}
+	}
+	return
+}
+
+type refKeyed struct {
+	RefLocation
+	key string
+}
+
+// every element the xpath selects in every document, with its key (elements without one are skipped)
+func (c *RefChecker) locate(xpath string, key KeyFunc) (located []refKeyed, err error) {
+	x, err := CompileXPath(xpath)
+	if err != nil {
+		return
+	}
+	for _, doc := range c.documents {
+		var elements []*XMLElement
+		elements, err = x.SelectElements(doc.tree)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", doc.name, err)
+			return
+		}
+		for _, e := range elements {
+			k, ok := keyOf(e, key)
+			if !ok {
+				continue
+			}
+			located = append(located, refKeyed{RefLocation{Element: e, Document: doc.name, Path: e.Path(), Position: e.Position()}, k})
+		}
+	}
+	return
+}
+
+// the element's key (trimmed, and blank keys are no key at all)
+func keyOf(e *XMLElement, key KeyFunc) (k string, ok bool) {
+	if key == nil {
+		key = KeyByValue
+	}
+	k, ok = key(e)
+	k = strings.TrimSpace(k)
+	return k, ok && k != ""
+}
+
+////////////////////////////////////////////////////
+// exporting the reference graph
+
+// writes the edges as a graphviz digraph (nodes are element locations, edges are labelled with their key)
+func (r *RefReport) WriteDOT(w io.Writer) (err error) {
+	sb := &strings.Builder{}
+	sb.WriteString("digraph refs {\n")
+	var nodes []string
+	seen := map[string]bool{}
+	node := func(l RefLocation) string {
+		id := l.Document + ":" + l.Path
+		if !seen[id] {
+			seen[id] = true
+			nodes = append(nodes, id)
+		}
+		return id
+	}
+	var edges []string
+	for _, e := range r.Edges {
+		edges = append(edges, fmt.Sprintf("\t%s -> %s [label=%s];\n", dotQuote(node(e.From)), dotQuote(node(e.To)), dotQuote(e.Key)))
+	}
+	for _, id := range nodes {
+		fmt.Fprintf(sb, "\t%s;\n", dotQuote(id))
+	}
+	for _, e := range slices.Compact(edges) {
+		sb.WriteString(e)
+	}
+	sb.WriteString("}\n")
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// writes the edges and problems as json
+func (r *RefReport) WriteJSON(w io.Writer) (err error) {
+	type problem struct {
+		Kind   string        `json:"kind"`
+		Rule   string        `json:"rule"`
+		Key    string        `json:"key"`
+		At     RefLocation   `json:"at"`
+		Others []RefLocation `json:"others,omitempty"`
+	}
+	out := struct {
+		Edges    []RefEdge `json:"edges"`
+		Problems []problem `json:"problems"`
+	}{Edges: r.Edges, Problems: []problem{}}
+	if out.Edges == nil {
+		out.Edges = []RefEdge{}
+	}
+	for _, p := range r.Problems {
+		out.Problems = append(out.Problems, problem{p.Kind.String(), p.Rule, p.Key, p.At, p.Others})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
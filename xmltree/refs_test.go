@@ -0,0 +1,143 @@
+package xmltree
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const refsItemsXML = `<Items>
+	<Item><Name>Laser</Name></Item>
+	<Item><Name>Cannon</Name></Item>
+	<Item><Name>Cannon</Name></Item>
+	<Item><Name>Spare</Name></Item>
+	<Item><Name> </Name></Item>
+</Items>`
+
+const refsShipsXML = `<Ships>
+	<Ship id="a"><Weapon>Laser</Weapon><Weapon>Cannon</Weapon></Ship>
+	<Ship id="b"><Weapon>Torpedo</Weapon><Weapon> Laser </Weapon></Ship>
+</Ships>`
+
+var weaponRule = RefRule{Source: "//Weapon", Target: "//Item", TargetKey: KeyByChild("Name")}
+
+// the problems as "kind key at path" lines
+func refProblems(report *RefReport) (lines []string) {
+	for _, p := range report.Problems {
+		line := p.Kind.String() + " " + p.Key + " at " + p.At.Document + ":" + p.At.Path
+		for _, o := range p.Others {
+			line += " and " + o.Document + ":" + o.Path
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+func TestRefChecker(t *testing.T) {
+	c := NewRefChecker(weaponRule)
+	c.AddTree("items", readTree(t, refsItemsXML))
+	c.AddTree("ships", readTree(t, refsShipsXML))
+	report, err := c.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"duplicate key Cannon at items:Items/Item[2] and items:Items/Item[3]",
+		"dangling reference Torpedo at ships:Ships/Ship[2]/Weapon[1]",
+		"unused target Spare at items:Items/Item[4]",
+	}
+	got := refProblems(report)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a reference to a duplicated key resolves to each target, and keys are trimmed
+	if got := len(report.Edges); got != 4 {
+		t.Errorf("got %d edges, want 4", got)
+	}
+	for _, e := range report.Edges {
+		if e.Rule != "//Weapon -> //Item" || e.From.Document != "ships" || e.To.Document != "items" {
+			t.Errorf("unexpected edge %+v", e)
+		}
+	}
+
+	if len(report.Of(RefDangling)) != 1 || len(report.Of(RefUnused)) != 1 {
+		t.Error("Of")
+	}
+	if err := report.Err(); err == nil || strings.Contains(err.Error(), "unused") {
+		t.Errorf("Err should report dangling references and duplicates only, got %v", err)
+	}
+}
+
+func TestCheckRefsSingleTree(t *testing.T) {
+	tree := readTree(t, `<Data><Item id="1" /><Item id="2" /><Use ref="2" /><Use ref="1" /></Data>`)
+	report, err := tree.CheckRefs(RefRule{Name: "uses", Source: "//Use", SourceKey: KeyByAttr("ref"), Target: "//Item", TargetKey: KeyByAttr("id")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 || report.Err() != nil {
+		t.Errorf("got problems %q", refProblems(report))
+	}
+	if len(report.Edges) != 2 || report.Edges[0].Rule != "uses" || report.Edges[0].To.Path != "Data/Item[2]" {
+		t.Errorf("got edges %+v", report.Edges)
+	}
+	if report.Edges[0].From.Position.Line != 1 {
+		t.Errorf("got position %s", report.Edges[0].From.Position)
+	}
+}
+
+func TestRefCheckerInvalidRule(t *testing.T) {
+	tree := readTree(t, refsItemsXML)
+	report, err := tree.CheckRefs(RefRule{Source: "//Weapon[", Target: "//Item"})
+	if err == nil || report != nil {
+		t.Errorf("got %v, %v, want an error for an invalid xpath", report, err)
+	}
+}
+
+func TestRefReportExport(t *testing.T) {
+	tree := readTree(t, `<Data><Item>A</Item><Use>A</Use><Use>B</Use></Data>`)
+	report, err := tree.CheckRefs(RefRule{Source: "//Use", Target: "//Item"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := &strings.Builder{}
+	err = report.WriteDOT(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "digraph refs {\n\t\":Data/Use[1]\";\n\t\":Data/Item\";\n\t\":Data/Use[1]\" -> \":Data/Item\" [label=\"A\"];\n}\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	sb.Reset()
+	err = report.WriteJSON(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Edges []struct {
+			Key  string
+			From struct {
+				Path string
+				Line int
+			}
+		}
+		Problems []struct {
+			Kind string
+			Key  string
+		}
+	}
+	err = json.Unmarshal([]byte(sb.String()), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Edges) != 1 || out.Edges[0].Key != "A" || out.Edges[0].From.Path != "Data/Use[1]" || out.Edges[0].From.Line != 1 {
+		t.Errorf("got edges %+v", out.Edges)
+	}
+	if len(out.Problems) != 1 || out.Problems[0].Kind != "dangling reference" || out.Problems[0].Key != "B" {
+		t.Errorf("got problems %+v", out.Problems)
+	}
+}
@@ -0,0 +1,234 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// selections: bulk operations over query results
+// every operation is applied to every element, and errors are collected (see Err) rather than stopping the chain
+// operations which select new elements return a new selection (carrying the errors so far), the rest return us
+
+type Selection struct {
+	elements []*XMLElement
+	errs     []error
+}
+
+// a selection of the given elements
+func NewSelection(elements ...*XMLElement) *Selection {
+	return &Selection{elements: elements}
+}
+
+// a selection of every element matching the css selector (see SelectAll)
+func (tree *XMLTree) Query(selector string) *Selection {
+	elements, err := tree.SelectAll(selector)
+	return (&Selection{elements: elements}).fail(err)
+}
+
+// a selection of every element the xpath selects (see XPathElements)
+func (tree *XMLTree) QueryXPath(path string) *Selection {
+	elements, err := tree.XPathElements(path)
+	return (&Selection{elements: elements}).fail(err)
+}
+
+// a selection of every element at the end of the slash path (see AllAt)
+func (tree *XMLTree) QueryAt(path string) *Selection {
+	elements, err := tree.AllAt(path)
+	return (&Selection{elements: elements}).fail(err)
+}
+
+// a selection of every descendant matching the css selector (see SelectAll)
+func (e *XMLElement) Query(selector string) *Selection {
+	elements, err := e.SelectAll(selector)
+	return (&Selection{elements: elements}).fail(err)
+}
+
+// a selection of every element at the end of the slash path (see AllAt)
+func (e *XMLElement) QueryAt(path string) *Selection {
+	elements, err := e.AllAt(path)
+	return (&Selection{elements: elements}).fail(err)
+}
+
+func (s *Selection) fail(err error) *Selection {
+	if err != nil {
+		s.errs = append(s.errs, err)
+	}
+	return s
+}
+
+// records any error against the element it happened to
+func (s *Selection) failAt(e *XMLElement, err error) {
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", e.Path(), err))
+	}
+}
+
+// a new selection of the given elements, carrying our errors along
+func (s *Selection) derive(elements []*XMLElement) *Selection {
+	return &Selection{elements: elements, errs: s.errs[:len(s.errs):len(s.errs)]}
+}
+
+////////////////////////////////////////////////////
+// results
+
+// the selected elements
+func (s *Selection) Elements() []*XMLElement {
+	return s.elements
+}
+
+// how many elements are selected
+func (s *Selection) Len() int {
+	return len(s.elements)
+}
+
+// the first selected element (nil if there are none)
+func (s *Selection) First() *XMLElement {
+	if len(s.elements) == 0 {
+		return nil
+	}
+	return s.elements[0]
+}
+
+// every error so far (joined), or nil
+func (s *Selection) Err() error {
+	return errors.Join(s.errs...)
+}
+
+// every error so far
+func (s *Selection) Errors() []error {
+	return s.errs
+}
+
+////////////////////////////////////////////////////
+// selecting
+
+// the selected elements your finder responds true to
+func (s *Selection) Filter(finder Finder) *Selection {
+	var elements []*XMLElement
+	for _, e := range s.elements {
+		if finder(e) {
+			elements = append(elements, e)
+		}
+	}
+	return s.derive(elements)
+}
+
+// the selected elements which have a child with the given tag and value
+func (s *Selection) WithChildValue(tag, value string) *Selection {
+	return s.Filter(func(e *XMLElement) bool { return e.hasSimpleChild(tag, value) })
+}
+
+// the selected elements which have the named attribute set to value
+func (s *Selection) WithAttr(name, value string) *Selection {
+	return s.Filter(func(e *XMLElement) bool { return e.MatchesAttr(name, value) })
+}
+
+// the child elements with the given tag of every selected element (any tag if tag is "" or *)
+func (s *Selection) Children(tag string) *Selection {
+	var elements []*XMLElement
+	for _, e := range s.elements {
+		for _, c := range e.Children() {
+			if tag == "" || tag == "*" || c.Name.Local == tag {
+				elements = append(elements, c)
+			}
+		}
+	}
+	return s.derive(elements)
+}
+
+// the parents of the selected elements (each only once, and top level elements have none)
+func (s *Selection) Parent() *Selection {
+	var elements []*XMLElement
+	seen := map[*XMLElement]bool{}
+	for _, e := range s.elements {
+		if p := e.Parent(); p != nil && !seen[p] {
+			seen[p] = true
+			elements = append(elements, p)
+		}
+	}
+	return s.derive(elements)
+}
+
+////////////////////////////////////////////////////
+// bulk operations
+
+// calls visit for every selected element (collecting its errors)
+func (s *Selection) Each(visit func(*XMLElement) error) *Selection {
+	for _, e := range s.elements {
+		s.failAt(e, visit(e))
+	}
+	return s
+}
+
+// sets the value of every selected element
+func (s *Selection) SetValue(value any) *Selection {
+	return s.Each(func(e *XMLElement) error { return e.setValueUnlessParent(value) })
+}
+
+// sets (or creates) the given child of every selected element (see EnsureChildValue)
+func (s *Selection) SetChild(tag string, value any) *Selection {
+	return s.Each(func(e *XMLElement) (err error) {
+		_, err = e.EnsureChildValue(tag, value)
+		return
+	})
+}
+
+// scales the given child of every selected element (see ScaleChildBy)
+func (s *Selection) ScaleChild(tag string, scale float64) *Selection {
+	return s.Each(func(e *XMLElement) error { return e.ScaleChildBy(tag, scale) })
+}
+
+// adjusts the given child of every selected element (see AdjustChildBy)
+func (s *Selection) AdjustChild(tag string, adjustment float64) *Selection {
+	return s.Each(func(e *XMLElement) error { return e.AdjustChildBy(tag, adjustment) })
+}
+
+// removes the given child from every selected element (see RemoveByTag)
+func (s *Selection) RemoveChild(tag string) *Selection {
+	return s.Each(func(e *XMLElement) error { return e.RemoveByTag(tag) })
+}
+
+// sets the named attribute of every selected element (see SetAttribute)
+func (s *Selection) Attr(name string, value any) *Selection {
+	return s.Each(func(e *XMLElement) error {
+		if !IsValidName(name) {
+			return notWellFormed("invalid attribute name %q", name)
+		}
+		e.SetAttribute(name, value)
+		return nil
+	})
+}
+
+// removes the named attribute from every selected element
+func (s *Selection) RemoveAttr(name string) *Selection {
+	return s.Each(func(e *XMLElement) error {
+		e.RemoveAttribute(name)
+		return nil
+	})
+}
+
+// scales the named attribute of every selected element (see ScaleAttrBy)
+func (s *Selection) ScaleAttr(name string, scale float64) *Selection {
+	return s.Each(func(e *XMLElement) error { return e.ScaleAttrBy(name, scale) })
+}
+
+// removes every selected element from its parent (the selection still holds them, e.g. to re-insert elsewhere)
+func (s *Selection) Remove() *Selection {
+	return s.Each(func(e *XMLElement) error { return e.Remove() })
+}
+
+// wraps every selected element in a new element with the given tag (which takes its place in its parent)
+func (s *Selection) Wrap(tag string) *Selection {
+	return s.Each(func(e *XMLElement) (err error) {
+		wrapper := MakeElement(tag)
+		err = e.InsertBefore(wrapper)
+		if err != nil {
+			return
+		}
+		err = e.Remove()
+		if err != nil {
+			return
+		}
+		return wrapper.makeEditable().Append(e)
+	})
+}
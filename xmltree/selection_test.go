@@ -0,0 +1,119 @@
+package xmltree
+
+import (
+	"testing"
+)
+
+const selectionTestXML = `<Root><Item kind="blade"><Name>Sword</Name><Damage>10</Damage></Item><Item kind="blunt"><Name>Mace</Name><Damage>8</Damage></Item><Item><Name>Shield</Name><Armor>3</Armor></Item></Root>`
+
+func TestSelectionQueries(t *testing.T) {
+	tree := readTree(t, selectionTestXML)
+	tests := []struct {
+		name string
+		s    *Selection
+		want int
+	}{
+		{"css", tree.Query("Item"), 3},
+		{"xpath", tree.QueryXPath("//Item[Damage]"), 2},
+		{"path", tree.QueryAt("Root/Item/Name"), 3},
+		{"filter", tree.QueryAt("Root/Item").Filter(func(e *XMLElement) bool { return e.HasAttribute("kind") }), 2},
+		{"child value", tree.QueryAt("Root/Item").WithChildValue("Name", "Mace"), 1},
+		{"attr", tree.QueryAt("Root/Item").WithAttr("kind", "blade"), 1},
+		{"children", tree.QueryAt("Root/Item").Children("Damage"), 2},
+		{"all children", tree.QueryAt("Root/Item").Children(""), 6},
+		{"parent", tree.QueryAt("Root/Item/Name").Parent(), 3},
+		{"parents once", tree.QueryAt("Root/Item").Parent(), 1},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Err(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := tt.s.Len(); got != tt.want {
+			t.Errorf("%s: got %d elements, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	if s := tree.Query("Item[[["); s.Err() == nil || s.Len() != 0 {
+		t.Errorf("bad selector: got %d elements, %v", s.Len(), s.Err())
+	}
+}
+
+func TestSelectionBulkEdits(t *testing.T) {
+	tree := readTree(t, selectionTestXML)
+	s := tree.QueryAt("Root/Item").WithChildValue("Name", "Sword").ScaleChild("Damage", 1.5).SetChild("Weight", 4).Attr("kind", "edged")
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	tree.QueryAt("Root/Item[Name=Mace]").AdjustChild("Damage", -3).RemoveAttr("kind")
+	tree.QueryAt("Root/Item[Armor]").RemoveChild("Armor")
+
+	want := `<Root><Item kind="edged"><Name>Sword</Name><Damage>15</Damage><Weight>4</Weight></Item><Item><Name>Mace</Name><Damage>5</Damage></Item><Item><Name>Shield</Name></Item></Root>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestSelectionCollectsErrors(t *testing.T) {
+	tree := readTree(t, selectionTestXML)
+
+	// the shield has no damage to scale, but the others are still scaled
+	s := tree.QueryAt("Root/Item").ScaleChild("Damage", 2)
+	if got := len(s.Errors()); got != 1 {
+		t.Errorf("got %d errors (%v), want 1", got, s.Err())
+	}
+	if v, _ := tree.At("Root/Item[Name=Mace]/Damage"); v.StringValue() != "16" {
+		t.Errorf("got %s, want 16", v.StringValue())
+	}
+
+	// derived selections carry the errors along, without sharing them
+	d := s.Children("Name").Attr("1st", "x")
+	if got := len(d.Errors()); got != 4 {
+		t.Errorf("got %d errors (%v), want 4", got, d.Err())
+	}
+	if got := len(s.Errors()); got != 1 {
+		t.Errorf("deriving changed our errors: got %d", got)
+	}
+}
+
+func TestSelectionSetValue(t *testing.T) {
+	tree := readTree(t, selectionTestXML)
+	s := tree.QueryAt("Root/Item/Damage").SetValue(1)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.QueryAt("Root/Item").WithChildValue("Damage", "1").Len(); got != 2 {
+		t.Errorf("got %d, want 2", got)
+	}
+
+	// elements with children aren't flattened
+	s = tree.QueryAt("Root/Item").SetValue("x")
+	if got := len(s.Errors()); got != 3 {
+		t.Errorf("got %d errors, want 3", got)
+	}
+	if got := len(tree.QueryAt("Root/Item/Name").Elements()); got != 3 {
+		t.Errorf("children were lost: %s", tree.String())
+	}
+}
+
+func TestSelectionRemoveAndWrap(t *testing.T) {
+	tree := readTree(t, selectionTestXML)
+	removed := tree.QueryAt("Root/Item[Armor]").Remove()
+	if err := removed.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if removed.Len() != 1 || removed.First().Parent() != nil {
+		t.Error("the selection should still hold the removed element")
+	}
+
+	err := tree.QueryAt("Root/Item/Damage").Wrap("Stats").Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Root><Item kind="blade"><Name>Sword</Name><Stats><Damage>10</Damage></Stats></Item><Item kind="blunt"><Name>Mace</Name><Stats><Damage>8</Damage></Stats></Item></Root>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+	if got := tree.QueryAt("Root/Item/Stats/Damage").Len(); got != 2 {
+		t.Errorf("got %d wrapped elements, want 2", got)
+	}
+}
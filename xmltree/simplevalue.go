@@ -17,8 +17,15 @@ func CreateString(value string) SimpleValue {
 	return SimpleValue{value: value}
 }
 
+// note: numbers are formatted by the tree's NumberFormatter (like SetValue)
 func (sv SimpleValue) ApplyTo(e *XMLValue) {
-	if e != nil {
+	if e == nil {
+		return
+	}
+	switch t := sv.value.(type) {
+	case float64:
+		e.SetValue(t)
+	default:
 		e.SetString(sv.String())
 	}
 }
@@ -0,0 +1,752 @@
+package xmltree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sql query evaluation (see sql-parse.go for the language)
+
+// a compiled sql query (safe to reuse across trees and goroutines)
+type SQLQuery struct {
+	source    string
+	columns   []sqlSelect
+	from      []*sqlSource
+	on        sqlCond
+	joinLeft  *sqlColumn // the ON column of the FROM rows
+	joinRight *sqlColumn // the ON column of the JOIN rows
+	where     sqlCond
+	groupBy   []sqlExpr
+	orderBy   []sqlOrder
+	limit     int // -1 for none
+	offset    int
+	grouped   bool // true if there's a GROUP BY or any aggregate
+}
+
+type sqlSelect struct {
+	expr  sqlExpr
+	name  string
+	star  bool
+	alias string // for alias.* (empty for every source)
+}
+
+type sqlSource struct {
+	text  string
+	path  *XPath
+	alias string
+}
+
+type sqlOrder struct {
+	expr sqlExpr
+	desc bool
+}
+
+func CompileSQL(query string) (q *SQLQuery, err error) {
+	q, err = parseSQL(query)
+	if err != nil {
+		q = nil
+	}
+	return
+}
+
+// like CompileSQL, but panics if the query is invalid (handy for package level vars)
+func MustCompileSQL(query string) *SQLQuery {
+	q, err := CompileSQL(query)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *SQLQuery) String() string {
+	return q.source
+}
+
+// runs the query against the tree
+func (tree *XMLTree) SQL(query string) (table *Table, err error) {
+	q, err := CompileSQL(query)
+	if err != nil {
+		return
+	}
+	return q.Run(tree)
+}
+
+////////////////////////////////////////////////////
+// values
+
+type sqlValue struct {
+	s    string
+	null bool
+}
+
+func (v sqlValue) number() (f float64, ok bool) {
+	if v.null {
+		return
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v.s), 64)
+	return f, err == nil
+}
+
+// nulls first, then numerically if both are numbers, else textually
+func compareSQLValues(a, b sqlValue) int {
+	switch {
+	case a.null || b.null:
+		if a.null == b.null {
+			return 0
+		}
+		if a.null {
+			return -1
+		}
+		return 1
+	}
+	if x, ok := a.number(); ok {
+		if y, ok := b.number(); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	return strings.Compare(a.s, b.s)
+}
+
+// the key a value joins or groups by (numbers by their value, so 1.0 joins with 1)
+func (v sqlValue) key() string {
+	if v.null {
+		return "\x01"
+	}
+	if f, ok := v.number(); ok {
+		return shortestNumber(f)
+	}
+	return v.s
+}
+
+// a row is one element per source (FROM, then JOIN)
+type sqlContext struct {
+	row     []*XMLElement
+	group   [][]*XMLElement
+	grouped bool
+}
+
+type sqlExpr interface {
+	eval(c *sqlContext) (sqlValue, error)
+	isAggregate() bool
+	String() string
+}
+
+type sqlCond interface {
+	test(c *sqlContext) (bool, error)
+	hasAggregate() bool
+}
+
+////////////////////////////////////////////////////
+// expressions
+
+type sqlLiteral struct {
+	value  sqlValue
+	text   string
+	number bool // written as a number (not a quoted string)
+}
+
+func (e *sqlLiteral) eval(c *sqlContext) (sqlValue, error) { return e.value, nil }
+func (e *sqlLiteral) isAggregate() bool                    { return false }
+func (e *sqlLiteral) String() string                       { return e.text }
+
+// true if the expression is a number literal
+func isSQLNumber(e sqlExpr) bool {
+	literal, ok := e.(*sqlLiteral)
+	return ok && literal.number
+}
+
+type sqlColumn struct {
+	text      string
+	offset    int
+	source    int
+	path      *elementPath // nil for the row itself
+	attr      string       // the attribute of the element at path (if any)
+	orderOnly bool         // only used by ORDER BY (where it may instead name an output column)
+	err       error        // why an ORDER BY column couldn't be resolved (reported if it's evaluated)
+}
+
+func (e *sqlColumn) isAggregate() bool { return false }
+func (e *sqlColumn) String() string    { return e.text }
+
+func (e *sqlColumn) eval(c *sqlContext) (v sqlValue, err error) {
+	if e.err != nil {
+		err = e.err
+		return
+	}
+	v.null = true
+	if e.source >= len(c.row) || c.row[e.source] == nil {
+		return
+	}
+
+	element := c.row[e.source]
+	if e.path != nil {
+		element, err = e.path.first(&element.XMLValue)
+		if err != nil {
+			err = nil
+			return
+		}
+	}
+
+	if e.attr != "" {
+		v.s, v.null = element.Attribute(e.attr)
+		v.null = !v.null
+		return
+	}
+
+	v.s, v.null = element.GetStringValue()
+	v.null = !v.null
+	return
+}
+
+var sqlAggregates = map[string]bool{"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true, "MEDIAN": true}
+
+type sqlAggregate struct {
+	fn     string
+	column *sqlColumn // nil for COUNT(*)
+}
+
+func (e *sqlAggregate) isAggregate() bool { return true }
+
+func (e *sqlAggregate) String() string {
+	if e.column == nil {
+		return e.fn + "(*)"
+	}
+	return e.fn + "(" + e.column.String() + ")"
+}
+
+func (e *sqlAggregate) eval(c *sqlContext) (v sqlValue, err error) {
+	if e.column == nil {
+		v.s = strconv.Itoa(len(c.group))
+		return
+	}
+
+	// nulls are ignored, everything else must be a number (unless we're just counting)
+	st := newStats()
+	count := 0
+	for _, row := range c.group {
+		var value sqlValue
+		value, err = e.column.eval(&sqlContext{row: row})
+		if err != nil {
+			return
+		}
+		if value.null {
+			continue
+		}
+		count++
+		if e.fn == "COUNT" {
+			continue
+		}
+		st.add(row[e.column.source], func(*XMLElement) (float64, error) {
+			f, ok := value.number()
+			if !ok {
+				return 0, fmt.Errorf("%s is not a number: %q", e.column, value.s)
+			}
+			return f, nil
+		})
+	}
+
+	err = st.Err()
+	if err != nil {
+		err = fmt.Errorf("%s: %w", e, err)
+		return
+	}
+
+	v.null = st.Count == 0
+	switch e.fn {
+	case "COUNT":
+		v.s, v.null = strconv.Itoa(count), false
+	case "SUM":
+		v.s = shortestNumber(st.Sum)
+	case "MIN":
+		v.s = shortestNumber(st.Min)
+	case "MAX":
+		v.s = shortestNumber(st.Max)
+	case "AVG":
+		v.s = shortestNumber(st.Mean)
+	case "MEDIAN":
+		v.s = shortestNumber(st.Median())
+	}
+	if v.null {
+		v.s = ""
+	}
+	return
+}
+
+////////////////////////////////////////////////////
+// conditions
+
+type sqlCompare struct {
+	op          string
+	left, right sqlExpr
+}
+
+func (e *sqlCompare) hasAggregate() bool { return e.left.isAggregate() || e.right.isAggregate() }
+
+func (e *sqlCompare) test(c *sqlContext) (ok bool, err error) {
+	a, err := e.left.eval(c)
+	if err != nil {
+		return
+	}
+	b, err := e.right.eval(c)
+	if err != nil || a.null || b.null {
+		return
+	}
+
+	// comparing with a number is always numeric (so "10" > 9), and a value which isn't a number never matches
+	var n int
+	if isSQLNumber(e.left) || isSQLNumber(e.right) {
+		x, xok := a.number()
+		y, yok := b.number()
+		if !xok || !yok {
+			return
+		}
+		n = cmp.Compare(x, y)
+	} else {
+		n = compareSQLValues(a, b)
+	}
+	switch e.op {
+	case "=":
+		ok = n == 0
+	case "!=", "<>":
+		ok = n != 0
+	case "<":
+		ok = n < 0
+	case "<=":
+		ok = n <= 0
+	case ">":
+		ok = n > 0
+	case ">=":
+		ok = n >= 0
+	}
+	return
+}
+
+type sqlIsNull struct {
+	expr sqlExpr
+	not  bool
+}
+
+func (e *sqlIsNull) hasAggregate() bool { return e.expr.isAggregate() }
+
+func (e *sqlIsNull) test(c *sqlContext) (ok bool, err error) {
+	v, err := e.expr.eval(c)
+	return v.null != e.not, err
+}
+
+type sqlLike struct {
+	expr    sqlExpr
+	pattern *regexp.Regexp
+	not     bool
+}
+
+func newSQLLike(expr sqlExpr, pattern string, not bool) (like *sqlLike, err error) {
+	sb := &strings.Builder{}
+	sb.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	like = &sqlLike{expr: expr, not: not}
+	like.pattern, err = regexp.Compile(sb.String())
+	return
+}
+
+func (e *sqlLike) hasAggregate() bool { return e.expr.isAggregate() }
+
+func (e *sqlLike) test(c *sqlContext) (ok bool, err error) {
+	v, err := e.expr.eval(c)
+	if err != nil || v.null {
+		return
+	}
+	return e.pattern.MatchString(v.s) != e.not, nil
+}
+
+type sqlLogical struct {
+	or          bool
+	left, right sqlCond
+}
+
+func (e *sqlLogical) hasAggregate() bool { return e.left.hasAggregate() || e.right.hasAggregate() }
+
+func (e *sqlLogical) test(c *sqlContext) (ok bool, err error) {
+	ok, err = e.left.test(c)
+	if err != nil || ok == e.or {
+		return
+	}
+	return e.right.test(c)
+}
+
+type sqlNot struct {
+	cond sqlCond
+}
+
+func (e *sqlNot) hasAggregate() bool { return e.cond.hasAggregate() }
+
+func (e *sqlNot) test(c *sqlContext) (ok bool, err error) {
+	ok, err = e.cond.test(c)
+	return !ok, err
+}
+
+////////////////////////////////////////////////////
+// compiling
+
+// binds columns to their sources and checks what the parser couldn't
+func (q *SQLQuery) resolve(p *sqlParser) (err error) {
+	aliases := map[string]int{}
+	for i, source := range q.from {
+		if source.alias == "" {
+			continue
+		}
+		if _, dup := aliases[source.alias]; dup {
+			return p.failAt(0, "alias %s is used twice", source.alias)
+		}
+		aliases[source.alias] = i
+	}
+
+	for _, c := range p.columns {
+		e := c.resolve(aliases)
+		if e == nil {
+			continue
+		}
+		if !c.orderOnly {
+			return p.failAt(c.offset, "%v", e)
+		}
+		c.err = e
+	}
+
+	for _, column := range q.columns {
+		if _, ok := aliases[column.alias]; column.star && column.alias != "" && !ok {
+			return p.failAt(0, "unknown alias %s in %s.*", column.alias, column.alias)
+		}
+		if column.expr != nil && column.expr.isAggregate() {
+			q.grouped = true
+		}
+	}
+	for _, order := range q.orderBy {
+		if order.expr.isAggregate() {
+			q.grouped = true
+		}
+	}
+	if len(q.groupBy) != 0 {
+		q.grouped = true
+	}
+	for _, expr := range q.groupBy {
+		if expr.isAggregate() {
+			return p.failAt(0, "cannot GROUP BY an aggregate (%s)", expr)
+		}
+	}
+	if q.where != nil && q.where.hasAggregate() {
+		return p.failAt(0, "aggregates are not allowed in WHERE")
+	}
+
+	if q.on != nil {
+		compare, ok := q.on.(*sqlCompare)
+		var left, right *sqlColumn
+		if ok {
+			left, _ = compare.left.(*sqlColumn)
+			right, _ = compare.right.(*sqlColumn)
+		}
+		if !ok || compare.op != "=" || left == nil || right == nil || left.source == right.source {
+			return p.failAt(0, "JOIN ... ON must compare a column of each source with =")
+		}
+		if left.source == 1 {
+			left, right = right, left
+		}
+		q.joinLeft, q.joinRight = left, right
+	}
+
+	return
+}
+
+// binds us to our source and parses our path
+func (c *sqlColumn) resolve(aliases map[string]int) (err error) {
+	rest := c.text
+	if i := strings.IndexByte(rest, '.'); i > 0 {
+		if source, ok := aliases[rest[:i]]; ok {
+			c.source, rest = source, rest[i+1:]
+		}
+	}
+
+	// a final @attr step is an attribute of the element at the path before it
+	if strings.HasPrefix(rest, "@") {
+		c.attr, rest = rest[1:], ""
+	} else if i := strings.LastIndex(rest, "/@"); i != -1 && !strings.ContainsAny(rest[i:], "[]") {
+		c.attr, rest = rest[i+2:], rest[:i]
+	}
+	if c.attr != "" && !IsValidName(c.attr) {
+		return fmt.Errorf("invalid attribute name %q in column %s", c.attr, c.text)
+	}
+
+	if rest == "" && c.attr == "" {
+		return fmt.Errorf("missing column name in %s", c.text)
+	}
+	if rest != "" && rest != "." {
+		c.path, err = parsePath(rest)
+	}
+	return
+}
+
+////////////////////////////////////////////////////
+// running
+
+func (q *SQLQuery) Run(tree *XMLTree) (table *Table, err error) {
+	rows, err := q.rows(tree)
+	if err != nil {
+		return
+	}
+
+	// filter
+	if q.where != nil {
+		kept := rows[:0]
+		for _, row := range rows {
+			var ok bool
+			ok, err = q.where.test(&sqlContext{row: row})
+			if err != nil {
+				return
+			}
+			if ok {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	// one context per row, or per group
+	contexts, err := q.contexts(rows)
+	if err != nil {
+		return
+	}
+
+	columns := q.expandColumns(rows)
+	table = &Table{}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, column.name)
+	}
+
+	// evaluate every output column and order key
+	type result struct {
+		values []sqlValue
+		keys   []sqlValue
+	}
+	results := make([]result, len(contexts))
+	for i, c := range contexts {
+		r := &results[i]
+		for _, column := range columns {
+			var v sqlValue
+			v, err = column.expr.eval(c)
+			if err != nil {
+				return
+			}
+			r.values = append(r.values, v)
+		}
+		for _, order := range q.orderBy {
+			var v sqlValue
+			v, err = q.orderValue(order.expr, columns, r.values, c)
+			if err != nil {
+				return
+			}
+			r.keys = append(r.keys, v)
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b result) int {
+		for i, order := range q.orderBy {
+			n := compareSQLValues(a.keys[i], b.keys[i])
+			if order.desc {
+				n = -n
+			}
+			if n != 0 {
+				return n
+			}
+		}
+		return 0
+	})
+
+	// offset and limit
+	results = results[min(q.offset, len(results)):]
+	if q.limit >= 0 && q.limit < len(results) {
+		results = results[:q.limit]
+	}
+
+	for _, r := range results {
+		row := make([]string, len(r.values))
+		nulls := make([]bool, len(r.values))
+		for i, v := range r.values {
+			row[i], nulls[i] = v.s, v.null
+		}
+		table.Rows = append(table.Rows, row)
+		table.nulls = append(table.nulls, nulls)
+	}
+	return
+}
+
+// the rows from our sources (joined, if there's a JOIN)
+func (q *SQLQuery) rows(tree *XMLTree) (rows [][]*XMLElement, err error) {
+	left, err := q.from[0].path.SelectElements(tree)
+	if err != nil {
+		err = fmt.Errorf("FROM %s: %w", q.from[0].text, err)
+		return
+	}
+
+	if len(q.from) == 1 {
+		for _, e := range left {
+			rows = append(rows, []*XMLElement{e})
+		}
+		return
+	}
+
+	right, err := q.from[1].path.SelectElements(tree)
+	if err != nil {
+		err = fmt.Errorf("JOIN %s: %w", q.from[1].text, err)
+		return
+	}
+
+	// hash join (nulls never join)
+	byKey := map[string][]*XMLElement{}
+	for _, e := range right {
+		v, _ := q.joinRight.eval(&sqlContext{row: []*XMLElement{nil, e}})
+		if !v.null {
+			byKey[v.key()] = append(byKey[v.key()], e)
+		}
+	}
+	for _, e := range left {
+		v, _ := q.joinLeft.eval(&sqlContext{row: []*XMLElement{e}})
+		if v.null {
+			continue
+		}
+		for _, match := range byKey[v.key()] {
+			rows = append(rows, []*XMLElement{e, match})
+		}
+	}
+	return
+}
+
+// a context per row, or if we're grouped, a context per group (in order of first appearance)
+func (q *SQLQuery) contexts(rows [][]*XMLElement) (contexts []*sqlContext, err error) {
+	if !q.grouped {
+		for _, row := range rows {
+			contexts = append(contexts, &sqlContext{row: row})
+		}
+		return
+	}
+
+	// aggregates without a GROUP BY are over every row (even if there are none)
+	if len(q.groupBy) == 0 {
+		c := &sqlContext{group: rows, grouped: true}
+		if len(rows) != 0 {
+			c.row = rows[0]
+		}
+		contexts = append(contexts, c)
+		return
+	}
+
+	groups := map[string]*sqlContext{}
+	for _, row := range rows {
+		keys := make([]string, len(q.groupBy))
+		for i, expr := range q.groupBy {
+			var v sqlValue
+			v, err = expr.eval(&sqlContext{row: row})
+			if err != nil {
+				return
+			}
+			keys[i] = v.key()
+		}
+		key := strings.Join(keys, "\x00")
+		c, found := groups[key]
+		if !found {
+			c = &sqlContext{row: row, grouped: true}
+			groups[key] = c
+			contexts = append(contexts, c)
+		}
+		c.group = append(c.group, row)
+	}
+	return
+}
+
+// our select list with any * expanded into the attributes and simple children found in the rows
+func (q *SQLQuery) expandColumns(rows [][]*XMLElement) (columns []sqlSelect) {
+	for _, column := range q.columns {
+		if !column.star {
+			columns = append(columns, column)
+			continue
+		}
+		for i, source := range q.from {
+			if column.alias != "" && column.alias != source.alias {
+				continue
+			}
+			prefix := ""
+			if len(q.from) > 1 {
+				prefix = cmp.Or(source.alias, source.text) + "."
+			}
+			columns = append(columns, starColumns(rows, i, prefix)...)
+		}
+	}
+	return
+}
+
+// the attributes (first) and the simple valued children of the given source's elements, in order of first appearance
+func starColumns(rows [][]*XMLElement, source int, prefix string) (columns []sqlSelect) {
+	var attrs, children []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		e := row[source]
+		for _, a := range e.Attr {
+			if !seen["@"+a.Name.Local] {
+				seen["@"+a.Name.Local] = true
+				attrs = append(attrs, a.Name.Local)
+			}
+		}
+		for c := range e.ChildElements() {
+			if !seen[c.Name.Local] && c.IsSimple() {
+				seen[c.Name.Local] = true
+				children = append(children, c.Name.Local)
+			}
+		}
+	}
+
+	for _, a := range attrs {
+		columns = append(columns, sqlSelect{name: prefix + "@" + a, expr: &sqlColumn{text: prefix + "@" + a, source: source, attr: a}})
+	}
+	for _, tag := range children {
+		path := &elementPath{source: tag, steps: []pathStep{{text: tag, tag: tag}}}
+		columns = append(columns, sqlSelect{name: prefix + tag, expr: &sqlColumn{text: prefix + tag, source: source, path: path}})
+	}
+	return
+}
+
+// the value to order a result by: an output column (by name or position), or any other expression
+func (q *SQLQuery) orderValue(expr sqlExpr, columns []sqlSelect, values []sqlValue, c *sqlContext) (v sqlValue, err error) {
+	switch t := expr.(type) {
+	case *sqlLiteral:
+		if n, e := strconv.Atoi(t.text); e == nil {
+			if n < 1 || n > len(columns) {
+				err = fmt.Errorf("ORDER BY %d: there are only %d columns", n, len(columns))
+				return
+			}
+			return values[n-1], nil
+		}
+	case *sqlColumn:
+		for i, column := range columns {
+			if column.name == t.text {
+				return values[i], nil
+			}
+		}
+	}
+	v, err = expr.eval(c)
+	if errors.Is(err, ErrPathNotFound) {
+		err = nil
+	}
+	return
+}
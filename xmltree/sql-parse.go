@@ -0,0 +1,764 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// a small sql flavored query language where repeated elements are rows and their children or attributes are columns
+//
+//   SELECT Name, Damage, Cost FROM //Item WHERE Damage > 10 ORDER BY Cost DESC LIMIT 5
+//   SELECT Category, COUNT(*), AVG(Damage) AS avg FROM //Item GROUP BY Category ORDER BY avg
+//   SELECT i.Name, r.Time FROM //Item AS i JOIN //Recipe AS r ON i.Name = r.Output
+//
+// FROM takes an xpath selecting the rows (and an optional alias); a single inner JOIN ... ON a = b may follow
+// columns are slash paths relative to each row (see At): Name, Stats/Damage, Resist[@type=fire], with a final
+// @attr step for an attribute (@id, Stats/@tier), and . for the row's own value; qualify them with an alias (i.Name)
+// when joining (unqualified columns belong to the FROM rows), and quote odd names with "double quotes"
+// WHERE supports = != <> < <= > >=, [NOT] LIKE (with % and _, case insensitive), IS [NOT] NULL, AND, OR, NOT and ()
+// comparisons with a number are numeric (values which aren't numbers don't match), comparisons between columns are
+// numeric when both sides are numbers, and textual otherwise; missing values are NULL
+// aggregates: COUNT(*), COUNT(col), SUM, MIN, MAX, AVG, MEDIAN (NULLs are ignored, and non-numbers are errors)
+// ORDER BY takes output column names (or aliases), column positions (1 based) or any other column, ASC or DESC
+// keywords are case insensitive
+
+type SQLSyntaxError struct {
+	Query  string
+	Offset int
+	Msg    string
+}
+
+func (e *SQLSyntaxError) Error() string {
+	return fmt.Sprintf("sql syntax error at offset %d in %q: %s", e.Offset, e.Query, e.Msg)
+}
+
+type sqlTokenKind int
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlWord
+	sqlQuoted // a "quoted" column name
+	sqlNumber
+	sqlString
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind   sqlTokenKind
+	text   string
+	offset int
+	end    int
+}
+
+func (t sqlToken) describe() string {
+	switch t.kind {
+	case sqlEOF:
+		return "end of query"
+	case sqlString:
+		return fmt.Sprintf("'%s'", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// true if the token is the given keyword
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == sqlWord && strings.EqualFold(t.text, keyword)
+}
+
+var sqlComparisons = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "AS": true, "JOIN": true, "INNER": true, "ON": true, "WHERE": true,
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "IS": true, "NULL": true,
+	"GROUP": true, "ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+}
+
+// the keywords which end a FROM or JOIN source (an xpath, which we don't tokenize)
+var sqlSourceEnds = []string{"AS", "JOIN", "INNER", "ON", "WHERE", "GROUP", "ORDER", "LIMIT"}
+
+func isSQLKeyword(t sqlToken) bool {
+	return t.kind == sqlWord && sqlKeywords[strings.ToUpper(t.text)]
+}
+
+func isSQLWordStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@' || r == '.'
+}
+
+func isSQLWordPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:/@", r)
+}
+
+type sqlParser struct {
+	source  string
+	offset  int
+	peeked  *sqlToken
+	columns []*sqlColumn // every column reference, to be resolved once we know the aliases
+}
+
+func (p *sqlParser) failAt(offset int, msg string, args ...any) error {
+	return &SQLSyntaxError{Query: p.source, Offset: offset, Msg: fmt.Sprintf(msg, args...)}
+}
+
+// scans the token at offset
+func (p *sqlParser) scan(offset int) (t sqlToken, err error) {
+	for offset < len(p.source) && strings.ContainsRune(" \t\r\n", rune(p.source[offset])) {
+		offset++
+	}
+	t = sqlToken{offset: offset, end: offset}
+	if offset == len(p.source) {
+		return
+	}
+
+	s := p.source[offset:]
+	r, w := utf8.DecodeRuneInString(s)
+	switch {
+
+	case r == '\'':
+		// strings double their quotes to include them
+		sb := &strings.Builder{}
+		for i := 1; ; i++ {
+			if i >= len(s) {
+				err = p.failAt(offset, "unterminated string")
+				return
+			}
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					sb.WriteByte('\'')
+					i++
+					continue
+				}
+				t.kind, t.text, t.end = sqlString, sb.String(), offset+i+1
+				return
+			}
+			sb.WriteByte(s[i])
+		}
+
+	case r == '"' || r == '`':
+		end := strings.IndexRune(s[1:], r)
+		if end == -1 {
+			err = p.failAt(offset, "unterminated quoted name")
+			return
+		}
+		t.kind, t.text, t.end = sqlQuoted, s[1:end+1], offset+end+2
+		return
+
+	case unicode.IsDigit(r) || (r == '-' || r == '.') && len(s) > 1 && unicode.IsDigit(rune(s[1])):
+		end := 1
+		for end < len(s) && (unicode.IsDigit(rune(s[end])) || strings.ContainsRune(".eE", rune(s[end])) ||
+			(s[end] == '-' || s[end] == '+') && (s[end-1] == 'e' || s[end-1] == 'E')) {
+			end++
+		}
+		if _, e := strconv.ParseFloat(s[:end], 64); e != nil {
+			err = p.failAt(offset, "invalid number %q", s[:end])
+			return
+		}
+		t.kind, t.text, t.end = sqlNumber, s[:end], offset+end
+		return
+
+	case isSQLWordStart(r):
+		// words run on through any [predicates], and may end in .* (alias.*)
+		end := w
+		for end < len(s) {
+			c, cw := utf8.DecodeRuneInString(s[end:])
+			switch {
+			case isSQLWordPart(c):
+				end += cw
+			case c == '[':
+				bracket := sqlBracketEnd(s, end)
+				if bracket == -1 {
+					err = p.failAt(offset+end, "unterminated [")
+					return
+				}
+				end = bracket + 1
+			case c == '*' && s[end-1] == '.':
+				end++
+			default:
+				t.kind, t.text, t.end = sqlWord, s[:end], offset+end
+				return
+			}
+		}
+		t.kind, t.text, t.end = sqlWord, s, offset+end
+		return
+	}
+
+	// symbols
+	for _, symbol := range []string{"<=", ">=", "!=", "<>", "=", "<", ">", ",", "(", ")", "*", ";"} {
+		if strings.HasPrefix(s, symbol) {
+			t.kind, t.text, t.end = sqlSymbol, symbol, offset+len(symbol)
+			return
+		}
+	}
+
+	err = p.failAt(offset, "unexpected %q", r)
+	return
+}
+
+// the index of the ] which closes the [ at s[start] (honoring quotes and nesting), or -1
+func sqlBracketEnd(s string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (p *sqlParser) peek() (t sqlToken, err error) {
+	if p.peeked == nil {
+		t, err = p.scan(p.offset)
+		if err != nil {
+			return
+		}
+		p.peeked = &t
+	}
+	return *p.peeked, nil
+}
+
+func (p *sqlParser) next() (t sqlToken, err error) {
+	t, err = p.peek()
+	if err != nil {
+		return
+	}
+	p.offset = t.end
+	p.peeked = nil
+	return
+}
+
+// consumes the next token iff it's the given keyword or symbol
+func (p *sqlParser) accept(text string) (ok bool, err error) {
+	t, err := p.peek()
+	if err != nil {
+		return
+	}
+	ok = t.is(text) || (t.kind == sqlSymbol && t.text == text)
+	if ok {
+		_, err = p.next()
+	}
+	return
+}
+
+// consumes the given keyword or symbol (or fails)
+func (p *sqlParser) expect(text string) (err error) {
+	t, err := p.peek()
+	if err != nil {
+		return
+	}
+	ok, err := p.accept(text)
+	if err == nil && !ok {
+		err = p.failAt(t.offset, "expected %s, found %s", text, t.describe())
+	}
+	return
+}
+
+////////////////////////////////////////////////////
+// statements
+
+func parseSQL(source string) (q *SQLQuery, err error) {
+	p := &sqlParser{source: source}
+	q = &SQLQuery{source: source, limit: -1}
+
+	err = p.expect("SELECT")
+	if err != nil {
+		return
+	}
+	q.columns, err = p.parseSelectList()
+	if err != nil {
+		return
+	}
+
+	err = p.expect("FROM")
+	if err != nil {
+		return
+	}
+	source0, err := p.parseSource()
+	if err != nil {
+		return
+	}
+	q.from = append(q.from, source0)
+
+	inner, err := p.accept("INNER")
+	if err != nil {
+		return
+	}
+	join, err := p.accept("JOIN")
+	if err != nil {
+		return
+	}
+	if inner && !join {
+		err = p.expect("JOIN")
+		return
+	}
+	if join {
+		var source1 *sqlSource
+		source1, err = p.parseSource()
+		if err != nil {
+			return
+		}
+		q.from = append(q.from, source1)
+		err = p.expect("ON")
+		if err != nil {
+			return
+		}
+		q.on, err = p.parseComparison()
+		if err != nil {
+			return
+		}
+	}
+
+	if ok, e := p.accept("WHERE"); e != nil || ok {
+		if err = e; err != nil {
+			return
+		}
+		q.where, err = p.parseOr()
+		if err != nil {
+			return
+		}
+	}
+
+	if ok, e := p.accept("GROUP"); e != nil || ok {
+		if err = e; err != nil {
+			return
+		}
+		err = p.expect("BY")
+		if err != nil {
+			return
+		}
+		for {
+			var expr sqlExpr
+			expr, err = p.parseValue()
+			if err != nil {
+				return
+			}
+			q.groupBy = append(q.groupBy, expr)
+			if ok, err = p.accept(","); err != nil || !ok {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if ok, e := p.accept("ORDER"); e != nil || ok {
+		if err = e; err != nil {
+			return
+		}
+		err = p.expect("BY")
+		if err != nil {
+			return
+		}
+		for {
+			var order sqlOrder
+			first := len(p.columns)
+			order.expr, err = p.parseValue()
+			if err != nil {
+				return
+			}
+			for _, c := range p.columns[first:] {
+				c.orderOnly = true
+			}
+			if _, err = p.accept("ASC"); err != nil {
+				return
+			}
+			if order.desc, err = p.accept("DESC"); err != nil {
+				return
+			}
+			q.orderBy = append(q.orderBy, order)
+			if ok, err = p.accept(","); err != nil || !ok {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if ok, e := p.accept("LIMIT"); e != nil || ok {
+		if err = e; err != nil {
+			return
+		}
+		q.limit, err = p.parseCount()
+		if err != nil {
+			return
+		}
+		if ok, err = p.accept("OFFSET"); err != nil {
+			return
+		} else if ok {
+			q.offset, err = p.parseCount()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if _, err = p.accept(";"); err != nil {
+		return
+	}
+	t, err := p.peek()
+	if err != nil {
+		return
+	}
+	if t.kind != sqlEOF {
+		err = p.failAt(t.offset, "unexpected %s", t.describe())
+		return
+	}
+
+	err = q.resolve(p)
+	return
+}
+
+// a non-negative integer (for LIMIT and OFFSET)
+func (p *sqlParser) parseCount() (n int, err error) {
+	t, err := p.next()
+	if err != nil {
+		return
+	}
+	if t.kind == sqlNumber {
+		n, err = strconv.Atoi(t.text)
+	}
+	if t.kind != sqlNumber || err != nil || n < 0 {
+		err = p.failAt(t.offset, "expected a count, found %s", t.describe())
+	}
+	return
+}
+
+func (p *sqlParser) parseSelectList() (columns []sqlSelect, err error) {
+	for {
+		var column sqlSelect
+		t, e := p.peek()
+		if err = e; err != nil {
+			return
+		}
+
+		switch {
+		case t.kind == sqlSymbol && t.text == "*":
+			p.next()
+			column.star, column.alias = true, ""
+		case t.kind == sqlWord && strings.HasSuffix(t.text, ".*"):
+			p.next()
+			column.star, column.alias = true, strings.TrimSuffix(t.text, ".*")
+		default:
+			column.expr, err = p.parseValue()
+			if err != nil {
+				return
+			}
+			column.name = column.expr.String()
+
+			// an output name (AS is optional)
+			var as bool
+			as, err = p.accept("AS")
+			if err != nil {
+				return
+			}
+			var name sqlToken
+			name, err = p.peek()
+			if err != nil {
+				return
+			}
+			switch {
+			case name.kind == sqlQuoted || name.kind == sqlWord && !isSQLKeyword(name):
+				p.next()
+				column.name = name.text
+			case as:
+				err = p.failAt(name.offset, "expected a column name after AS, found %s", name.describe())
+				return
+			}
+		}
+
+		columns = append(columns, column)
+		if ok, e := p.accept(","); e != nil || !ok {
+			err = e
+			return
+		}
+	}
+}
+
+// a FROM or JOIN source: an xpath (up to the next keyword) and an optional alias
+func (p *sqlParser) parseSource() (source *sqlSource, err error) {
+	p.peeked = nil
+	start := p.offset
+	end := sqlSourceEnd(p.source, start)
+	text := strings.TrimSpace(p.source[start:end])
+	if text == "" {
+		err = p.failAt(start, "expected an xpath")
+		return
+	}
+
+	// an alias without AS ends up at the end of the xpath (which it makes invalid)
+	path, err := CompileXPath(text)
+	if i := strings.LastIndexAny(text, " \t\r\n"); err != nil && i != -1 && IsValidName(text[i+1:]) && !strings.ContainsAny(text[i+1:], ".:") {
+		if head, e := CompileXPath(text[:i]); e == nil {
+			end = start + strings.LastIndex(p.source[start:end], text[i+1:])
+			path, err, text = head, nil, strings.TrimSpace(text[:i])
+		}
+	}
+	if err != nil {
+		var se *XPathSyntaxError
+		offset := start + len(p.source[start:end]) - len(strings.TrimLeft(p.source[start:end], " \t\r\n"))
+		if errors.As(err, &se) {
+			offset += se.Offset
+		}
+		err = p.failAt(offset, "%v", err)
+		return
+	}
+	source = &sqlSource{text: text, path: path}
+	p.offset = end
+
+	as, err := p.accept("AS")
+	if err != nil {
+		return
+	}
+	t, err := p.peek()
+	if err != nil {
+		return
+	}
+	if t.kind == sqlWord && !isSQLKeyword(t) || as {
+		if t.kind != sqlWord || isSQLKeyword(t) || strings.ContainsAny(t.text, "./@[") {
+			err = p.failAt(t.offset, "expected an alias, found %s", t.describe())
+			return
+		}
+		p.next()
+		source.alias = t.text
+	}
+	return
+}
+
+// the offset at which the source starting at start ends (the next keyword outside of brackets or quotes)
+func sqlSourceEnd(s string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		case c == '[' || c == '(':
+			depth++
+			continue
+		case c == ']' || c == ')':
+			depth--
+			continue
+		case c == ';' && depth == 0:
+			return i
+		}
+		if depth != 0 || (i > start && !strings.ContainsRune(" \t\r\n", rune(s[i-1]))) {
+			continue
+		}
+		for _, keyword := range sqlSourceEnds {
+			after := i + len(keyword)
+			if after <= len(s) && strings.EqualFold(s[i:after], keyword) && (after == len(s) || !isSQLWordPart(rune(s[after]))) {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+////////////////////////////////////////////////////
+// expressions
+
+// a value: a column, a literal, or an aggregate
+func (p *sqlParser) parseValue() (expr sqlExpr, err error) {
+	t, err := p.next()
+	if err != nil {
+		return
+	}
+
+	switch t.kind {
+	case sqlNumber:
+		expr = &sqlLiteral{value: sqlValue{s: t.text}, text: t.text, number: true}
+		return
+	case sqlString:
+		expr = &sqlLiteral{value: sqlValue{s: t.text}, text: "'" + strings.ReplaceAll(t.text, "'", "''") + "'"}
+		return
+	case sqlQuoted:
+		expr = p.column(t)
+		return
+	case sqlWord:
+		if t.is("NULL") {
+			expr = &sqlLiteral{value: sqlValue{null: true}, text: "NULL"}
+			return
+		}
+		if isSQLKeyword(t) {
+			break
+		}
+		fn := strings.ToUpper(t.text)
+		if next, e := p.peek(); e == nil && next.kind == sqlSymbol && next.text == "(" && sqlAggregates[fn] {
+			return p.parseAggregate(fn, t)
+		}
+		expr = p.column(t)
+		return
+	}
+
+	err = p.failAt(t.offset, "expected a column or value, found %s", t.describe())
+	return
+}
+
+func (p *sqlParser) column(t sqlToken) *sqlColumn {
+	c := &sqlColumn{text: t.text, offset: t.offset}
+	p.columns = append(p.columns, c)
+	return c
+}
+
+func (p *sqlParser) parseAggregate(fn string, t sqlToken) (expr sqlExpr, err error) {
+	p.next() // (
+	a := &sqlAggregate{fn: fn}
+
+	star, err := p.accept("*")
+	if err != nil {
+		return
+	}
+	if star {
+		if fn != "COUNT" {
+			err = p.failAt(t.offset, "only COUNT may be given *")
+			return
+		}
+	} else {
+		var arg sqlExpr
+		arg, err = p.parseValue()
+		if err != nil {
+			return
+		}
+		column, ok := arg.(*sqlColumn)
+		if !ok {
+			err = p.failAt(t.offset, "%s() must be given a column", fn)
+			return
+		}
+		a.column = column
+	}
+
+	err = p.expect(")")
+	expr = a
+	return
+}
+
+func (p *sqlParser) parseOr() (cond sqlCond, err error) {
+	cond, err = p.parseAnd()
+	for err == nil {
+		var ok bool
+		if ok, err = p.accept("OR"); err != nil || !ok {
+			break
+		}
+		var right sqlCond
+		if right, err = p.parseAnd(); err == nil {
+			cond = &sqlLogical{or: true, left: cond, right: right}
+		}
+	}
+	return
+}
+
+func (p *sqlParser) parseAnd() (cond sqlCond, err error) {
+	cond, err = p.parseNot()
+	for err == nil {
+		var ok bool
+		if ok, err = p.accept("AND"); err != nil || !ok {
+			break
+		}
+		var right sqlCond
+		if right, err = p.parseNot(); err == nil {
+			cond = &sqlLogical{left: cond, right: right}
+		}
+	}
+	return
+}
+
+func (p *sqlParser) parseNot() (cond sqlCond, err error) {
+	not, err := p.accept("NOT")
+	if err != nil {
+		return
+	}
+	if not {
+		cond, err = p.parseNot()
+		cond = &sqlNot{cond: cond}
+		return
+	}
+
+	paren, err := p.accept("(")
+	if err != nil {
+		return
+	}
+	if paren {
+		cond, err = p.parseOr()
+		if err == nil {
+			err = p.expect(")")
+		}
+		return
+	}
+
+	return p.parseComparison()
+}
+
+func (p *sqlParser) parseComparison() (cond sqlCond, err error) {
+	left, err := p.parseValue()
+	if err != nil {
+		return
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case t.kind == sqlSymbol && sqlComparisons[t.text]:
+		var right sqlExpr
+		right, err = p.parseValue()
+		cond = &sqlCompare{op: t.text, left: left, right: right}
+		return
+
+	case t.is("IS"):
+		var not bool
+		if not, err = p.accept("NOT"); err != nil {
+			return
+		}
+		err = p.expect("NULL")
+		cond = &sqlIsNull{expr: left, not: not}
+		return
+
+	case t.is("NOT") || t.is("LIKE"):
+		not := t.is("NOT")
+		if not {
+			if err = p.expect("LIKE"); err != nil {
+				return
+			}
+		}
+		var pattern sqlToken
+		if pattern, err = p.next(); err != nil {
+			return
+		}
+		if pattern.kind != sqlString {
+			err = p.failAt(pattern.offset, "expected a 'pattern' after LIKE, found %s", pattern.describe())
+			return
+		}
+		cond, err = newSQLLike(left, pattern.text, not)
+		return
+	}
+
+	err = p.failAt(t.offset, "expected a comparison, found %s", t.describe())
+	return
+}
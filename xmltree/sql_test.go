@@ -0,0 +1,254 @@
+package xmltree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sqlTestXML = `<Data>
+	<Items>
+		<Item id="1"><Name>Sword</Name><Category>Blade</Category><Damage>10</Damage><Cost>50</Cost></Item>
+		<Item id="2"><Name>Dagger</Name><Category>Blade</Category><Damage>4</Damage><Cost>9</Cost></Item>
+		<Item id="3"><Name>Mace</Name><Category>Blunt</Category><Damage>8</Damage><Cost>30</Cost></Item>
+		<Item id="4"><Name>Stick</Name><Category>Blunt</Category><Damage>lots</Damage><Cost>1</Cost></Item>
+		<Item id="5"><Name>Shield</Name><Cost>40</Cost></Item>
+	</Items>
+	<Recipes>
+		<Recipe><Output>Sword</Output><Time>20</Time></Recipe>
+		<Recipe><Output>Mace</Output><Time>15</Time></Recipe>
+		<Recipe><Output>Sword</Output><Time>12</Time></Recipe>
+	</Recipes>
+</Data>`
+
+// runs the query, returning its rows as "a,b,c" lines
+func sqlRows(t *testing.T, tree *XMLTree, query string) string {
+	t.Helper()
+	table, err := tree.SQL(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	var lines []string
+	for _, row := range table.Rows {
+		lines = append(lines, strings.Join(row, ","))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSQLParse(t *testing.T) {
+	valid := []string{
+		"SELECT Name FROM //Item",
+		"select Name, Damage as d from //Item where d > 1 order by 2 desc limit 1 offset 1",
+		"SELECT * FROM //Item",
+		"SELECT i.*, r.Time FROM //Item AS i JOIN //Recipe AS r ON i.Name = r.Output",
+		`SELECT "Name", @id, Stats/@tier, . FROM //Item`,
+		"SELECT Name FROM //Item WHERE NOT (Damage > 5 OR Name LIKE 'S%') AND Cost IS NOT NULL",
+		"SELECT Category, COUNT(*), COUNT(Damage), AVG(Cost) FROM //Item GROUP BY Category",
+	}
+	for _, q := range valid {
+		if _, err := CompileSQL(q); err != nil {
+			t.Errorf("%s: %v", q, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"SELECT FROM //Item",
+		"SELECT Name",
+		"SELECT Name FROM",
+		"SELECT Name FROM //Item WHERE",
+		"SELECT Name FROM //Item WHERE Name = 'unterminated",
+		"SELECT Name FROM //Item LIMIT -1",
+		"SELECT Name FROM //Item LIMIT x",
+		"SELECT SUM(*) FROM //Item",
+		"SELECT Name FROM //Item WHERE COUNT(*) > 1",
+		"SELECT Name FROM //Item GROUP BY COUNT(*)",
+		"SELECT Name FROM //Item AS a JOIN //Recipe AS a ON a.Name = a.Output",
+		"SELECT Name FROM //Item AS i JOIN //Recipe AS r ON i.Name > r.Output",
+		"SELECT Name FROM //Item WHERE Name LIKE Cost",
+		"SELECT @1st FROM //Item",
+		"SELECT Name FROM //Item WHERE Name = 'x' extra",
+	}
+	for _, q := range invalid {
+		_, err := CompileSQL(q)
+		var syntax *SQLSyntaxError
+		if !errors.As(err, &syntax) {
+			t.Errorf("%q: got %v, want a syntax error", q, err)
+		}
+	}
+}
+
+func TestSQLSelect(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT Name, @id FROM //Item WHERE Cost < 10", "Dagger,2\nStick,4"},
+		{"SELECT Name FROM //Item WHERE Category IS NULL", "Shield"},
+		{"SELECT Name FROM //Item WHERE Category = 'Blunt' AND NOT Cost >= 30", "Stick"},
+		{"SELECT Name FROM //Item WHERE Name = 'Mace' OR @id = 1", "Sword\nMace"},
+		{"SELECT Name FROM //Item ORDER BY Cost", "Stick\nDagger\nMace\nShield\nSword"},
+		{"SELECT Name, Damage AS d FROM //Item WHERE Damage IS NOT NULL ORDER BY d DESC", "Stick,lots\nSword,10\nMace,8\nDagger,4"},
+		{"SELECT Name FROM //Item ORDER BY 1", "Dagger\nMace\nShield\nStick\nSword"},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+
+	table, err := tree.SQL("SELECT * FROM //Item WHERE @id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(table.Columns, ","), "@id,Name,Category,Damage,Cost"; got != want {
+		t.Errorf("got columns %s, want %s", got, want)
+	}
+}
+
+func TestSQLNumericComparison(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// "lots" > "9" as text, but a comparison with a number is numeric (and lots isn't one)
+		{"SELECT Name FROM //Item WHERE Damage > 9", "Sword"},
+		{"SELECT Name FROM //Item WHERE Damage < 9", "Dagger\nMace"},
+		{"SELECT Name FROM //Item WHERE 9 < Damage", "Sword"},
+		{"SELECT Name FROM //Item WHERE Damage = 10.0", "Sword"},
+		// so lots matches no numeric comparison at all
+		{"SELECT Name FROM //Item WHERE Damage != 4", "Sword\nMace"},
+		{"SELECT Name FROM //Item WHERE Damage IS NOT NULL AND NOT Damage < 100", "Stick"},
+		// against a string, values are compared numerically only if both sides are numbers
+		{"SELECT Name FROM //Item WHERE Damage > '9'", "Sword\nStick"},
+		{"SELECT Name FROM //Item WHERE Damage > 'a'", "Stick"},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSQLLike(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT Name FROM //Item WHERE Name LIKE 's%'", "Sword\nStick\nShield"},
+		{"SELECT Name FROM //Item WHERE Name LIKE '_a%'", "Dagger\nMace"},
+		{"SELECT Name FROM //Item WHERE Name NOT LIKE '%i%'", "Sword\nDagger\nMace"},
+		{"SELECT Name FROM //Item WHERE Category LIKE 'B%' AND Name LIKE '%e'", "Mace"},
+		{"SELECT Name FROM //Item WHERE Name LIKE 'S.%'", ""},
+		// nulls match neither LIKE nor NOT LIKE
+		{"SELECT Name FROM //Item WHERE Category NOT LIKE 'Bl%'", ""},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSQLGroupBy(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT Category, COUNT(*), SUM(Cost), MIN(Cost), MAX(Cost), AVG(Cost) FROM //Item GROUP BY Category",
+			"Blade,2,59,9,50,29.5\nBlunt,2,31,1,30,15.5\n,1,40,40,40,40"},
+		{"SELECT COUNT(*), COUNT(Category), MEDIAN(Cost) FROM //Item", "5,4,30"},
+		{"SELECT Category, COUNT(*) AS n FROM //Item WHERE Category IS NOT NULL GROUP BY Category ORDER BY n DESC, Category DESC", "Blunt,2\nBlade,2"},
+		{"SELECT COUNT(*), SUM(Cost) FROM //Item WHERE Cost > 100", "0,"},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+
+	// aggregating something which isn't a number is an error (rather than a zero)
+	if _, err := tree.SQL("SELECT SUM(Damage) FROM //Item"); err == nil {
+		t.Error("summing a non-number should fail")
+	}
+}
+
+func TestSQLJoin(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT i.Name, r.Time FROM //Item AS i JOIN //Recipe AS r ON i.Name = r.Output", "Sword,20\nSword,12\nMace,15"},
+		{"SELECT i.Name, r.Time FROM //Item AS i JOIN //Recipe AS r ON r.Output = i.Name WHERE r.Time < 15", "Sword,12"},
+		{"SELECT i.Name, COUNT(*), MIN(r.Time) FROM //Item AS i JOIN //Recipe AS r ON i.Name = r.Output GROUP BY i.Name", "Sword,2,12\nMace,1,15"},
+		// unqualified columns belong to the FROM rows
+		{"SELECT Name, r.Time FROM //Item JOIN //Recipe AS r ON Name = r.Output ORDER BY r.Time LIMIT 1", "Sword,12"},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+
+	table, err := tree.SQL("SELECT * FROM //Item AS i JOIN //Recipe AS r ON i.Name = r.Output WHERE r.Time = 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(table.Columns, ","), "i.@id,i.Name,i.Category,i.Damage,i.Cost,r.Output,r.Time"; got != want {
+		t.Errorf("got columns %s, want %s", got, want)
+	}
+}
+
+func TestSQLLimit(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT Name FROM //Item ORDER BY Cost DESC LIMIT 2", "Sword\nShield"},
+		{"SELECT Name FROM //Item ORDER BY Cost DESC LIMIT 2 OFFSET 1", "Shield\nMace"},
+		{"SELECT Name FROM //Item LIMIT 0", ""},
+		{"SELECT Name FROM //Item LIMIT 10 OFFSET 4", "Shield"},
+		{"SELECT Name FROM //Item LIMIT 1 OFFSET 10", ""},
+	}
+	for _, tt := range tests {
+		if got := sqlRows(t, tree, tt.query); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTableWriteJSON(t *testing.T) {
+	tree := readTree(t, sqlTestXML)
+	table, err := tree.SQL("SELECT Name, Category, Damage, @id FROM //Item WHERE Cost >= 40 OR Damage = 4 ORDER BY @id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := &strings.Builder{}
+	err = table.WriteJSON(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {"Name": "Sword", "Category": "Blade", "Damage": 10, "@id": 1},
+  {"Name": "Dagger", "Category": "Blade", "Damage": 4, "@id": 2},
+  {"Name": "Shield", "Category": null, "Damage": null, "@id": 5}
+]
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// text which merely looks numeric stays text
+	table = &Table{Columns: []string{"a", "b", "c"}, Rows: [][]string{{"007", "1.", "-2.5e3"}}}
+	sb.Reset()
+	table.WriteJSON(sb)
+	if got, want := sb.String(), "[\n  {\"a\": \"007\", \"b\": \"1.\", \"c\": -2.5e3}\n]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
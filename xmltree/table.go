@@ -0,0 +1,119 @@
+package xmltree
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// tabular results (e.g. from SQL), which can be written as aligned text, csv or json
+
+type Table struct {
+	Columns []string
+	Rows    [][]string
+	nulls   [][]bool // which cells had no value (written as empty text, but as null in json)
+}
+
+// true if the cell had no value (e.g. a missing child, as opposed to an empty one)
+func (t *Table) IsNull(row, column int) bool {
+	return row < len(t.nulls) && column < len(t.nulls[row]) && t.nulls[row][column]
+}
+
+// the table as aligned text (with a header row and a rule beneath it)
+func (t *Table) String() string {
+	widths := make([]int, len(t.Columns))
+	for i, c := range t.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for _, row := range t.Rows {
+		for i, v := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(v))
+		}
+	}
+
+	sb := &strings.Builder{}
+	line := func(cells []string) {
+		for i, v := range cells {
+			if i != 0 {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(v)
+			if i != len(cells)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	line(t.Columns)
+	rule := make([]string, len(widths))
+	for i, w := range widths {
+		rule[i] = strings.Repeat("-", w)
+	}
+	line(rule)
+	for _, row := range t.Rows {
+		line(row)
+	}
+	return sb.String()
+}
+
+// writes the table as csv (with a header row)
+func (t *Table) WriteCSV(w io.Writer) (err error) {
+	cw := csv.NewWriter(w)
+	err = cw.Write(t.Columns)
+	if err != nil {
+		return
+	}
+	err = cw.WriteAll(t.Rows)
+	return
+}
+
+// text which can be written as a json number as it is
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// writes the table as a json array of objects (one per row, with its keys in column order)
+// values which are numbers are written as numbers, and nulls as null (everything else is a string)
+func (t *Table) WriteJSON(w io.Writer) (err error) {
+	sb := &strings.Builder{}
+	sb.WriteString("[")
+	for r, row := range t.Rows {
+		if r != 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n  {")
+		for i, v := range row {
+			if i != 0 {
+				sb.WriteString(", ")
+			}
+			var key, value []byte
+			key, err = json.Marshal(t.Columns[i])
+			if err != nil {
+				return
+			}
+			switch {
+			case t.IsNull(r, i):
+				value = []byte("null")
+			case jsonNumber.MatchString(v):
+				value = []byte(v)
+			default:
+				value, err = json.Marshal(v)
+				if err != nil {
+					return
+				}
+			}
+			sb.Write(key)
+			sb.WriteString(": ")
+			sb.Write(value)
+		}
+		sb.WriteString("}")
+	}
+	if len(t.Rows) != 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString("]\n")
+	_, err = io.WriteString(w, sb.String())
+	return
+}
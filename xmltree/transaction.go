@@ -0,0 +1,287 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"errors"
+	"slices"
+)
+
+// transactions: record every edit made to a tree so that it can be rolled back, or undone and redone a step at a time
+// every mutating api (SetValue, Append, InsertAt, RemoveSpan, Reorder, attribute edits, etc.) records the state of the
+// value it's about to change, so any edit made through them is covered, including edits to elements removed mid transaction
+// warn: direct edits to fields (e.g. e.Attr[0].Value = "x") bypass the record (as do elements made by struct literal, see RelinkParents)
+
+var (
+	ErrTransactionActive = errors.New("tree already has an active transaction")
+	ErrTransactionDone   = errors.New("transaction has already been committed or rolled back")
+	ErrNothingToUndo     = errors.New("nothing to undo")
+	ErrNothingToRedo     = errors.New("nothing to redo")
+)
+
+type Transaction struct {
+	tree     *XMLTree
+	current  *txStep   // the edits since the last step was closed
+	undo     []*txStep // closed steps, oldest first
+	redo     []*txStep // undone steps, most recently undone last
+	applying bool      // true while we're undoing or redoing (so we don't record ourselves)
+	done     bool
+}
+
+// a unit of undo: the state of every value it edited, before it edited them
+type txStep struct {
+	label   string
+	changes []*txChange
+	seen    map[*XMLValue]bool
+}
+
+// the state of a value (and, for an element's value, its name and attributes)
+type txChange struct {
+	value    *XMLValue
+	contents any
+	element  bool
+	name     xml.Name
+	attrs    []xml.Attr
+}
+
+// starts recording every edit to the tree (until Commit or Rollback)
+// an interactive editor can keep one open for a whole session, and use Checkpoint, Undo and Redo
+func (tree *XMLTree) Begin() (tx *Transaction, err error) {
+	if tree.Elements.transaction() != nil {
+		err = ErrTransactionActive
+		return
+	}
+	tx = &Transaction{tree: tree, current: newTxStep()}
+	tree.Elements.journal = tx
+	tree.Elements.eachElement(func(e *XMLElement) bool {
+		e.journal = tx
+		return true
+	})
+	return
+}
+
+// the tree's active transaction (nil if there isn't one)
+func (tree *XMLTree) Transaction() *Transaction {
+	return tree.Elements.transaction()
+}
+
+func newTxStep() *txStep {
+	return &txStep{seen: map[*XMLValue]bool{}}
+}
+
+// the transaction recording our edits (nil if there isn't one)
+func (v *XMLValue) transaction() *Transaction {
+	tx := v.journal
+	if v.owner != nil {
+		tx = v.owner.Root().journal
+	}
+	if tx == nil || tx.done {
+		return nil
+	}
+	return tx
+}
+
+// records our state with any active transaction (called before every edit)
+func (v *XMLValue) record() {
+	if tx := v.transaction(); tx != nil && !tx.applying {
+		tx.record(v)
+	}
+}
+
+func (tx *Transaction) record(v *XMLValue) {
+	// only our state before the step's first edit matters
+	if tx.current.seen[v] {
+		return
+	}
+	tx.current.seen[v] = true
+	tx.current.changes = append(tx.current.changes, captureTxChange(v))
+
+	// a new edit forks history: what was undone can no longer be redone
+	tx.redo = nil
+}
+
+func captureTxChange(v *XMLValue) *txChange {
+	c := &txChange{value: v, contents: v.contents}
+	if s, ok := v.contents.([]any); ok {
+		// subtle: many edits work in situ, so we need our own copy of the slice
+		c.contents = slices.Clone(s)
+	}
+	if e := v.owner; e != nil && &e.XMLValue == v {
+		c.element, c.name, c.attrs = true, e.Name, slices.Clone(e.Attr)
+	}
+	return c
+}
+
+// restores the recorded state, and records the state it replaced in its place (so applying us again reverses us)
+func (c *txChange) swap() {
+	v := c.value
+	current := captureTxChange(v)
+	v.replaceContents(c.contents)
+	if c.element {
+		v.owner.Name, v.owner.Attr = c.name, c.attrs
+	}
+	*c = *current
+}
+
+// reverses the step (or re-applies it, if it has been reversed)
+func (tx *Transaction) apply(step *txStep, reverse bool) {
+	tx.applying = true
+	defer func() { tx.applying = false }()
+	if reverse {
+		for i := len(step.changes) - 1; i >= 0; i-- {
+			step.changes[i].swap()
+		}
+		return
+	}
+	for _, c := range step.changes {
+		c.swap()
+	}
+}
+
+// the tree we're recording
+func (tx *Transaction) Tree() *XMLTree {
+	return tx.tree
+}
+
+// closes the edits made since the last checkpoint into an undoable step with the given label
+// does nothing if there have been no edits since
+func (tx *Transaction) Checkpoint(label string) (err error) {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if len(tx.current.changes) != 0 {
+		tx.current.label = label
+		tx.undo = append(tx.undo, tx.current)
+		tx.current = newTxStep()
+	}
+	return
+}
+
+// runs edit as a single undoable step: if it fails (or panics), everything it did is reverted
+func (tx *Transaction) Do(label string, edit func() error) (err error) {
+	err = tx.Checkpoint("")
+	if err != nil {
+		return
+	}
+
+	failed := true
+	defer func() {
+		if failed {
+			tx.revertCurrent()
+		}
+	}()
+
+	err = edit()
+	if err != nil {
+		return
+	}
+	failed = false
+	return tx.Checkpoint(label)
+}
+
+// reverts the edits since the last checkpoint
+func (tx *Transaction) revertCurrent() {
+	if tx.done {
+		return
+	}
+	tx.apply(tx.current, true)
+	tx.current = newTxStep()
+}
+
+// true if there's a step to undo (including edits since the last checkpoint)
+func (tx *Transaction) CanUndo() bool {
+	return !tx.done && (len(tx.undo) != 0 || len(tx.current.changes) != 0)
+}
+
+// true if there's an undone step to redo
+func (tx *Transaction) CanRedo() bool {
+	return !tx.done && len(tx.redo) != 0
+}
+
+// the labels of the steps which can be undone (most recent last) and redone (next first)
+func (tx *Transaction) History() (undo, redo []string) {
+	for _, step := range tx.undo {
+		undo = append(undo, step.label)
+	}
+	for i := len(tx.redo) - 1; i >= 0; i-- {
+		redo = append(redo, tx.redo[i].label)
+	}
+	return
+}
+
+// reverts the most recent step (any edits since the last checkpoint are closed into a step of their own first)
+// returns the step's label
+func (tx *Transaction) Undo() (label string, err error) {
+	if tx.done {
+		err = ErrTransactionDone
+		return
+	}
+	tx.Checkpoint("")
+	if len(tx.undo) == 0 {
+		err = ErrNothingToUndo
+		return
+	}
+
+	step := tx.undo[len(tx.undo)-1]
+	tx.undo = tx.undo[:len(tx.undo)-1]
+	tx.apply(step, true)
+	tx.redo = append(tx.redo, step)
+	label = step.label
+	return
+}
+
+// re-applies the most recently undone step, returning its label
+func (tx *Transaction) Redo() (label string, err error) {
+	if tx.done {
+		err = ErrTransactionDone
+		return
+	}
+	if len(tx.redo) == 0 {
+		err = ErrNothingToRedo
+		return
+	}
+
+	step := tx.redo[len(tx.redo)-1]
+	tx.redo = tx.redo[:len(tx.redo)-1]
+	tx.apply(step, false)
+	tx.undo = append(tx.undo, step)
+	label = step.label
+	return
+}
+
+// keeps every edit and stops recording
+func (tx *Transaction) Commit() (err error) {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.end()
+	return
+}
+
+// reverts every edit made since Begin and stops recording
+func (tx *Transaction) Rollback() (err error) {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.revertCurrent()
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.apply(tx.undo[i], true)
+	}
+	tx.end()
+	return
+}
+
+func (tx *Transaction) end() {
+	tx.done = true
+	tx.current, tx.undo, tx.redo = nil, nil, nil
+
+	// elements still pointing at us are harmless (we're done), but we tidy up the tree itself
+	if tx.tree.Elements.journal == tx {
+		tx.tree.Elements.journal = nil
+	}
+	tx.tree.Elements.eachElement(func(e *XMLElement) bool {
+		if e.journal == tx {
+			e.journal = nil
+		}
+		return true
+	})
+}
@@ -0,0 +1,209 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+const txTestXML = `<Root><A x="1">a</A><B><C>c</C></B></Root>`
+
+func TestTransactionRollback(t *testing.T) {
+	tree := readTree(t, txTestXML)
+	tx, err := tree.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Transaction() != tx {
+		t.Fatal("the tree should report its transaction")
+	}
+	if _, err := tree.Begin(); err != ErrTransactionActive {
+		t.Errorf("got %v, want ErrTransactionActive", err)
+	}
+
+	root := tree.Elements.Elements()[0]
+	a, b := root.Elements()[0], root.Elements()[1]
+	a.SetValue("changed")
+	a.SetAttribute("x", 2)
+	a.SetAttribute("y", 3)
+	tx.Checkpoint("first")
+
+	// edits to an element removed mid transaction are still recorded
+	c := b.Elements()[0]
+	c.Remove()
+	c.SetValue("gone")
+	b.makeEditable().Append(MakeElement("D"))
+
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.String(); got != txTestXML {
+		t.Errorf("got %s, want %s", got, txTestXML)
+	}
+	if c.StringValue() != "c" || c.Parent() != b {
+		t.Error("the removed element wasn't restored")
+	}
+	if tree.Transaction() != nil {
+		t.Error("the transaction should have ended")
+	}
+	if err := tx.Rollback(); err != ErrTransactionDone {
+		t.Errorf("got %v, want ErrTransactionDone", err)
+	}
+
+	// and once it's over, edits aren't recorded
+	a.SetValue("after")
+	if tx.CanUndo() {
+		t.Error("a finished transaction can't undo")
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	tree := readTree(t, txTestXML)
+	tx, _ := tree.Begin()
+	tree.Elements.Elements()[0].Elements()[0].SetValue("kept")
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<Root><A x="1">kept</A><B><C>c</C></B></Root>`
+	if got := tree.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	for _, err := range []error{tx.Commit(), tx.Rollback(), tx.Checkpoint("x")} {
+		if err != ErrTransactionDone {
+			t.Errorf("got %v, want ErrTransactionDone", err)
+		}
+	}
+
+	// a new transaction can begin once the last has ended
+	if _, err := tree.Begin(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransactionUndoRedo(t *testing.T) {
+	tree := readTree(t, `<Root><V>0</V></Root>`)
+	tx, _ := tree.Begin()
+	v := tree.Elements.Elements()[0].Elements()[0]
+	states := []string{tree.String()}
+	for _, s := range []string{"1", "2", "3"} {
+		v.SetValue(s)
+		v.SetAttribute("at", s) // several edits to a value in a step are undone together
+		tx.Checkpoint("set " + s)
+		states = append(states, tree.String())
+	}
+
+	undo, redo := tx.History()
+	if !slices.Equal(undo, []string{"set 1", "set 2", "set 3"}) || len(redo) != 0 {
+		t.Errorf("got history %q %q", undo, redo)
+	}
+
+	// undo all the way back
+	for i := 3; i > 0; i-- {
+		label, err := tx.Undo()
+		if want := fmt.Sprintf("set %d", i); err != nil || label != want {
+			t.Errorf("undo %d: got %q, %v", i, label, err)
+		}
+		if got := tree.String(); got != states[i-1] {
+			t.Errorf("undo %d: got %s, want %s", i, got, states[i-1])
+		}
+	}
+	if _, err := tx.Undo(); err != ErrNothingToUndo {
+		t.Errorf("got %v, want ErrNothingToUndo", err)
+	}
+
+	// and redo two of them
+	for i := 1; i <= 2; i++ {
+		_, err := tx.Redo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tree.String(); got != states[i] {
+			t.Errorf("redo %d: got %s, want %s", i, got, states[i])
+		}
+	}
+	undo, redo = tx.History()
+	if !slices.Equal(undo, []string{"set 1", "set 2"}) || !slices.Equal(redo, []string{"set 3"}) {
+		t.Errorf("got history %q %q", undo, redo)
+	}
+
+	// a new edit forks history
+	v.SetValue("fork")
+	if tx.CanRedo() {
+		t.Error("a new edit should discard what could be redone")
+	}
+	if _, err := tx.Redo(); err != ErrNothingToRedo {
+		t.Errorf("got %v, want ErrNothingToRedo", err)
+	}
+
+	// edits since the last checkpoint are undone as a step of their own
+	label, err := tx.Undo()
+	if err != nil || label != "" {
+		t.Errorf("got %q, %v", label, err)
+	}
+	if got := tree.String(); got != states[2] {
+		t.Errorf("got %s, want %s", got, states[2])
+	}
+
+	// and rolling back undoes everything since Begin, whatever's been undone or redone
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.String(); got != states[0] {
+		t.Errorf("got %s, want %s", got, states[0])
+	}
+}
+
+func TestTransactionDo(t *testing.T) {
+	tree := readTree(t, txTestXML)
+	tx, _ := tree.Begin()
+	root := tree.Elements.Elements()[0]
+
+	err := tx.Do("append", func() error {
+		return root.Append(MakeElement("E"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := tree.String()
+
+	// a failed step is reverted, and leaves nothing to undo
+	failed := errors.New("failed")
+	err = tx.Do("half", func() error {
+		root.Elements()[0].SetValue("half done")
+		return failed
+	})
+	if err != failed {
+		t.Errorf("got %v, want %v", err, failed)
+	}
+	if got := tree.String(); got != after {
+		t.Errorf("failed step wasn't reverted: %s", got)
+	}
+
+	// as is one that panics
+	func() {
+		defer func() { recover() }()
+		tx.Do("panic", func() error {
+			root.Elements()[0].SetValue("panicked")
+			panic("oops")
+		})
+	}()
+	if got := tree.String(); got != after {
+		t.Errorf("panicking step wasn't reverted: %s", got)
+	}
+
+	undo, _ := tx.History()
+	if !slices.Equal(undo, []string{"append"}) {
+		t.Errorf("got history %q", undo)
+	}
+	label, err := tx.Undo()
+	if err != nil || label != "append" {
+		t.Errorf("got %q, %v", label, err)
+	}
+	if got := tree.String(); got != txTestXML {
+		t.Errorf("got %s, want %s", got, txTestXML)
+	}
+}
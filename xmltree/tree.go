@@ -6,8 +6,6 @@ import (
 	"io"
 	"strconv"
 	"strings"
-
-	"github.com/lucky-wolf/xml-tree/format"
 )
 
 // alternate/replacement library for golang's xml package
@@ -21,7 +19,10 @@ type XMLTree struct {
 }
 
 type XMLValue struct {
-	contents any // can be a string, comment, directive, processing instructions, element or an array of anything other than string
+	contents any              // can be a string, comment, directive, processing instructions, element or an array of anything other than string
+	owner    *XMLElement      // the element we belong to (nil at the top level of a tree), who our child elements get as their parent
+	journal  *Transaction     // the transaction recording our edits (only set at the top level of a tree and on its top level elements, see Begin)
+	numbers  *NumberFormatter // the tree's number formatting (set the same way as journal, see SetNumberFormatter)
 }
 
 type XMLProcInst struct {
@@ -38,7 +39,33 @@ type XMLDirective struct {
 
 type XMLElement struct {
 	xml.StartElement
-	XMLValue // can be a single string, or an array of child elements such as other elements or comments etc.
+	XMLValue             // can be a single string, or an array of child elements such as other elements or comments etc.
+	pos      Position    // where we were found in the source (zero if we were created in code)
+	parent   *XMLElement // the element which contains us (nil at the top level of a tree, or once we've been removed)
+	edits    uint64      // counts every edit made beneath us while we're a root (see touch)
+}
+
+// line + column of an element in its source document (both are 1-based, zero means unknown)
+type Position struct {
+	Line   int
+	Column int
+}
+
+// true if we know where this came from
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "?"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// returns where this element started in its source document (zero if it was created in code)
+func (e *XMLElement) Position() Position {
+	return e.pos
 }
 
 // true if we hold nothing (we're the empty value)
@@ -105,26 +132,39 @@ func (e *XMLValue) SetString(value string) {
 	if !ok && e.contents != nil {
 		panic("not a simple value type: cannot write a simple value into it")
 	}
+	e.record()
 	e.contents = value
+	e.touch()
 }
 
 // set our contents to the given value
 // value can be any kind of scalar or string or an array of any
-// note: we use engineering notation for floats (purely a nicety for XML readability)
+// note: floats are formatted by the tree's NumberFormatter (the shortest exact form unless configured otherwise)
 func (e *XMLValue) SetValue(value any) {
+	e.setValue("", value)
+}
+
+// tag selects any per-tag number formatting
+func (e *XMLValue) setValue(tag string, value any) {
 	switch v := value.(type) {
 	case []any:
-		e.contents = value
+		e.replaceContents(v)
+	default:
+		e.SetString(formatValue(e.numberFormatter(tag), v))
+	}
+}
+
+// the text for a simple value (formatting floats with f)
+func formatValue(f *NumberFormatter, value any) string {
+	switch v := value.(type) {
 	case string:
-		e.SetString(v)
-	case int, int16, int32, int64, int8, uint, uint16, uint32, uint64, uint8:
-		e.SetString(fmt.Sprint(v))
+		return v
 	case float32:
-		e.SetString(format.Natural(float64(v), 6))
+		return f.format(float64(v))
 	case float64:
-		e.SetString(format.Natural(v, 6))
+		return f.format(v)
 	default:
-		e.SetString(fmt.Sprint(v))
+		return fmt.Sprint(v)
 	}
 }
 
@@ -175,6 +215,11 @@ func (e *XMLValue) ScaleBy(scale float64) (err error) {
 		return
 	}
 
+	return e.scaleBy("", scale)
+}
+
+func (e *XMLValue) scaleBy(tag string, scale float64) (err error) {
+
 	if scale == 1.0 {
 		return
 	}
@@ -184,7 +229,9 @@ func (e *XMLValue) ScaleBy(scale float64) (err error) {
 		return
 	}
 
-	e.contents = fmt.Sprintf("%.5g", value*scale)
+	e.record()
+	e.contents = e.numberFormatter(tag).format(value * scale)
+	e.touch()
 	return
 }
 
@@ -196,6 +243,11 @@ func (e *XMLValue) AdjustValue(adjustment float64) (err error) {
 		return
 	}
 
+	return e.adjustValue("", adjustment)
+}
+
+func (e *XMLValue) adjustValue(tag string, adjustment float64) (err error) {
+
 	if adjustment == 0.0 {
 		return
 	}
@@ -205,92 +257,27 @@ func (e *XMLValue) AdjustValue(adjustment float64) (err error) {
 		return
 	}
 
-	e.contents = fmt.Sprintf("%.5g", value+adjustment)
+	e.record()
+	e.contents = e.numberFormatter(tag).format(value + adjustment)
+	e.touch()
 	return
 }
 
 ////////////////////////////////////////////////////
 // simple string representation
+// note: these all use the same encoder as Encode, so what you see is what would be written
+// except for a simple value, which is its raw (unescaped) text
 
 func (e *XMLTree) String() string {
 	return e.Elements.String()
 }
 
 func (e *XMLValue) String() string {
-
-	// return the empty string if we're empty
-	if e.Empty() {
-		return ""
-	}
-
-	// simple case is just string contents
-	if v, ok := e.contents.(string); ok {
-		return v
-	}
-
-	// everything else is one or more child objects
-	sb := new(strings.Builder)
-	switch v := e.contents.(type) {
-	case XMLComment:
-		sb.WriteByte('\n')
-		sb.WriteString(v.String())
-	case XMLDirective:
-		sb.WriteByte('\n')
-		sb.WriteString(v.String())
-	case XMLProcInst:
-		sb.WriteByte('\n')
-		sb.WriteString(v.String())
-	case XMLElement:
-		sb.WriteByte('\n')
-		sb.WriteString(v.String())
-	case []any:
-		for i := range v {
-			sb.WriteByte('\n')
-			sb.WriteString(fmt.Sprint(v[i]))
-		}
-		sb.WriteByte('\n')
-	}
-	return sb.String()
+	return e.render(false)
 }
 
 func (e *XMLElement) String() string {
-
-	sb := new(strings.Builder)
-
-	// write the start token with attributes
-	sb.WriteByte('<')
-	sb.WriteString(e.Name.Local)
-	for i := range e.Attr {
-		sb.WriteByte(' ')
-		if e.Attr[i].Name.Space != "" {
-			sb.WriteString(e.Attr[i].Name.Space)
-			sb.WriteByte(':')
-		}
-		sb.WriteString(e.Attr[i].Name.Local)
-		sb.WriteByte('=')
-		sb.WriteByte('"')
-		//todo: we need to map illegal chars to their &xx; equivalents
-		sb.WriteString(e.Attr[i].Value)
-		sb.WriteByte('"')
-	}
-
-	if e.XMLValue.Empty() {
-		sb.WriteString(" />")
-	} else {
-		sb.WriteByte('>')
-
-		// ask XMLItem to express itself
-		sb.WriteString(e.XMLValue.String())
-
-		// write the closure
-		sb.WriteString("</")
-		sb.WriteString(e.Name.Local)
-		sb.WriteByte('>')
-	}
-
-	// sb.WriteByte('\n')
-
-	return sb.String()
+	return encodeToString(e, false)
 }
 
 func (e *XMLProcInst) String() string {
@@ -310,3 +297,75 @@ func (e *XMLComment) String() string {
 	e.Encode(sb)
 	return sb.String()
 }
+
+////////////////////////////////////////////////////
+// fmt.Formatter support
+//  %v  compact (single line)
+//  %+v indented
+//  %#v debug dump with node types and positions
+//  %s  same as %v
+//  %q  quoted compact
+
+func (e *XMLTree) Format(f fmt.State, verb rune) {
+	formatNode(f, verb, e, e.Elements.render, func() { dumpValue(f, "XMLTree", &e.Elements, 0) })
+}
+
+func (e *XMLValue) Format(f fmt.State, verb rune) {
+	formatNode(f, verb, e, e.render, func() { dumpValue(f, "XMLValue", e, 0) })
+}
+
+func (e *XMLElement) Format(f fmt.State, verb rune) {
+	formatNode(f, verb, e, e.render, func() { dumpElement(f, e, 0) })
+}
+
+// anything we can encode
+type encodable interface {
+	Encode(encoder FormattedEncoder) error
+}
+
+// encodes the given node to a string (indented using tabs, or compact)
+func encodeToString(node encodable, indented bool) string {
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	if indented {
+		encoder.Configure("", "\t")
+	} else {
+		encoder.ConfigureCompact()
+	}
+	// subtle: a strings.Builder never fails, so the only errors possible are unknown entities (which we render as best we can)
+	node.Encode(encoder)
+	encoder.Flush()
+	return sb.String()
+}
+
+// a simple value is its raw text, anything else is encoded
+func (e *XMLValue) render(indented bool) string {
+	if v, ok := e.contents.(string); ok {
+		return v
+	}
+	return encodeToString(e, indented)
+}
+
+func (e *XMLElement) render(indented bool) string {
+	return encodeToString(e, indented)
+}
+
+func formatNode(f fmt.State, verb rune, self any, render func(indented bool) string, dump func()) {
+	switch verb {
+	case 'v':
+		switch {
+		case f.Flag('#'):
+			dump()
+		case f.Flag('+'):
+			io.WriteString(f, render(true))
+		default:
+			io.WriteString(f, render(false))
+		}
+	case 's':
+		io.WriteString(f, render(f.Flag('+')))
+	case 'q':
+		io.WriteString(f, strconv.Quote(render(false)))
+	default:
+		fmt.Fprintf(f, "%%!%c(%T)", verb, self)
+	}
+}
@@ -0,0 +1,108 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStringMatchesEncode(t *testing.T) {
+	tree := readTree(t, `<a x="1 &amp; 2"><b>x &lt; y</b><c /></a>`)
+	a := tree.Elements.Elements()[0]
+
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	encoder.ConfigureCompact()
+	err := tree.Encode(encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder.Flush()
+
+	if tree.String() != sb.String() {
+		t.Errorf("tree: got %q, want %q", tree.String(), sb.String())
+	}
+	if a.String() != sb.String() {
+		t.Errorf("element: got %q, want %q", a.String(), sb.String())
+	}
+}
+
+func TestStringOfSimpleValueIsRaw(t *testing.T) {
+	tree := readTree(t, `<a><b>x &lt; y &amp; z</b><c /></a>`)
+	b, c := tree.Elements.Elements()[0].Child("b"), tree.Elements.Elements()[0].Child("c")
+
+	tests := []struct {
+		format string
+		value  *XMLValue
+		want   string
+	}{
+		{"%s", &b.XMLValue, "x < y & z"},
+		{"%v", &b.XMLValue, "x < y & z"},
+		{"%q", &b.XMLValue, `"x < y & z"`},
+		{"%s", &c.XMLValue, ""},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprintf(test.format, test.value); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.format, got, test.want)
+		}
+	}
+	if got := b.XMLValue.String(); got != "x < y & z" {
+		t.Errorf("String: got %q", got)
+	}
+}
+
+func TestFormatVerbs(t *testing.T) {
+	tree := readTree(t, `<a><b>1</b></a>`)
+	a := tree.Elements.Elements()[0]
+
+	tests := []struct{ format, want string }{
+		{"%v", "<a><b>1</b></a>"},
+		{"%s", "<a><b>1</b></a>"},
+		{"%+v", "<a>\n\t<b>1</b>\n</a>"},
+		{"%q", `"<a><b>1</b></a>"`},
+		{"%d", "%!d(*xmltree.XMLElement)"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprintf(test.format, a); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	tree := readTree(t, "<a xmlns=\"urn:x\" xmlns:p=\"urn:p\">\n<b p:y=\"2\">1</b><!--c--></a>")
+	got := fmt.Sprintf("%#v", tree)
+	want := "XMLTree\n" +
+		"  XMLElement <{urn:x}a> @1:1 xmlns=\"urn:x\" xmlns:p=\"urn:p\"\n" +
+		"    XMLElement <{urn:x}b> @2:1 {urn:p}y=\"2\" \"1\"\n" +
+		"    XMLComment \"c\"\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEncodeDeclaresNamespaceOnce(t *testing.T) {
+	tests := []struct{ in, want string }{
+		// decoded with its declaration
+		{`<a xmlns="urn:x" />`, `<a xmlns="urn:x" />`},
+	}
+	for _, test := range tests {
+		if got := readTree(t, test.in).String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	// an element that was built in a namespace (and so carries no declaration of its own)
+	e := MakeElement("b")
+	e.Name.Space = "urn:x"
+	if got, want := e.String(), `<b xmlns="urn:x" />`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// an attribute which merely has the local name xmlns isn't a declaration
+	e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Space: "urn:p", Local: "xmlns"}, Value: "v"})
+	if e.declaresDefaultNamespace() {
+		t.Errorf("%s: declares a default namespace", e)
+	}
+}
@@ -3,6 +3,8 @@ package xmltree
 import (
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 
 	"github.com/lucky-wolf/xml-tree/etc"
 )
@@ -35,9 +37,13 @@ func (v *XMLValue) Elements() (elements []*XMLElement) {
 	return
 }
 
+// note: the clone belongs to no one until it's given to an element (see XMLElement.Clone)
 func (v XMLValue) Clone() XMLValue {
 	// v is already a shallow copy, just do a deep copy on the contents
 	v.contents = CloneContents(v.contents)
+	v.owner = nil
+	v.journal = nil
+	v.numbers = nil
 	return v
 }
 
@@ -54,7 +60,7 @@ func (v *XMLValue) SetContents(contents any) {
 		panic(err)
 	}
 
-	v.contents = contents
+	v.replaceContents(contents)
 }
 
 func (v *XMLValue) CloneContents() any {
@@ -73,7 +79,7 @@ func CloneContents(contents any) any {
 		return contents
 
 	case *XMLElement:
-		return &XMLElement{StartElement: t.StartElement.Copy(), XMLValue: t.XMLValue.Clone()}
+		return t.Clone()
 	case *XMLComment:
 		return &XMLComment{Comment: t.Copy()}
 	case *XMLDirective:
@@ -83,6 +89,9 @@ func CloneContents(contents any) any {
 
 	case string:
 		return t
+	case nil:
+		// empty
+		return nil
 	}
 
 	err := fmt.Errorf("cannot clone: invalid contents: %T", contents)
@@ -126,11 +135,17 @@ func (v *XMLValue) Append(e ...any) (err error) {
 
 	case *XMLElement:
 		// expand from a single element to an array of any
+		v.record()
 		v.contents = append([]any{t}, e...)
+		v.adopt(e...)
+		v.touch()
 
 	case []any:
 		// append slice
+		v.record()
 		v.contents = append(t, e...)
+		v.adopt(e...)
+		v.touch()
 
 	default:
 		err = fmt.Errorf("xmlvalue must be *XMLElement or []any, not %t", v.contents)
@@ -147,6 +162,7 @@ func (v *XMLValue) Truncate(count int) (err error) {
 	case []any:
 
 		// create a new slice to hold what we're keeping
+		v.record()
 		keep := []any{}
 
 		// build a new collection including count elements and whatever else was there before
@@ -157,6 +173,8 @@ func (v *XMLValue) Truncate(count int) (err error) {
 					// keep it
 					keep = append(keep, t[i])
 					j++
+				} else {
+					v.disown(t[i])
 				}
 			default:
 				// keep non-elements always
@@ -164,6 +182,7 @@ func (v *XMLValue) Truncate(count int) (err error) {
 			}
 		}
 		v.contents = keep
+		v.touch()
 
 	default:
 		err = fmt.Errorf("xmlvalue must be []any, not %t", v.contents)
@@ -178,7 +197,9 @@ func (v *XMLValue) InsertCopyOf(index, copy int) (err error) {
 	switch t := v.contents.(type) {
 
 	case []any:
+		v.record()
 		v.contents = etc.InsertAt(t, index, t[copy])
+		v.touch()
 
 	default:
 		err = fmt.Errorf("xmlvalue must be []any")
@@ -194,7 +215,10 @@ func (v *XMLValue) InsertAt(index int, e *XMLElement) (err error) {
 	switch t := v.contents.(type) {
 
 	case []any:
+		v.record()
 		v.contents = etc.InsertAt(t, index, any(e))
+		v.adopt(e)
+		v.touch()
 
 	default:
 		err = fmt.Errorf("xmlvalue must be []any")
@@ -203,6 +227,87 @@ func (v *XMLValue) InsertAt(index int, e *XMLElement) (err error) {
 	return
 }
 
+// our contents as a list of items (anything but text can be made into one)
+func (v *XMLValue) items() (items []any, err error) {
+	switch t := v.contents.(type) {
+	case []any:
+		items = t
+	case nil:
+		items = []any{}
+	case string:
+		if strings.TrimSpace(t) != "" {
+			err = fmt.Errorf("cannot mix text and child items (mixed content is not supported)")
+			return
+		}
+		items = []any{}
+	default:
+		items = []any{t}
+	}
+	return
+}
+
+// the contents index of item (compared by identity), or -1
+func (v *XMLValue) itemIndex(item any) int {
+	items, _ := v.items()
+	for i, it := range items {
+		if it == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// inserts any kind of child items (elements, comments, processing instructions) at the given contents index
+func (v *XMLValue) insertItems(index int, items ...any) (err error) {
+	t, err := v.items()
+	if err != nil {
+		return
+	}
+	if index < 0 || index > len(t) {
+		err = fmt.Errorf("index out of bounds")
+		return
+	}
+	v.record()
+	v.contents = slices.Insert(t, index, items...)
+	v.adopt(items...)
+	v.touch()
+	return
+}
+
+// removes the given child item
+func (v *XMLValue) removeItem(item any) (err error) {
+	i := v.itemIndex(item)
+	if i == -1 {
+		err = fmt.Errorf("item not found")
+		return
+	}
+	if _, ok := v.contents.([]any); !ok {
+		v.replaceContents([]any{})
+		return
+	}
+	return v.RemoveSpan(i, 1)
+}
+
+// puts replacement in the place of the given child item
+func (v *XMLValue) replaceItem(item, replacement any) (err error) {
+	i := v.itemIndex(item)
+	if i == -1 {
+		err = fmt.Errorf("item not found")
+		return
+	}
+	t, ok := v.contents.([]any)
+	if !ok {
+		v.replaceContents(replacement)
+		return
+	}
+	v.record()
+	v.disown(item)
+	t[i] = replacement
+	v.adopt(replacement)
+	v.touch()
+	return
+}
+
 // we must already be a []any or this is an error
 // warn: YOU MUST GIVE US INDEXES using ChildIndex, not from Elements()
 func (v *XMLValue) RemoveSpan(startIndex int, count int) (err error) {
@@ -216,7 +321,10 @@ func (v *XMLValue) RemoveSpan(startIndex int, count int) (err error) {
 
 		// a zero count is a special case of "do nothing"
 		if count != 0 {
+			v.record()
+			v.disown(t[startIndex : startIndex+count]...)
 			v.contents = etc.RemoveSpanInSitu(t, startIndex, count)
+			v.touch()
 		}
 
 	default:
@@ -252,12 +360,14 @@ func (v *XMLValue) Reorder(from, to int) (err error) {
 
 	case []any:
 		if from != to {
+			v.record()
 			// todo: we could optimize the shifted cells in the array for minimum copying
 			// however, this is a slice of any, which are pointers, so not a biggie
 			// todo: what would be really cool would be a generalized algo that could figure out the minimum moves to achieve end results from the whole list of changes
 			e := t[from]                         // subtle: we need to grab e BEFORE we remove it!
 			t = etc.RemoveSpanInSitu(t, from, 1) // subtle: this shouldn't change memory locations
 			v.contents = etc.InsertAt(t, to, e)  // subtle: this shouldn't change memory locations
+			v.touch()
 		}
 
 	default:
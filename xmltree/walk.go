@@ -0,0 +1,153 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// full tree walks with pre and post order callbacks
+// a callback returns nil to carry on, SkipChildren to not descend into the current element, Stop to end the walk
+// quietly, or any other error to abort the walk with that error
+// note: each level's children are snapshotted before they're visited, so callbacks may edit the tree as they go
+// (elements added to a level already being walked aren't visited; removed ones still are)
+
+var (
+	SkipChildren = errors.New("skip this element's children")
+	Stop         = errors.New("stop walking")
+)
+
+// called for each element, with ctx describing where it is
+// warn: ctx is only valid for the duration of the call (it's reused as the walk proceeds)
+type WalkFunc func(ctx *WalkContext, e *XMLElement) error
+
+// where we are in a walk
+type WalkContext struct {
+	ancestors []*XMLElement // outermost first
+	steps     []string      // the path steps to each ancestor and then the current element
+	relative  bool          // the first step is the element the walk started at, which isn't part of the path
+}
+
+// our ancestors, outermost first (a copy, so it's yours to keep)
+func (ctx *WalkContext) Ancestors() []*XMLElement {
+	return slices.Clone(ctx.ancestors)
+}
+
+// our immediate ancestor (nil for the elements the walk started at)
+func (ctx *WalkContext) Parent() *XMLElement {
+	if len(ctx.ancestors) == 0 {
+		return nil
+	}
+	return ctx.ancestors[len(ctx.ancestors)-1]
+}
+
+// how deep we are (0 for the elements the walk started at)
+func (ctx *WalkContext) Depth() int {
+	return len(ctx.ancestors)
+}
+
+// the slash path to the current element, which can be handed to At on whatever was walked
+// steps carry an index whenever their tag isn't unique among their siblings, e.g. Items/Item[2]/Name
+func (ctx *WalkContext) Path() string {
+	if ctx.relative {
+		return strings.Join(ctx.steps[1:], "/")
+	}
+	return strings.Join(ctx.steps, "/")
+}
+
+// the path step for each of these elements (which must all be siblings)
+func pathSteps(elements []*XMLElement) (steps []string) {
+	counts := map[string]int{}
+	for _, e := range elements {
+		counts[e.Name.Local]++
+	}
+	seen := map[string]int{}
+	for _, e := range elements {
+		tag := e.Name.Local
+		seen[tag]++
+		if counts[tag] == 1 {
+			steps = append(steps, tag)
+		} else {
+			steps = append(steps, fmt.Sprintf("%s[%d]", tag, seen[tag]))
+		}
+	}
+	return
+}
+
+// the slash path from our root to us, as tree.Walk would give it (so it can be handed to tree.At)
+// note: if we're not at the top level of a tree, the path starts at our topmost ancestor (see Root)
+func (e *XMLElement) Path() string {
+	var steps []string
+	for ; e != nil; e = e.parent {
+		step := e.Name.Local
+		if e.parent != nil {
+			siblings := e.parent.Elements()
+			step = pathSteps(siblings)[slices.Index(siblings, e)]
+		}
+		steps = append(steps, step)
+	}
+	slices.Reverse(steps)
+	return strings.Join(steps, "/")
+}
+
+// walks each of the elements and their descendants (depth first, in document order)
+// returns true if the walk should end (err says why, and is nil for Stop)
+func (ctx *WalkContext) walk(elements []*XMLElement, pre, post WalkFunc) (done bool, err error) {
+	steps := pathSteps(elements)
+	for i, e := range elements {
+		ctx.steps = append(ctx.steps, steps[i])
+
+		skip := false
+		if pre != nil {
+			err = pre(ctx, e)
+			skip = err == SkipChildren
+			if err != nil && !skip {
+				return true, quietStop(err)
+			}
+		}
+
+		if !skip {
+			ctx.ancestors = append(ctx.ancestors, e)
+			done, err = ctx.walk(e.Elements(), pre, post)
+			ctx.ancestors = ctx.ancestors[:len(ctx.ancestors)-1]
+			if done {
+				return
+			}
+		}
+
+		if post != nil {
+			err = post(ctx, e)
+			if err != nil && err != SkipChildren {
+				return true, quietStop(err)
+			}
+		}
+
+		ctx.steps = ctx.steps[:len(ctx.steps)-1]
+	}
+	return false, nil
+}
+
+// Stop ends a walk without an error
+func quietStop(err error) error {
+	if err == Stop {
+		return nil
+	}
+	return err
+}
+
+// walks every element in the tree, calling pre before visiting an element's children and post afterwards
+// either callback may be nil; post is still called for an element whose pre returned SkipChildren
+// paths start with the root element (so they can be handed to tree.At)
+func (tree *XMLTree) Walk(pre, post WalkFunc) (err error) {
+	_, err = (&WalkContext{}).walk(tree.Elements.Elements(), pre, post)
+	return
+}
+
+// walks us and all of our descendants, calling pre before visiting an element's children and post afterwards
+// either callback may be nil; post is still called for an element whose pre returned SkipChildren
+// we're at depth 0, and paths are relative to us (so ours is empty)
+func (e *XMLElement) Walk(pre, post WalkFunc) (err error) {
+	_, err = (&WalkContext{relative: true}).walk([]*XMLElement{e}, pre, post)
+	return
+}
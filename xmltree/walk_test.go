@@ -0,0 +1,201 @@
+package xmltree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const walkTestXML = `<Root><Items><Item><Name>A</Name></Item><Item><Name>B</Name></Item></Items><Other /></Root>`
+
+// records each visit as "pre path@depth" or "post path@depth"
+func walkRecorder(log *[]string, order string, result func(ctx *WalkContext, e *XMLElement) error) WalkFunc {
+	return func(ctx *WalkContext, e *XMLElement) error {
+		*log = append(*log, fmt.Sprintf("%s %s@%d", order, ctx.Path(), ctx.Depth()))
+		if result == nil {
+			return nil
+		}
+		return result(ctx, e)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	var log []string
+	err := tree.Walk(walkRecorder(&log, "pre", nil), walkRecorder(&log, "post", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"pre Root@0",
+		"pre Root/Items@1",
+		"pre Root/Items/Item[1]@2",
+		"pre Root/Items/Item[1]/Name@3",
+		"post Root/Items/Item[1]/Name@3",
+		"post Root/Items/Item[1]@2",
+		"pre Root/Items/Item[2]@2",
+		"pre Root/Items/Item[2]/Name@3",
+		"post Root/Items/Item[2]/Name@3",
+		"post Root/Items/Item[2]@2",
+		"post Root/Items@1",
+		"pre Root/Other@1",
+		"post Root/Other@1",
+		"post Root@0",
+	}
+	if !slices.Equal(log, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(log, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWalkPathsResolve(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	err := tree.Walk(func(ctx *WalkContext, e *XMLElement) error {
+		found, err := tree.At(ctx.Path())
+		if err != nil {
+			return err
+		}
+		if found != e {
+			return fmt.Errorf("%s found %s", ctx.Path(), found.Name.Local)
+		}
+		if e.Path() != ctx.Path() {
+			return fmt.Errorf("element path %s, walk path %s", e.Path(), ctx.Path())
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWalkSkipChildren(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	var log []string
+	skip := func(ctx *WalkContext, e *XMLElement) error {
+		if e.Name.Local == "Items" {
+			return SkipChildren
+		}
+		return nil
+	}
+	err := tree.Walk(walkRecorder(&log, "pre", skip), walkRecorder(&log, "post", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pre Root@0", "pre Root/Items@1", "post Root/Items@1", "pre Root/Other@1", "post Root/Other@1", "post Root@0"}
+	if !slices.Equal(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+}
+
+func TestWalkStop(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	var log []string
+	stop := func(ctx *WalkContext, e *XMLElement) error {
+		if v, _ := e.GetStringValue(); v == "A" {
+			return Stop
+		}
+		return nil
+	}
+
+	// stopping in pre
+	err := tree.Walk(walkRecorder(&log, "pre", stop), walkRecorder(&log, "post", nil))
+	if err != nil {
+		t.Fatalf("Stop should end the walk quietly, got %v", err)
+	}
+	if got := log[len(log)-1]; got != "pre Root/Items/Item[1]/Name@3" || len(log) != 4 {
+		t.Errorf("walk went on after Stop: %q", log)
+	}
+
+	// stopping in post
+	log = nil
+	err = tree.Walk(nil, walkRecorder(&log, "post", stop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"post Root/Items/Item[1]/Name@3"}; !slices.Equal(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+
+	// any other error aborts
+	failed := errors.New("failed")
+	err = tree.Walk(func(ctx *WalkContext, e *XMLElement) error {
+		if e.Name.Local == "Other" {
+			return failed
+		}
+		return nil
+	}, nil)
+	if err != failed {
+		t.Errorf("got %v, want %v", err, failed)
+	}
+}
+
+func TestWalkContext(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	err := tree.Walk(func(ctx *WalkContext, e *XMLElement) error {
+		ancestors := ctx.Ancestors()
+		if len(ancestors) != ctx.Depth() {
+			return fmt.Errorf("%s: %d ancestors at depth %d", ctx.Path(), len(ancestors), ctx.Depth())
+		}
+		if ctx.Parent() != e.Parent() {
+			return fmt.Errorf("%s: walk parent isn't the element's parent", ctx.Path())
+		}
+		for i, a := range ancestors {
+			if i > 0 && a.Parent() != ancestors[i-1] {
+				return fmt.Errorf("%s: ancestors out of order", ctx.Path())
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestElementWalk(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+	items, err := tree.At("Root/Items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log []string
+	err = items.Walk(walkRecorder(&log, "pre", func(ctx *WalkContext, e *XMLElement) error {
+		// paths are relative to the element walked
+		if ctx.Depth() != 0 {
+			if found, err := items.At(ctx.Path()); err != nil || found != e {
+				return fmt.Errorf("%s doesn't resolve from the element walked: %v", ctx.Path(), err)
+			}
+		}
+		return nil
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pre @0", "pre Item[1]@1", "pre Item[1]/Name@2", "pre Item[2]@1", "pre Item[2]/Name@2"}
+	if !slices.Equal(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+}
+
+func TestWalkEditing(t *testing.T) {
+	tree := readTree(t, walkTestXML)
+
+	// removing what we visit doesn't upset the walk
+	var names []string
+	err := tree.Walk(func(ctx *WalkContext, e *XMLElement) error {
+		if e.Name.Local == "Item" {
+			names = append(names, e.Elements()[0].StringValue())
+			return e.Remove()
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"A", "B"}) {
+		t.Errorf("got %q", names)
+	}
+	if got, want := tree.String(), `<Root><Items></Items><Other /></Root>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
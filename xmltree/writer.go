@@ -0,0 +1,333 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// token-level writer for producing xml without building an XMLTree first
+// the output is laid out exactly as Encode would lay out the equivalent tree
+// and, like our decoder, an element may hold either text or child nodes, but not both
+
+var ErrNotWellFormed = errors.New("not well-formed")
+
+// what an open element holds so far
+type openContent int
+
+const (
+	contentNone openContent = iota
+	contentText
+	contentChildren
+)
+
+type openElement struct {
+	name    string
+	content openContent
+	text    string // text held until the element ends (or dropped, if only whitespace before a child)
+}
+
+type StreamWriter struct {
+	encoder FormattedEncoder
+	stack   []openElement // currently open elements (innermost last)
+	pending bool          // the innermost start tag is still open for attributes
+	started bool          // something has been written at the root level
+	root    bool          // the root element has been started
+}
+
+// creates a streaming writer on top of the given encoder (configure the encoder first for indentation)
+func NewStreamWriter(encoder FormattedEncoder) (w *StreamWriter) {
+	w = &StreamWriter{encoder: encoder}
+	return
+}
+
+func notWellFormed(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrNotWellFormed, fmt.Sprintf(format, args...))
+}
+
+// true if name is acceptable as an element or attribute name
+func IsValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// depth of open elements
+func (w *StreamWriter) Depth() int {
+	return len(w.stack)
+}
+
+// closes the pending start tag (if any)
+func (w *StreamWriter) closeStartTag() (err error) {
+	if w.pending {
+		w.pending = false
+		err = w.encoder.WriteByte('>')
+	}
+	return
+}
+
+// positions the encoder for the next child node of the innermost element (or at the root level)
+func (w *StreamWriter) beginChild() (err error) {
+
+	// at the root level, nodes are simply separated by newlines
+	if len(w.stack) == 0 {
+		if w.started {
+			err = w.encoder.Indent(true, 0, true)
+		} else {
+			err = w.encoder.Indent(false, 0, true)
+		}
+		w.started = true
+		return
+	}
+
+	err = w.closeStartTag()
+	if err != nil {
+		return
+	}
+
+	top := &w.stack[len(w.stack)-1]
+	switch top.content {
+	case contentNone:
+		// first child: any whitespace before it was just formatting, and we start indenting deeper
+		top.text = ""
+		err = w.encoder.Indent(true, 1, true)
+	case contentChildren:
+		err = w.encoder.Indent(true, 0, true)
+	case contentText:
+		err = notWellFormed("cannot combine text and children elements in %s", top.name)
+		return
+	}
+	top.content = contentChildren
+
+	return
+}
+
+// starts a new element (attributes may be added until anything else is written)
+func (w *StreamWriter) StartElement(name string) (err error) {
+
+	if !IsValidName(name) {
+		err = notWellFormed("invalid element name %q", name)
+		return
+	}
+
+	if len(w.stack) == 0 {
+		if w.root {
+			err = notWellFormed("only one root element allowed, found %s", name)
+			return
+		}
+		w.root = true
+	}
+
+	err = w.beginChild()
+	if err != nil {
+		return
+	}
+
+	_, err = w.encoder.WriteString("<" + name)
+	if err != nil {
+		return
+	}
+
+	w.stack = append(w.stack, openElement{name: name})
+	w.pending = true
+	return
+}
+
+// adds an attribute to the element just started
+func (w *StreamWriter) Attr(name, value string) (err error) {
+
+	if !w.pending || w.stack[len(w.stack)-1].text != "" {
+		err = notWellFormed("attribute %s must directly follow a start element", name)
+		return
+	}
+
+	if !IsValidName(name) {
+		err = notWellFormed("invalid attribute name %q", name)
+		return
+	}
+
+	err = w.encoder.WriteByte(' ')
+	if err != nil {
+		return
+	}
+
+	err = EncodeAttr(xml.Attr{Name: xml.Name{Local: name}, Value: value}, w.encoder)
+	return
+}
+
+// writes text content for the current element (escaped and normalized the same as XMLValue.Encode)
+// note: at the root level, only whitespace is allowed (and is dropped)
+// note: text is held until the element ends, so that it's normalized as a whole (and written as Encode would write it)
+// whitespace alone doesn't commit the element to text, as a child element may still follow it (dropping it, as the decoder does)
+func (w *StreamWriter) Text(text string) (err error) {
+
+	if len(w.stack) == 0 {
+		if len(strings.TrimSpace(text)) != 0 {
+			err = notWellFormed("text outside of the root element: %q", text)
+		}
+		return
+	}
+
+	top := &w.stack[len(w.stack)-1]
+	if top.content == contentChildren {
+		// whitespace between children is just formatting, which we supply ourselves
+		if len(strings.TrimSpace(text)) != 0 {
+			err = notWellFormed("cannot combine text and children elements in %s", top.name)
+		}
+		return
+	}
+
+	top.text += text
+	if len(strings.TrimSpace(text)) != 0 {
+		top.content = contentText
+	}
+	return
+}
+
+// writes a comment (as its own node)
+func (w *StreamWriter) Comment(text string) (err error) {
+
+	if strings.Contains(text, "--") || strings.HasSuffix(text, "-") {
+		err = notWellFormed("comment cannot contain '--' or end in '-': %q", text)
+		return
+	}
+
+	err = w.beginChild()
+	if err != nil {
+		return
+	}
+
+	c := XMLComment{xml.Comment(text)}
+	err = c.Encode(w.encoder)
+	return
+}
+
+// writes a processing instruction (such as the <?xml ...?> declaration)
+func (w *StreamWriter) ProcInst(target, inst string) (err error) {
+
+	if !IsValidName(target) || strings.Contains(inst, "?>") {
+		err = notWellFormed("invalid processing instruction %q %q", target, inst)
+		return
+	}
+
+	err = w.beginChild()
+	if err != nil {
+		return
+	}
+
+	pi := XMLProcInst{xml.ProcInst{Target: target, Inst: []byte(inst)}}
+	err = pi.Encode(w.encoder)
+	return
+}
+
+// closes the innermost open element, which must be the given one
+func (w *StreamWriter) EndElement(name string) (err error) {
+
+	if len(w.stack) == 0 {
+		err = notWellFormed("end element %s without a matching start element", name)
+		return
+	}
+
+	top := w.stack[len(w.stack)-1]
+	if top.name != name {
+		err = notWellFormed("end element %s does not match open element %s", name, top.name)
+		return
+	}
+	w.stack = w.stack[:len(w.stack)-1]
+
+	switch {
+	case top.content == contentChildren:
+		err = w.encoder.Indent(true, -1, true)
+		if err != nil {
+			return
+		}
+	case strings.TrimSpace(top.text) == "" || normalizationOf(w.encoder).Text(name, top.text) == "":
+		// no text worth writing: self-closing (as Encode would for an empty value)
+		w.pending = false
+		_, err = w.encoder.WriteString(" />")
+		return
+	default:
+		err = w.closeStartTag()
+		if err != nil {
+			return
+		}
+		err = encodeText(name, top.text, w.encoder)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = w.encoder.WriteString("</" + name + ">")
+	return
+}
+
+// writes a simple element (start + text + end)
+func (w *StreamWriter) TextElement(name, text string) (err error) {
+	err = w.StartElement(name)
+	if err != nil {
+		return
+	}
+	err = w.Text(text)
+	if err != nil {
+		return
+	}
+	return w.EndElement(name)
+}
+
+// writes a prebuilt element (and its subtree) as the next child node
+func (w *StreamWriter) WriteElement(e *XMLElement) (err error) {
+
+	if len(w.stack) == 0 {
+		if w.root {
+			err = notWellFormed("only one root element allowed, found %s", e.Name.Local)
+			return
+		}
+		w.root = true
+	}
+
+	err = w.beginChild()
+	if err != nil {
+		return
+	}
+
+	err = e.Encode(w.encoder)
+	return
+}
+
+// flushes any buffered output to the underlying stream
+func (w *StreamWriter) Flush() error {
+	return w.encoder.Flush()
+}
+
+// verifies that the document is complete, then terminates the last line and closes the encoder
+func (w *StreamWriter) Close() (err error) {
+
+	if len(w.stack) != 0 {
+		err = notWellFormed("unclosed element %s", w.stack[len(w.stack)-1].name)
+		return
+	}
+
+	if !w.root {
+		err = notWellFormed("no root element")
+		return
+	}
+
+	err = w.encoder.Indent(true, 0, false)
+	if err != nil {
+		return
+	}
+
+	err = w.encoder.Close()
+	return
+}
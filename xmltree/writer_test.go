@@ -0,0 +1,172 @@
+package xmltree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// writes with a stream writer (indented by tabs), failing the test if it errors
+func streamed(t *testing.T, write func(w *StreamWriter) error) string {
+	t.Helper()
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	encoder.Configure("", "\t")
+	w := NewStreamWriter(encoder)
+	err := write(w)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+// encodes the tree as streamed would
+func indentedTree(t *testing.T, tree *XMLTree) string {
+	t.Helper()
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	encoder.Configure("", "\t")
+	err := tree.Encode(encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestStreamWriterMatchesEncode(t *testing.T) {
+	prebuilt := readTree(t, `<Item id="2"><Name>b</Name></Item>`).Elements.Elements()[0]
+	got := streamed(t, func(w *StreamWriter) (err error) {
+		steps := []func() error{
+			func() error { return w.ProcInst("xml", `version="1.0"`) },
+			func() error { return w.StartElement("Root") },
+			func() error { return w.Attr("note", `a "b" & <c>`) },
+			func() error { return w.Comment(" items ") },
+			func() error { return w.StartElement("Item") },
+			func() error { return w.Attr("id", "1") },
+			func() error { return w.TextElement("Name", "a < b & c") },
+			func() error { return w.TextElement("Empty", "") },
+			func() error { return w.StartElement("Blank") },
+			func() error { return w.Text(" ") },
+			func() error { return w.EndElement("Blank") },
+			func() error { return w.StartElement("Spaced") },
+			func() error { return w.Text("  ") },
+			func() error { return w.Text("x  ") },
+			func() error { return w.EndElement("Spaced") },
+			func() error { return w.EndElement("Item") },
+			func() error { return w.WriteElement(prebuilt) },
+			func() error { return w.EndElement("Root") },
+		}
+		for _, step := range steps {
+			err = step()
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+
+	want := indentedTree(t, readTree(t, `<?xml version="1.0"?><Root note="a &quot;b&quot; &amp; &lt;c&gt;"><!-- items -->`+
+		`<Item id="1"><Name>a &lt; b &amp; c</Name><Empty></Empty><Blank> </Blank><Spaced>  x  </Spaced></Item>`+
+		`<Item id="2"><Name>b</Name></Item></Root>`))
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStreamWriterWhitespaceBeforeChildren(t *testing.T) {
+	got := streamed(t, func(w *StreamWriter) (err error) {
+		for _, step := range []func() error{
+			func() error { return w.StartElement("a") },
+			func() error { return w.Text("\n\t") },
+			func() error { return w.TextElement("b", "1") },
+			func() error { return w.Text("\n") },
+			func() error { return w.EndElement("a") },
+		} {
+			err = step()
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	if want := "<a>\n\t<b>1</b>\n</a>\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStreamWriterHeldTextIsNormalizedWhole(t *testing.T) {
+	sb := &strings.Builder{}
+	encoder := NewEncoder(sb)
+	encoder.ConfigureCompact()
+	encoder.ConfigureNormalization(&Normalization{CollapseWhitespace: true, NormalizeNumbers: []string{"n"}})
+	w := NewStreamWriter(encoder)
+	for _, err := range []error{
+		w.StartElement("a"),
+		w.StartElement("n"), w.Text("01."), w.Text("50"), w.EndElement("n"),
+		w.StartElement("s"), w.Text("  "), w.Text(" "), w.EndElement("s"),
+		w.EndElement("a"),
+		w.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := sb.String(), "<a><n>1.5</n><s /></a>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStreamWriterNotWellFormed(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *StreamWriter) error
+	}{
+		{"invalid name", func(w *StreamWriter) error { return w.StartElement("1a") }},
+		{"two roots", func(w *StreamWriter) error {
+			w.StartElement("a")
+			w.EndElement("a")
+			return w.StartElement("b")
+		}},
+		{"mismatched end", func(w *StreamWriter) error {
+			w.StartElement("a")
+			return w.EndElement("b")
+		}},
+		{"end without start", func(w *StreamWriter) error { return w.EndElement("a") }},
+		{"text at the root", func(w *StreamWriter) error { return w.Text("x") }},
+		{"text then child", func(w *StreamWriter) error {
+			w.StartElement("a")
+			w.Text("x")
+			return w.StartElement("b")
+		}},
+		{"child then text", func(w *StreamWriter) error {
+			w.StartElement("a")
+			w.TextElement("b", "1")
+			return w.Text("x")
+		}},
+		{"attribute after text", func(w *StreamWriter) error {
+			w.StartElement("a")
+			w.Text("x")
+			return w.Attr("y", "1")
+		}},
+		{"attribute after child", func(w *StreamWriter) error {
+			w.StartElement("a")
+			w.TextElement("b", "1")
+			return w.Attr("y", "1")
+		}},
+		{"bad comment", func(w *StreamWriter) error { return w.Comment("a--b") }},
+		{"unclosed", func(w *StreamWriter) error {
+			w.StartElement("a")
+			return w.Close()
+		}},
+		{"no root", func(w *StreamWriter) error { return w.Close() }},
+	}
+	for _, test := range tests {
+		w := NewStreamWriter(NewEncoder(&strings.Builder{}))
+		if err := test.write(w); !errors.Is(err, ErrNotWellFormed) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrNotWellFormed)
+		}
+	}
+}
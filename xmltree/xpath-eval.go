@@ -0,0 +1,974 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// xpath 1.0 evaluation over an XMLTree (or the subtree of an XMLElement)
+// results are node-sets ([]*XPathNode in document order), strings, numbers (float64) or booleans
+
+type XPathNodeKind int
+
+const (
+	XPathRootNode XPathNodeKind = iota
+	XPathElementNode
+	XPathAttributeNode
+	XPathTextNode
+	XPathCommentNode
+	XPathProcInstNode
+)
+
+func (k XPathNodeKind) String() string {
+	switch k {
+	case XPathRootNode:
+		return "root"
+	case XPathElementNode:
+		return "element"
+	case XPathAttributeNode:
+		return "attribute"
+	case XPathTextNode:
+		return "text"
+	case XPathCommentNode:
+		return "comment"
+	case XPathProcInstNode:
+		return "processing-instruction"
+	}
+	return fmt.Sprintf("XPathNodeKind(%d)", int(k))
+}
+
+// a node as seen by xpath (a view onto the tree: elements, their attributes and text, comments and processing instructions)
+// note: nodes are unique within one evaluation, so they may be compared by pointer
+type XPathNode struct {
+	kind    XPathNodeKind
+	parent  *XPathNode
+	index   int         // position within our parent (attributes are negative, so they come before any children)
+	element *XMLElement // element nodes (and the owner of attribute and text nodes)
+	attr    *xml.Attr   // attribute nodes
+	item    any         // *XMLComment or *XMLProcInst
+	text    string      // text nodes
+	value   *XMLValue   // the contents this node's children come from (root and element nodes)
+
+	children   []*XPathNode // lazily built
+	attributes []*XPathNode // lazily built
+	built      bool
+}
+
+func (n *XPathNode) Kind() XPathNodeKind {
+	return n.kind
+}
+
+// returns the element for element nodes, or the owning element for attribute and text nodes (nil otherwise)
+func (n *XPathNode) Element() *XMLElement {
+	return n.element
+}
+
+// returns the attribute for attribute nodes (nil otherwise)
+// warn: this points into the element's Attr slice, so it is only valid until the element's attributes change
+func (n *XPathNode) Attr() *xml.Attr {
+	return n.attr
+}
+
+// returns the comment or processing instruction for those nodes (nil otherwise)
+func (n *XPathNode) Item() any {
+	return n.item
+}
+
+func (n *XPathNode) Parent() *XPathNode {
+	return n.parent
+}
+
+// where this node (or its owning element) was found in the source document
+func (n *XPathNode) Position() Position {
+	if n.element != nil {
+		return n.element.pos
+	}
+	return Position{}
+}
+
+// the node's expanded name (the empty name for nodes without one)
+func (n *XPathNode) Name() xml.Name {
+	switch n.kind {
+	case XPathElementNode:
+		return n.element.Name
+	case XPathAttributeNode:
+		return n.attr.Name
+	case XPathProcInstNode:
+		return xml.Name{Local: n.item.(*XMLProcInst).Target}
+	}
+	return xml.Name{}
+}
+
+// the xpath string-value of this node
+func (n *XPathNode) StringValue() string {
+	switch n.kind {
+	case XPathAttributeNode:
+		return n.attr.Value
+	case XPathTextNode:
+		return n.text
+	case XPathCommentNode:
+		return string(n.item.(*XMLComment).Comment)
+	case XPathProcInstNode:
+		return string(n.item.(*XMLProcInst).Inst)
+	}
+
+	// root and element: the concatenation of all descendant text
+	sb := &strings.Builder{}
+	var gather func(n *XPathNode)
+	gather = func(n *XPathNode) {
+		for _, c := range n.Children() {
+			switch c.kind {
+			case XPathTextNode:
+				sb.WriteString(c.text)
+			case XPathElementNode:
+				gather(c)
+			}
+		}
+	}
+	gather(n)
+	return sb.String()
+}
+
+func (n *XPathNode) String() string {
+	switch n.kind {
+	case XPathRootNode:
+		return "/"
+	case XPathElementNode:
+		return n.element.Name.Local
+	case XPathAttributeNode:
+		return "@" + n.attr.Name.Local
+	case XPathTextNode:
+		return "text()"
+	case XPathCommentNode:
+		return "comment()"
+	}
+	return "processing-instruction()"
+}
+
+func (n *XPathNode) build() {
+	if n.built {
+		return
+	}
+	n.built = true
+
+	if n.kind == XPathElementNode {
+		for i := range n.element.Attr {
+			n.attributes = append(n.attributes, &XPathNode{
+				kind:    XPathAttributeNode,
+				parent:  n,
+				index:   i - len(n.element.Attr),
+				element: n.element,
+				attr:    &n.element.Attr[i],
+			})
+		}
+	}
+
+	if n.value == nil {
+		return
+	}
+
+	add := func(c any) {
+		child := &XPathNode{parent: n, index: len(n.children)}
+		switch t := c.(type) {
+		case *XMLElement:
+			child.kind = XPathElementNode
+			child.element = t
+			child.value = &t.XMLValue
+		case *XMLComment:
+			child.kind = XPathCommentNode
+			child.item = t
+		case *XMLProcInst:
+			child.kind = XPathProcInstNode
+			child.item = t
+		case string:
+			if t == "" {
+				return
+			}
+			child.kind = XPathTextNode
+			child.element = n.element
+			child.text = t
+		default:
+			// directives are not part of the xpath data model
+			return
+		}
+		n.children = append(n.children, child)
+	}
+
+	switch t := n.value.contents.(type) {
+	case []any:
+		for _, c := range t {
+			add(c)
+		}
+	case nil:
+	default:
+		add(t)
+	}
+}
+
+// child nodes (in document order)
+func (n *XPathNode) Children() []*XPathNode {
+	n.build()
+	return n.children
+}
+
+// attribute nodes (in document order)
+func (n *XPathNode) Attributes() []*XPathNode {
+	n.build()
+	return n.attributes
+}
+
+// returns the index path from the root to this node (used for document order)
+func (n *XPathNode) path() (path []int) {
+	for ; n.parent != nil; n = n.parent {
+		path = append(path, n.index)
+	}
+	slices.Reverse(path)
+	return
+}
+
+// -1, 0, +1 by document order
+func compareDocumentOrder(a, b *XPathNode) int {
+	if a == b {
+		return 0
+	}
+	return slices.Compare(a.path(), b.path())
+}
+
+// returns the root node for the given tree
+func xpathRootOf(tree *XMLTree) *XPathNode {
+	return &XPathNode{kind: XPathRootNode, value: &tree.Elements}
+}
+
+// returns the element node for e, within the document of its topmost ancestor (so the whole of e's tree is visible)
+// note: elements don't know their tree, so the document holds only that ancestor (not any comments or
+// processing instructions beside it at the top level of the tree)
+func xpathNodeOf(e *XMLElement) *XPathNode {
+	var chain []*XMLElement
+	for a := e; a != nil; a = a.parent {
+		chain = append(chain, a)
+	}
+	root := &XPathNode{kind: XPathRootNode, value: &XMLValue{contents: chain[len(chain)-1]}}
+
+	// walk back down from the root to e
+	n := root
+	for i := len(chain) - 1; i >= 0; i-- {
+		next := slices.IndexFunc(n.Children(), func(c *XPathNode) bool { return c.kind == XPathElementNode && c.element == chain[i] })
+		if next == -1 {
+			// our parent pointers are stale (see RelinkParents), so we can only see our own subtree
+			root = &XPathNode{kind: XPathRootNode, value: &XMLValue{contents: e}}
+			return root.Children()[0]
+		}
+		n = n.Children()[next]
+	}
+	return n
+}
+
+////////////////////////////////////////////////////
+// compiled expressions
+
+// a compiled xpath expression (safe to reuse across trees and goroutines)
+type XPath struct {
+	source string
+	expr   xpExpr
+}
+
+func CompileXPath(source string) (x *XPath, err error) {
+	expr, err := parseXPath(source)
+	if err != nil {
+		return
+	}
+	x = &XPath{source: source, expr: expr}
+	return
+}
+
+// like CompileXPath, but panics if the expression is invalid (handy for package level vars)
+func MustCompileXPath(source string) *XPath {
+	x, err := CompileXPath(source)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+func (x *XPath) String() string {
+	return x.source
+}
+
+// the result of an xpath evaluation
+type XPathResult struct {
+	value any // []*XPathNode, string, float64 or bool
+}
+
+func (r XPathResult) IsNodeSet() bool {
+	_, ok := r.value.([]*XPathNode)
+	return ok
+}
+
+// the nodes (empty if the result is not a node-set)
+func (r XPathResult) Nodes() []*XPathNode {
+	nodes, _ := r.value.([]*XPathNode)
+	return nodes
+}
+
+// the elements from the node-set (other nodes are omitted)
+func (r XPathResult) Elements() (elements []*XMLElement) {
+	for _, n := range r.Nodes() {
+		if n.kind == XPathElementNode {
+			elements = append(elements, n.element)
+		}
+	}
+	return
+}
+
+// the result converted using xpath's string() rules
+func (r XPathResult) String() string {
+	return xpString(r.value)
+}
+
+// the result converted using xpath's number() rules
+func (r XPathResult) Number() float64 {
+	return xpNumber(r.value)
+}
+
+// the result converted using xpath's boolean() rules
+func (r XPathResult) Bool() bool {
+	return xpBoolean(r.value)
+}
+
+// the raw result: []*XPathNode, string, float64 or bool
+func (r XPathResult) Value() any {
+	return r.value
+}
+
+// evaluates against the whole tree (the context node is the root)
+func (x *XPath) Evaluate(tree *XMLTree) (XPathResult, error) {
+	return x.EvaluateWith(xpathRootOf(tree), nil)
+}
+
+// evaluates with the given element as the context node (its ancestors and their other descendants are visible too)
+func (x *XPath) EvaluateElement(e *XMLElement) (XPathResult, error) {
+	return x.EvaluateWith(xpathNodeOf(e), nil)
+}
+
+// evaluates with the given context node and variable bindings (values may be strings, numbers, booleans, or node-sets)
+func (x *XPath) EvaluateWith(context *XPathNode, variables map[string]any) (result XPathResult, err error) {
+	if context == nil {
+		err = fmt.Errorf("xpath %q: no context node", x.source)
+		return
+	}
+	c := &xpContext{node: context, position: 1, size: 1, variables: variables}
+	value, err := x.expr.eval(c)
+	if err != nil {
+		err = fmt.Errorf("xpath %q: %w", x.source, err)
+		return
+	}
+	result.value = value
+	return
+}
+
+// returns the elements selected from the whole tree
+func (x *XPath) SelectElements(tree *XMLTree) (elements []*XMLElement, err error) {
+	result, err := x.Evaluate(tree)
+	if err != nil {
+		return
+	}
+	if !result.IsNodeSet() {
+		err = fmt.Errorf("xpath %q does not select nodes", x.source)
+		return
+	}
+	elements = result.Elements()
+	return
+}
+
+// compiles and evaluates the given expression against the whole tree
+func (tree *XMLTree) XPath(source string) (result XPathResult, err error) {
+	x, err := CompileXPath(source)
+	if err != nil {
+		return
+	}
+	return x.Evaluate(tree)
+}
+
+// compiles and evaluates the given expression against the whole tree, returning the selected elements
+func (tree *XMLTree) XPathElements(source string) (elements []*XMLElement, err error) {
+	x, err := CompileXPath(source)
+	if err != nil {
+		return
+	}
+	return x.SelectElements(tree)
+}
+
+// compiles and evaluates the given expression with this element as the context node
+func (e *XMLElement) XPath(source string) (result XPathResult, err error) {
+	x, err := CompileXPath(source)
+	if err != nil {
+		return
+	}
+	return x.EvaluateElement(e)
+}
+
+// compiles and evaluates the given expression with this element as the context node, returning the selected elements
+func (e *XMLElement) XPathElements(source string) (elements []*XMLElement, err error) {
+	result, err := e.XPath(source)
+	if err != nil {
+		return
+	}
+	if !result.IsNodeSet() {
+		err = fmt.Errorf("xpath %q does not select nodes", source)
+		return
+	}
+	elements = result.Elements()
+	return
+}
+
+////////////////////////////////////////////////////
+// evaluation
+
+type xpContext struct {
+	node      *XPathNode
+	position  int
+	size      int
+	variables map[string]any
+}
+
+func (c *xpContext) with(node *XPathNode, position, size int) *xpContext {
+	return &xpContext{node: node, position: position, size: size, variables: c.variables}
+}
+
+type xpExpr interface {
+	eval(c *xpContext) (any, error)
+}
+
+type xpLiteralExpr struct {
+	value string
+}
+
+func (e *xpLiteralExpr) eval(c *xpContext) (any, error) {
+	return e.value, nil
+}
+
+type xpNumberExpr struct {
+	value float64
+}
+
+func (e *xpNumberExpr) eval(c *xpContext) (any, error) {
+	return e.value, nil
+}
+
+type xpVariableRef struct {
+	name string
+}
+
+func (e *xpVariableRef) eval(c *xpContext) (any, error) {
+	v, ok := c.variables[e.name]
+	if !ok {
+		return nil, fmt.Errorf("undefined variable $%s", e.name)
+	}
+	switch t := v.(type) {
+	case string, float64, bool, []*XPathNode:
+		return t, nil
+	case int:
+		return float64(t), nil
+	case XPathResult:
+		return t.value, nil
+	}
+	return nil, fmt.Errorf("variable $%s has unsupported type %T", e.name, v)
+}
+
+type xpNegate struct {
+	operand xpExpr
+}
+
+func (e *xpNegate) eval(c *xpContext) (any, error) {
+	v, err := e.operand.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	return -xpNumber(v), nil
+}
+
+type xpBinary struct {
+	op       string
+	lhs, rhs xpExpr
+}
+
+func (e *xpBinary) eval(c *xpContext) (result any, err error) {
+
+	lhs, err := e.lhs.eval(c)
+	if err != nil {
+		return
+	}
+
+	// short circuit the logical operators
+	switch e.op {
+	case "or":
+		if xpBoolean(lhs) {
+			return true, nil
+		}
+	case "and":
+		if !xpBoolean(lhs) {
+			return false, nil
+		}
+	}
+
+	rhs, err := e.rhs.eval(c)
+	if err != nil {
+		return
+	}
+
+	switch e.op {
+	case "or", "and":
+		return xpBoolean(rhs), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return xpCompare(e.op, lhs, rhs), nil
+	case "+":
+		return xpNumber(lhs) + xpNumber(rhs), nil
+	case "-":
+		return xpNumber(lhs) - xpNumber(rhs), nil
+	case "*":
+		return xpNumber(lhs) * xpNumber(rhs), nil
+	case "div":
+		return xpNumber(lhs) / xpNumber(rhs), nil
+	case "mod":
+		return math.Mod(xpNumber(lhs), xpNumber(rhs)), nil
+	case "|":
+		l, lok := lhs.([]*XPathNode)
+		r, rok := rhs.([]*XPathNode)
+		if !lok || !rok {
+			return nil, fmt.Errorf("union requires node-sets")
+		}
+		return xpUnion(l, r), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", e.op)
+}
+
+// merges two node-sets (document order, no duplicates)
+func xpUnion(a, b []*XPathNode) []*XPathNode {
+	return xpDocumentOrder(append(slices.Clone(a), b...))
+}
+
+// sorts into document order and removes duplicates
+func xpDocumentOrder(nodes []*XPathNode) []*XPathNode {
+	slices.SortStableFunc(nodes, compareDocumentOrder)
+	return slices.Compact(nodes)
+}
+
+// compares per xpath 1.0 section 3.4
+func xpCompare(op string, lhs, rhs any) bool {
+
+	ln, lset := lhs.([]*XPathNode)
+	rn, rset := rhs.([]*XPathNode)
+
+	switch {
+	case lset && rset:
+		for _, a := range ln {
+			for _, b := range rn {
+				if xpCompareAtoms(op, a.StringValue(), b.StringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+	case lset:
+		return xpCompareSet(op, ln, rhs, false)
+	case rset:
+		return xpCompareSet(op, rn, lhs, true)
+	}
+	return xpCompareAtoms(op, lhs, rhs)
+}
+
+// compares each node in the set against a non-node-set value
+func xpCompareSet(op string, nodes []*XPathNode, other any, swapped bool) bool {
+	if b, ok := other.(bool); ok {
+		if swapped {
+			return xpCompareAtoms(op, b, len(nodes) != 0)
+		}
+		return xpCompareAtoms(op, len(nodes) != 0, b)
+	}
+	for _, n := range nodes {
+		var v any = n.StringValue()
+		if _, ok := other.(float64); ok {
+			v = xpNumber(v)
+		}
+		if swapped && xpCompareAtoms(op, other, v) || !swapped && xpCompareAtoms(op, v, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// compares two non-node-set values
+func xpCompareAtoms(op string, lhs, rhs any) bool {
+	switch op {
+	case "=", "!=":
+		var equal bool
+		_, lb := lhs.(bool)
+		_, rb := rhs.(bool)
+		_, lf := lhs.(float64)
+		_, rf := rhs.(float64)
+		switch {
+		case lb || rb:
+			equal = xpBoolean(lhs) == xpBoolean(rhs)
+		case lf || rf:
+			equal = xpNumber(lhs) == xpNumber(rhs)
+		default:
+			equal = xpString(lhs) == xpString(rhs)
+		}
+		return equal == (op == "=")
+	}
+
+	l, r := xpNumber(lhs), xpNumber(rhs)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+type xpFilter struct {
+	primary    xpExpr
+	predicates []xpExpr
+}
+
+func (e *xpFilter) eval(c *xpContext) (any, error) {
+	v, err := e.primary.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("predicates can only filter node-sets")
+	}
+	// filter expressions always use document order for position()
+	return xpApplyPredicates(c, nodes, e.predicates)
+}
+
+func xpApplyPredicates(c *xpContext, nodes []*XPathNode, predicates []xpExpr) (result []*XPathNode, err error) {
+	result = nodes
+	for _, predicate := range predicates {
+		var kept []*XPathNode
+		for i, n := range result {
+			var v any
+			v, err = predicate.eval(c.with(n, i+1, len(result)))
+			if err != nil {
+				return
+			}
+			if f, ok := v.(float64); ok {
+				if f == float64(i+1) {
+					kept = append(kept, n)
+				}
+			} else if xpBoolean(v) {
+				kept = append(kept, n)
+			}
+		}
+		result = kept
+	}
+	return
+}
+
+type xpNodeTest struct {
+	kind   string // name, node, text, comment, processing-instruction
+	prefix string
+	name   string // local name (or * for any), or the target for processing-instruction
+}
+
+// true if the node passes our test (principal is the axis' principal node kind)
+func (t *xpNodeTest) matches(n *XPathNode, principal XPathNodeKind) bool {
+	switch t.kind {
+	case "node":
+		return true
+	case "text":
+		return n.kind == XPathTextNode
+	case "comment":
+		return n.kind == XPathCommentNode
+	case "processing-instruction":
+		return n.kind == XPathProcInstNode && (t.name == "" || n.Name().Local == t.name)
+	}
+
+	if n.kind != principal {
+		return false
+	}
+	name := n.Name()
+	if t.name != "*" && name.Local != t.name {
+		return false
+	}
+	return t.prefix == "" || xpNamespaceMatches(n, t.prefix, name.Space)
+}
+
+// our decoder gives us namespace urls (or the raw prefix, if it was never declared)
+// so a prefix matches if it is that raw prefix, or it's declared (in scope of the node) as that url
+func xpNamespaceMatches(n *XPathNode, prefix, space string) bool {
+	if space == prefix {
+		return true
+	}
+	for e := n; e != nil; e = e.parent {
+		if e.kind != XPathElementNode {
+			continue
+		}
+		for _, a := range e.element.Attr {
+			if a.Name.Space == "xmlns" && a.Name.Local == prefix {
+				return a.Value == space
+			}
+		}
+	}
+	return false
+}
+
+type xpStep struct {
+	axis       string
+	test       xpNodeTest
+	predicates []xpExpr
+}
+
+// true for axes whose proximity positions run in reverse document order
+func xpReverseAxis(axis string) bool {
+	switch axis {
+	case "ancestor", "ancestor-or-self", "preceding", "preceding-sibling":
+		return true
+	}
+	return false
+}
+
+// returns the nodes along the axis from n, in axis order
+func xpAxisNodes(axis string, n *XPathNode) (nodes []*XPathNode) {
+
+	var descendants func(n *XPathNode)
+	descendants = func(n *XPathNode) {
+		for _, c := range n.Children() {
+			nodes = append(nodes, c)
+			descendants(c)
+		}
+	}
+
+	switch axis {
+	case "self":
+		nodes = append(nodes, n)
+	case "child":
+		nodes = append(nodes, n.Children()...)
+	case "attribute":
+		nodes = append(nodes, n.Attributes()...)
+	case "descendant":
+		descendants(n)
+	case "descendant-or-self":
+		nodes = append(nodes, n)
+		descendants(n)
+	case "parent":
+		if n.parent != nil {
+			nodes = append(nodes, n.parent)
+		}
+	case "ancestor", "ancestor-or-self":
+		if axis == "ancestor-or-self" {
+			nodes = append(nodes, n)
+		}
+		for p := n.parent; p != nil; p = p.parent {
+			nodes = append(nodes, p)
+		}
+	case "following-sibling", "preceding-sibling":
+		if n.parent == nil || n.kind == XPathAttributeNode {
+			return
+		}
+		siblings := n.parent.Children()
+		if axis == "following-sibling" {
+			nodes = append(nodes, siblings[n.index+1:]...)
+		} else {
+			nodes = slices.Clone(siblings[:n.index])
+			slices.Reverse(nodes)
+		}
+	case "following":
+		// everything after us in document order, except our descendants
+		for e := n; e.parent != nil; e = e.parent {
+			if e.kind == XPathAttributeNode {
+				continue
+			}
+			for _, s := range e.parent.Children()[e.index+1:] {
+				nodes = append(nodes, s)
+				descendants(s)
+			}
+		}
+	case "preceding":
+		// everything before us in document order, except our ancestors
+		var all []*XPathNode
+		root := n
+		for root.parent != nil {
+			root = root.parent
+		}
+		nodes = nil
+		descendants(root)
+		all, nodes = nodes, nil
+		ancestors := map[*XPathNode]bool{}
+		for p := n.parent; p != nil; p = p.parent {
+			ancestors[p] = true
+		}
+		for _, c := range all {
+			if compareDocumentOrder(c, n) >= 0 {
+				break
+			}
+			if !ancestors[c] {
+				nodes = append(nodes, c)
+			}
+		}
+		slices.Reverse(nodes)
+	case "namespace":
+		// namespace nodes are not supported (they're always empty)
+	}
+	return
+}
+
+func (s *xpStep) eval(c *xpContext, from []*XPathNode) (result []*XPathNode, err error) {
+
+	principal := XPathElementNode
+	if s.axis == "attribute" {
+		principal = XPathAttributeNode
+	}
+
+	for _, n := range from {
+		var selected []*XPathNode
+		for _, a := range xpAxisNodes(s.axis, n) {
+			if s.test.matches(a, principal) {
+				selected = append(selected, a)
+			}
+		}
+
+		// predicates see positions in axis order
+		selected, err = xpApplyPredicates(c, selected, s.predicates)
+		if err != nil {
+			return
+		}
+		result = append(result, selected...)
+	}
+
+	// results are always in document order
+	if len(from) > 1 || xpReverseAxis(s.axis) {
+		result = xpDocumentOrder(result)
+	}
+	return
+}
+
+type xpPath struct {
+	absolute bool
+	filter   xpExpr // the leading filter expression (if any)
+	steps    []*xpStep
+}
+
+func (e *xpPath) eval(c *xpContext) (any, error) {
+
+	var nodes []*XPathNode
+	switch {
+	case e.absolute:
+		root := c.node
+		for root.parent != nil {
+			root = root.parent
+		}
+		nodes = []*XPathNode{root}
+	case e.filter != nil:
+		v, err := e.filter.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		nodes, ok = v.([]*XPathNode)
+		if !ok {
+			return nil, fmt.Errorf("a path can only follow a node-set")
+		}
+	default:
+		nodes = []*XPathNode{c.node}
+	}
+
+	for _, step := range e.steps {
+		var err error
+		nodes, err = step.eval(c, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nodes == nil {
+		nodes = []*XPathNode{}
+	}
+	return nodes, nil
+}
+
+////////////////////////////////////////////////////
+// conversions (xpath 1.0 section 4)
+
+func xpString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return xpFormatNumber(t)
+	case []*XPathNode:
+		if len(t) == 0 {
+			return ""
+		}
+		return t[0].StringValue()
+	}
+	return ""
+}
+
+func xpFormatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func xpNumber(v any) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case bool:
+		if t {
+			return 1
+		}
+		return 0
+	case string:
+		s := strings.TrimSpace(t)
+		if !decimalNumber.MatchString(s) || strings.HasPrefix(s, "+") || strings.ContainsAny(s, "eE") {
+			return math.NaN()
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	case []*XPathNode:
+		return xpNumber(xpString(t))
+	}
+	return math.NaN()
+}
+
+func xpBoolean(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case float64:
+		return t != 0 && !math.IsNaN(t)
+	case string:
+		return t != ""
+	case []*XPathNode:
+		return len(t) != 0
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package xmltree
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// xpath 1.0 core function library (section 4)
+// note: id() always returns an empty node-set, as we have no DTD to tell us which attributes are ids
+
+type xpFunc struct {
+	minArgs int
+	maxArgs int // -1 for unlimited
+	call    func(c *xpContext, args []any) (any, error)
+}
+
+type xpCall struct {
+	name string
+	fn   *xpFunc
+	args []xpExpr
+}
+
+func (e *xpCall) eval(c *xpContext) (result any, err error) {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		args[i], err = arg.eval(c)
+		if err != nil {
+			return
+		}
+	}
+	result, err = e.fn.call(c, args)
+	if err != nil {
+		err = fmt.Errorf("%s(): %w", e.name, err)
+	}
+	return
+}
+
+// the node-set argument at index i (or the context node if there is no such argument)
+func xpNodeSetArg(c *xpContext, args []any, i int) ([]*XPathNode, error) {
+	if i >= len(args) {
+		return []*XPathNode{c.node}, nil
+	}
+	nodes, ok := args[i].([]*XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("argument %d must be a node-set", i+1)
+	}
+	return nodes, nil
+}
+
+// the string argument at index i (or the context node's string-value if there is no such argument)
+func xpStringArg(c *xpContext, args []any, i int) string {
+	if i >= len(args) {
+		return c.node.StringValue()
+	}
+	return xpString(args[i])
+}
+
+var xpFunctions map[string]*xpFunc
+
+func init() {
+	xpFunctions = map[string]*xpFunc{
+
+		// node-set functions
+		"last": {0, 0, func(c *xpContext, args []any) (any, error) {
+			return float64(c.size), nil
+		}},
+		"position": {0, 0, func(c *xpContext, args []any) (any, error) {
+			return float64(c.position), nil
+		}},
+		"count": {1, 1, func(c *xpContext, args []any) (any, error) {
+			nodes, err := xpNodeSetArg(c, args, 0)
+			return float64(len(nodes)), err
+		}},
+		"id": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return []*XPathNode{}, nil
+		}},
+		"local-name": {0, 1, func(c *xpContext, args []any) (any, error) {
+			nodes, err := xpNodeSetArg(c, args, 0)
+			if err != nil || len(nodes) == 0 {
+				return "", err
+			}
+			return nodes[0].Name().Local, nil
+		}},
+		"namespace-uri": {0, 1, func(c *xpContext, args []any) (any, error) {
+			nodes, err := xpNodeSetArg(c, args, 0)
+			if err != nil || len(nodes) == 0 {
+				return "", err
+			}
+			return nodes[0].Name().Space, nil
+		}},
+		"name": {0, 1, func(c *xpContext, args []any) (any, error) {
+			nodes, err := xpNodeSetArg(c, args, 0)
+			if err != nil || len(nodes) == 0 {
+				return "", err
+			}
+			name := nodes[0].Name()
+			return qualifiedName(xpPrefixFor(nodes[0], name.Space), name.Local), nil
+		}},
+
+		// string functions
+		"string": {0, 1, func(c *xpContext, args []any) (any, error) {
+			return xpStringArg(c, args, 0), nil
+		}},
+		"concat": {2, -1, func(c *xpContext, args []any) (any, error) {
+			sb := &strings.Builder{}
+			for _, arg := range args {
+				sb.WriteString(xpString(arg))
+			}
+			return sb.String(), nil
+		}},
+		"starts-with": {2, 2, func(c *xpContext, args []any) (any, error) {
+			return strings.HasPrefix(xpString(args[0]), xpString(args[1])), nil
+		}},
+		"ends-with": {2, 2, func(c *xpContext, args []any) (any, error) {
+			// not xpath 1.0, but universally expected
+			return strings.HasSuffix(xpString(args[0]), xpString(args[1])), nil
+		}},
+		"contains": {2, 2, func(c *xpContext, args []any) (any, error) {
+			return strings.Contains(xpString(args[0]), xpString(args[1])), nil
+		}},
+		"substring-before": {2, 2, func(c *xpContext, args []any) (any, error) {
+			before, _, found := strings.Cut(xpString(args[0]), xpString(args[1]))
+			if !found {
+				return "", nil
+			}
+			return before, nil
+		}},
+		"substring-after": {2, 2, func(c *xpContext, args []any) (any, error) {
+			_, after, _ := strings.Cut(xpString(args[0]), xpString(args[1]))
+			return after, nil
+		}},
+		"substring": {2, 3, func(c *xpContext, args []any) (any, error) {
+			return xpSubstring(xpString(args[0]), xpNumber(args[1]), args[2:]), nil
+		}},
+		"string-length": {0, 1, func(c *xpContext, args []any) (any, error) {
+			return float64(utf8.RuneCountInString(xpStringArg(c, args, 0))), nil
+		}},
+		"normalize-space": {0, 1, func(c *xpContext, args []any) (any, error) {
+			return strings.Join(strings.Fields(xpStringArg(c, args, 0)), " "), nil
+		}},
+		"translate": {3, 3, func(c *xpContext, args []any) (any, error) {
+			return xpTranslate(xpString(args[0]), xpString(args[1]), xpString(args[2])), nil
+		}},
+
+		// boolean functions
+		"boolean": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return xpBoolean(args[0]), nil
+		}},
+		"not": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return !xpBoolean(args[0]), nil
+		}},
+		"true": {0, 0, func(c *xpContext, args []any) (any, error) {
+			return true, nil
+		}},
+		"false": {0, 0, func(c *xpContext, args []any) (any, error) {
+			return false, nil
+		}},
+		"lang": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return xpLang(c.node, xpString(args[0])), nil
+		}},
+
+		// number functions
+		"number": {0, 1, func(c *xpContext, args []any) (any, error) {
+			if len(args) == 0 {
+				return xpNumber(c.node.StringValue()), nil
+			}
+			return xpNumber(args[0]), nil
+		}},
+		"sum": {1, 1, func(c *xpContext, args []any) (any, error) {
+			nodes, err := xpNodeSetArg(c, args, 0)
+			sum := 0.0
+			for _, n := range nodes {
+				sum += xpNumber(n.StringValue())
+			}
+			return sum, err
+		}},
+		"floor": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return math.Floor(xpNumber(args[0])), nil
+		}},
+		"ceiling": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return math.Ceil(xpNumber(args[0])), nil
+		}},
+		"round": {1, 1, func(c *xpContext, args []any) (any, error) {
+			return xpRound(xpNumber(args[0])), nil
+		}},
+	}
+}
+
+// substring() counts characters from 1 and rounds its arguments
+func xpSubstring(s string, start float64, length []any) string {
+	runes := []rune(s)
+	first := xpRound(start)
+	last := math.Inf(1)
+	if len(length) != 0 {
+		last = first + xpRound(xpNumber(length[0]))
+	}
+	sb := &strings.Builder{}
+	for i, r := range runes {
+		p := float64(i + 1)
+		if p >= first && p < last {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// round half up (towards positive infinity), as xpath requires
+func xpRound(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	return math.Floor(f + 0.5)
+}
+
+func xpTranslate(s, from, to string) string {
+	toRunes := []rune(to)
+	sb := &strings.Builder{}
+	for _, r := range s {
+		i := strings.IndexRune(from, r)
+		if i == -1 {
+			sb.WriteRune(r)
+			continue
+		}
+		i = utf8.RuneCountInString(from[:i])
+		if i < len(toRunes) {
+			sb.WriteRune(toRunes[i])
+		}
+	}
+	return sb.String()
+}
+
+// true if the nearest xml:lang on the node or its ancestors is (a sub-language of) lang
+func xpLang(n *XPathNode, lang string) bool {
+	for ; n != nil; n = n.parent {
+		if n.kind != XPathElementNode {
+			continue
+		}
+		for _, a := range n.element.Attr {
+			if a.Name.Local == "lang" && (a.Name.Space == "xml" || a.Name.Space == "http://www.w3.org/XML/1998/namespace") {
+				v := strings.ToLower(a.Value)
+				l := strings.ToLower(lang)
+				return v == l || strings.HasPrefix(v, l+"-")
+			}
+		}
+	}
+	return false
+}
+
+// returns the prefix declared for the namespace url in scope of the node (or the url itself if it's undeclared)
+func xpPrefixFor(n *XPathNode, space string) string {
+	if space == "" {
+		return ""
+	}
+	for e := n; e != nil; e = e.parent {
+		if e.kind != XPathElementNode {
+			continue
+		}
+		for _, a := range e.element.Attr {
+			if a.Value != space {
+				continue
+			}
+			if a.Name.Space == "xmlns" {
+				return a.Name.Local
+			}
+			if a.Name.Space == "" && a.Name.Local == "xmlns" {
+				return ""
+			}
+		}
+	}
+	return space
+}
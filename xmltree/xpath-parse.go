@@ -0,0 +1,639 @@
+package xmltree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// xpath 1.0 lexer + recursive descent parser
+// the grammar (and the token disambiguation rules) follow https://www.w3.org/TR/xpath-10/
+
+type xpTokenKind int
+
+const (
+	xpEOF        xpTokenKind = iota
+	xpOperator               // and or mod div * / // | + - = != < <= > >=
+	xpNameTest               // * prefix:* name prefix:name
+	xpNodeType               // comment text processing-instruction node (always followed by '(')
+	xpFunction               // function name (always followed by '(')
+	xpAxis                   // axis name (always followed by '::')
+	xpLiteral                // "..." or '...'
+	xpNumeric                //
+	xpVariable               // $name
+	xpLParen                 // (
+	xpRParen                 // )
+	xpLBracket               // [
+	xpRBracket               // ]
+	xpDot                    // .
+	xpDotDot                 // ..
+	xpAt                     // @
+	xpComma                  // ,
+	xpColonColon             // ::
+)
+
+type xpToken struct {
+	kind   xpTokenKind
+	text   string
+	number float64
+	offset int
+}
+
+// how a token is described in error messages
+func (t xpToken) describe() string {
+	if t.kind == xpEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var xpNodeTypes = map[string]bool{"comment": true, "text": true, "processing-instruction": true, "node": true}
+
+type XPathSyntaxError struct {
+	Expr   string
+	Offset int
+	Msg    string
+}
+
+func (e *XPathSyntaxError) Error() string {
+	return fmt.Sprintf("xpath syntax error at offset %d in %q: %s", e.Offset, e.Expr, e.Msg)
+}
+
+type xpLexer struct {
+	source string
+	offset int
+	tokens []xpToken
+}
+
+func (l *xpLexer) fail(msg string, args ...any) error {
+	return &XPathSyntaxError{Expr: l.source, Offset: l.offset, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func (l *xpLexer) peekRune(ahead int) rune {
+	i := l.offset
+	for ; ahead > 0 && i < len(l.source); ahead-- {
+		_, w := utf8.DecodeRuneInString(l.source[i:])
+		i += w
+	}
+	if i >= len(l.source) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.source[i:])
+	return r
+}
+
+func (l *xpLexer) skipSpace() {
+	for l.offset < len(l.source) && strings.ContainsRune(" \t\r\n", rune(l.source[l.offset])) {
+		l.offset++
+	}
+}
+
+func isNameStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.'
+}
+
+func (l *xpLexer) readNCName() string {
+	start := l.offset
+	for l.offset < len(l.source) {
+		r, w := utf8.DecodeRuneInString(l.source[l.offset:])
+		if !isNameChar(r) {
+			break
+		}
+		l.offset += w
+	}
+	return l.source[start:l.offset]
+}
+
+// true if the previous token means that '*' and names must be operators (per the spec's disambiguation rules)
+func (l *xpLexer) expectOperator() bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	switch prev := l.tokens[len(l.tokens)-1]; prev.kind {
+	case xpAt, xpColonColon, xpLParen, xpLBracket, xpComma, xpOperator:
+		return false
+	}
+	return true
+}
+
+func (l *xpLexer) emit(kind xpTokenKind, text string, start int) {
+	l.tokens = append(l.tokens, xpToken{kind: kind, text: text, offset: start})
+}
+
+func lexXPath(source string) (tokens []xpToken, err error) {
+
+	l := &xpLexer{source: source}
+
+	for {
+		l.skipSpace()
+		start := l.offset
+		if l.offset >= len(source) {
+			l.emit(xpEOF, "", start)
+			return l.tokens, nil
+		}
+
+		r := l.peekRune(0)
+		switch {
+		case r == '(':
+			l.offset++
+			l.emit(xpLParen, "(", start)
+		case r == ')':
+			l.offset++
+			l.emit(xpRParen, ")", start)
+		case r == '[':
+			l.offset++
+			l.emit(xpLBracket, "[", start)
+		case r == ']':
+			l.offset++
+			l.emit(xpRBracket, "]", start)
+		case r == '@':
+			l.offset++
+			l.emit(xpAt, "@", start)
+		case r == ',':
+			l.offset++
+			l.emit(xpComma, ",", start)
+		case r == ':' && l.peekRune(1) == ':':
+			l.offset += 2
+			l.emit(xpColonColon, "::", start)
+		case r == '.' && l.peekRune(1) == '.':
+			l.offset += 2
+			l.emit(xpDotDot, "..", start)
+		case r == '.' && !unicode.IsDigit(l.peekRune(1)):
+			l.offset++
+			l.emit(xpDot, ".", start)
+		case r == '.' || unicode.IsDigit(r):
+			for l.offset < len(source) && unicode.IsDigit(rune(source[l.offset])) {
+				l.offset++
+			}
+			if l.offset < len(source) && source[l.offset] == '.' {
+				l.offset++
+				for l.offset < len(source) && unicode.IsDigit(rune(source[l.offset])) {
+					l.offset++
+				}
+			}
+			text := source[start:l.offset]
+			number, _ := strconv.ParseFloat(text, 64)
+			l.tokens = append(l.tokens, xpToken{kind: xpNumeric, text: text, number: number, offset: start})
+		case r == '"' || r == '\'':
+			end := strings.IndexRune(source[start+1:], r)
+			if end == -1 {
+				return nil, l.fail("unterminated literal")
+			}
+			l.offset = start + 1 + end + 1
+			l.emit(xpLiteral, source[start+1:start+1+end], start)
+		case r == '$':
+			l.offset++
+			name := l.readQName()
+			if name == "" {
+				return nil, l.fail("expected a variable name")
+			}
+			l.emit(xpVariable, name, start)
+		case r == '/' && l.peekRune(1) == '/':
+			l.offset += 2
+			l.emit(xpOperator, "//", start)
+		case r == '!' && l.peekRune(1) == '=':
+			l.offset += 2
+			l.emit(xpOperator, "!=", start)
+		case (r == '<' || r == '>') && l.peekRune(1) == '=':
+			l.offset += 2
+			l.emit(xpOperator, source[start:l.offset], start)
+		case strings.ContainsRune("/|+-=<>", r):
+			l.offset++
+			l.emit(xpOperator, string(r), start)
+		case r == '*':
+			l.offset++
+			if l.expectOperator() {
+				l.emit(xpOperator, "*", start)
+			} else {
+				l.emit(xpNameTest, "*", start)
+			}
+		case isNameStart(r):
+			err = l.lexName(start)
+			if err != nil {
+				return
+			}
+		default:
+			return nil, l.fail("unexpected character %q", r)
+		}
+	}
+}
+
+// reads prefix:local (or just local)
+func (l *xpLexer) readQName() string {
+	name := l.readNCName()
+	if name != "" && l.peekRune(0) == ':' && isNameStart(l.peekRune(1)) {
+		l.offset++
+		name += ":" + l.readNCName()
+	}
+	return name
+}
+
+// names can be operators, functions, node types, axes or name tests depending on context
+func (l *xpLexer) lexName(start int) (err error) {
+
+	if l.expectOperator() {
+		name := l.readNCName()
+		switch name {
+		case "and", "or", "mod", "div":
+			l.emit(xpOperator, name, start)
+			return
+		}
+		return l.fail("expected an operator, found %q", name)
+	}
+
+	name := l.readNCName()
+
+	// prefix:* or prefix:local
+	if l.peekRune(0) == ':' && l.peekRune(1) != ':' {
+		switch next := l.peekRune(1); {
+		case next == '*':
+			l.offset += 2
+			l.emit(xpNameTest, name+":*", start)
+			return
+		case isNameStart(next):
+			l.offset++
+			name += ":" + l.readNCName()
+		}
+	}
+
+	// look past any whitespace for ( or ::
+	save := l.offset
+	l.skipSpace()
+	switch {
+	case l.peekRune(0) == '(':
+		if xpNodeTypes[name] {
+			l.emit(xpNodeType, name, start)
+		} else {
+			l.emit(xpFunction, name, start)
+		}
+	case l.peekRune(0) == ':' && l.peekRune(1) == ':':
+		l.emit(xpAxis, name, start)
+	default:
+		l.emit(xpNameTest, name, start)
+	}
+	l.offset = save
+	return
+}
+
+////////////////////////////////////////////////////
+// parser
+
+type xpParser struct {
+	source string
+	tokens []xpToken
+	index  int
+}
+
+func (p *xpParser) peek() xpToken {
+	return p.tokens[p.index]
+}
+
+func (p *xpParser) next() xpToken {
+	t := p.tokens[p.index]
+	if t.kind != xpEOF {
+		p.index++
+	}
+	return t
+}
+
+func (p *xpParser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != xpOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *xpParser) fail(msg string, args ...any) error {
+	return &XPathSyntaxError{Expr: p.source, Offset: p.peek().offset, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func (p *xpParser) expect(kind xpTokenKind, what string) (t xpToken, err error) {
+	t = p.next()
+	if t.kind != kind {
+		err = &XPathSyntaxError{Expr: p.source, Offset: t.offset, Msg: fmt.Sprintf("expected %s, found %s", what, t.describe())}
+	}
+	return
+}
+
+func parseXPath(source string) (expr xpExpr, err error) {
+
+	tokens, err := lexXPath(source)
+	if err != nil {
+		return
+	}
+
+	p := &xpParser{source: source, tokens: tokens}
+	expr, err = p.parseOr()
+	if err != nil {
+		return
+	}
+
+	if p.peek().kind != xpEOF {
+		err = p.fail("unexpected %s", p.peek().describe())
+	}
+	return
+}
+
+// left-associative binary operator levels
+func (p *xpParser) parseBinary(operand func() (xpExpr, error), ops ...string) (expr xpExpr, err error) {
+	expr, err = operand()
+	if err != nil {
+		return
+	}
+	for p.isOperator(ops...) {
+		op := p.next().text
+		var rhs xpExpr
+		rhs, err = operand()
+		if err != nil {
+			return
+		}
+		expr = &xpBinary{op: op, lhs: expr, rhs: rhs}
+	}
+	return
+}
+
+func (p *xpParser) parseOr() (xpExpr, error) {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *xpParser) parseAnd() (xpExpr, error) {
+	return p.parseBinary(p.parseEquality, "and")
+}
+
+func (p *xpParser) parseEquality() (xpExpr, error) {
+	return p.parseBinary(p.parseRelational, "=", "!=")
+}
+
+func (p *xpParser) parseRelational() (xpExpr, error) {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *xpParser) parseAdditive() (xpExpr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *xpParser) parseMultiplicative() (xpExpr, error) {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *xpParser) parseUnary() (expr xpExpr, err error) {
+	if p.isOperator("-") {
+		p.next()
+		expr, err = p.parseUnary()
+		if err != nil {
+			return
+		}
+		expr = &xpNegate{operand: expr}
+		return
+	}
+	return p.parseBinary(p.parsePath, "|")
+}
+
+// true if the next token can start a location step
+func (p *xpParser) atStep() bool {
+	switch p.peek().kind {
+	case xpNameTest, xpNodeType, xpAxis, xpAt, xpDot, xpDotDot:
+		return true
+	}
+	return false
+}
+
+func (p *xpParser) parsePath() (expr xpExpr, err error) {
+
+	// absolute location path
+	if p.isOperator("/", "//") {
+		path := &xpPath{absolute: true}
+		if p.next().text == "//" {
+			path.steps = append(path.steps, descendantOrSelfStep())
+		} else if !p.atStep() {
+			// just "/" (the root)
+			expr = path
+			return
+		}
+		err = p.parseRelativePath(path)
+		expr = path
+		return
+	}
+
+	// relative location path
+	if p.atStep() {
+		path := &xpPath{}
+		err = p.parseRelativePath(path)
+		expr = path
+		return
+	}
+
+	// filter expression, optionally followed by a relative path
+	expr, err = p.parseFilter()
+	if err != nil {
+		return
+	}
+	if p.isOperator("/", "//") {
+		path := &xpPath{filter: expr}
+		if p.next().text == "//" {
+			path.steps = append(path.steps, descendantOrSelfStep())
+		}
+		err = p.parseRelativePath(path)
+		expr = path
+	}
+	return
+}
+
+func descendantOrSelfStep() *xpStep {
+	return &xpStep{axis: "descendant-or-self", test: xpNodeTest{kind: "node"}}
+}
+
+func (p *xpParser) parseRelativePath(path *xpPath) (err error) {
+	for {
+		var step *xpStep
+		step, err = p.parseStep()
+		if err != nil {
+			return
+		}
+		path.steps = append(path.steps, step)
+
+		if !p.isOperator("/", "//") {
+			return
+		}
+		if p.next().text == "//" {
+			path.steps = append(path.steps, descendantOrSelfStep())
+		}
+	}
+}
+
+var xpAxes = map[string]bool{
+	"ancestor": true, "ancestor-or-self": true, "attribute": true, "child": true, "descendant": true,
+	"descendant-or-self": true, "following": true, "following-sibling": true, "namespace": true,
+	"parent": true, "preceding": true, "preceding-sibling": true, "self": true,
+}
+
+func (p *xpParser) parseStep() (step *xpStep, err error) {
+
+	switch t := p.peek(); t.kind {
+	case xpDot:
+		p.next()
+		step = &xpStep{axis: "self", test: xpNodeTest{kind: "node"}}
+		return
+	case xpDotDot:
+		p.next()
+		step = &xpStep{axis: "parent", test: xpNodeTest{kind: "node"}}
+		return
+	case xpAt:
+		p.next()
+		step = &xpStep{axis: "attribute"}
+	case xpAxis:
+		p.next()
+		if !xpAxes[t.text] {
+			err = &XPathSyntaxError{Expr: p.source, Offset: t.offset, Msg: fmt.Sprintf("unknown axis %q", t.text)}
+			return
+		}
+		_, err = p.expect(xpColonColon, "::")
+		if err != nil {
+			return
+		}
+		step = &xpStep{axis: t.text}
+	default:
+		step = &xpStep{axis: "child"}
+	}
+
+	step.test, err = p.parseNodeTest()
+	if err != nil {
+		return
+	}
+
+	step.predicates, err = p.parsePredicates()
+	return
+}
+
+func (p *xpParser) parseNodeTest() (test xpNodeTest, err error) {
+	switch t := p.next(); t.kind {
+	case xpNameTest:
+		test.kind = "name"
+		test.name = t.text
+		if prefix, local, ok := strings.Cut(t.text, ":"); ok {
+			test.prefix = prefix
+			test.name = local
+		}
+	case xpNodeType:
+		test.kind = t.text
+		_, err = p.expect(xpLParen, "(")
+		if err != nil {
+			return
+		}
+		if t.text == "processing-instruction" && p.peek().kind == xpLiteral {
+			test.name = p.next().text
+		}
+		_, err = p.expect(xpRParen, ")")
+	default:
+		err = &XPathSyntaxError{Expr: p.source, Offset: t.offset, Msg: fmt.Sprintf("expected a node test, found %s", t.describe())}
+	}
+	return
+}
+
+func (p *xpParser) parsePredicates() (predicates []xpExpr, err error) {
+	for p.peek().kind == xpLBracket {
+		p.next()
+		var predicate xpExpr
+		predicate, err = p.parseOr()
+		if err != nil {
+			return
+		}
+		_, err = p.expect(xpRBracket, "]")
+		if err != nil {
+			return
+		}
+		predicates = append(predicates, predicate)
+	}
+	return
+}
+
+func (p *xpParser) parseFilter() (expr xpExpr, err error) {
+	expr, err = p.parsePrimary()
+	if err != nil {
+		return
+	}
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return
+	}
+	if len(predicates) != 0 {
+		expr = &xpFilter{primary: expr, predicates: predicates}
+	}
+	return
+}
+
+func (p *xpParser) parsePrimary() (expr xpExpr, err error) {
+	switch t := p.next(); t.kind {
+	case xpVariable:
+		expr = &xpVariableRef{name: t.text}
+	case xpLiteral:
+		expr = &xpLiteralExpr{value: t.text}
+	case xpNumeric:
+		expr = &xpNumberExpr{value: t.number}
+	case xpLParen:
+		expr, err = p.parseOr()
+		if err != nil {
+			return
+		}
+		_, err = p.expect(xpRParen, ")")
+	case xpFunction:
+		expr, err = p.parseFunctionCall(t)
+	default:
+		err = &XPathSyntaxError{Expr: p.source, Offset: t.offset, Msg: fmt.Sprintf("unexpected %s", t.describe())}
+	}
+	return
+}
+
+func (p *xpParser) parseFunctionCall(name xpToken) (expr xpExpr, err error) {
+
+	fn, ok := xpFunctions[name.text]
+	if !ok {
+		err = &XPathSyntaxError{Expr: p.source, Offset: name.offset, Msg: fmt.Sprintf("unknown function %s()", name.text)}
+		return
+	}
+
+	_, err = p.expect(xpLParen, "(")
+	if err != nil {
+		return
+	}
+
+	call := &xpCall{name: name.text, fn: fn}
+	if p.peek().kind != xpRParen {
+		for {
+			var arg xpExpr
+			arg, err = p.parseOr()
+			if err != nil {
+				return
+			}
+			call.args = append(call.args, arg)
+			if p.peek().kind != xpComma {
+				break
+			}
+			p.next()
+		}
+	}
+	_, err = p.expect(xpRParen, ")")
+	if err != nil {
+		return
+	}
+
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		err = &XPathSyntaxError{Expr: p.source, Offset: name.offset, Msg: fmt.Sprintf("wrong number of arguments to %s()", name.text)}
+		return
+	}
+
+	expr = call
+	return
+}
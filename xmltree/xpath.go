@@ -1,10 +1,5 @@
 package xmltree
 
-type ParentChildElement struct {
-	Parent *XMLElement
-	Child  *XMLElement
-}
-
 type Finder func(element *XMLElement) bool
 
 // find the given element which has that value
@@ -27,37 +22,69 @@ func (tree *XMLTree) FindElementWithAll(properties ...SearchProperty) (element *
 // returns the parent and the element (parent is nil if th root element is the matching target)
 func (tree *XMLTree) FindUsing(finder Finder) (parent, element *XMLElement) {
 
+	// start with our (root) element(s) (which have no parent)
+	traverseBFS(tree.Elements.Elements(), nil, func(v *elementVisit) bool {
+
+		// check if we've found our target
+		if finder(v.element) {
+			parent = v.parent.Element()
+			element = v.element
+			return false
+		}
+
+		return true
+	})
+
+	return
+}
+
+// one step of a traversal: the element, and how we got there
+type elementVisit struct {
+	element  *XMLElement
+	parent   *elementVisit // nil for the top of the traversal
+	siblings []*XMLElement // our parent's elements (including us)
+	index    int           // our index within siblings
+}
+
+// returns the visited element (nil safe)
+func (v *elementVisit) Element() *XMLElement {
+	if v == nil {
+		return nil
+	}
+	return v.element
+}
+
+// visits each element breadth first, starting with roots (stops as soon as visit returns false)
+// top is the visit for the roots' parent (nil if they have none)
+func traverseBFS(roots []*XMLElement, top *elementVisit, visit func(v *elementVisit) bool) {
+
 	// use a simple bfs algo
-	var queue []*ParentChildElement
-	pop := func() *ParentChildElement {
+	var queue []*elementVisit
+	pop := func() *elementVisit {
 		if len(queue) == 0 {
 			return nil
 		}
-		e := queue[0]
+		v := queue[0]
 		queue = queue[1:]
-		return e
+		return v
 	}
 
-	// start with our (root) element(s) (which have no parent)
-	for _, e := range tree.Elements.Elements() {
-		queue = append(queue, &ParentChildElement{nil, e})
+	enqueue := func(parent *elementVisit, elements []*XMLElement) {
+		for i, e := range elements {
+			queue = append(queue, &elementVisit{element: e, parent: parent, siblings: elements, index: i})
+		}
 	}
 
-	// process each node until we find it, or there are no more nodes
-	for pc := pop(); pc != nil; pc = pop() {
+	enqueue(top, roots)
 
-		// check if we've found our target
-		if finder(pc.Child) {
-			parent = pc.Parent
-			element = pc.Child
+	// process each node until we're told to stop, or there are no more nodes
+	for v := pop(); v != nil; v = pop() {
+
+		if !visit(v) {
 			return
 		}
 
 		// queue up this child's children
-		for _, e := range pc.Child.Elements() {
-			queue = append(queue, &ParentChildElement{pc.Child, e})
-		}
+		enqueue(v, v.element.Elements())
 	}
-
-	return
 }
@@ -0,0 +1,171 @@
+package xmltree
+
+import (
+	"strings"
+	"testing"
+)
+
+const xpathDoc = `<?xml version="1.0"?>
+<Shop name="corner">
+	<!-- stock -->
+	<Item id="a" kind="tool"><Name>hammer</Name><Cost>10</Cost></Item>
+	<Item id="b" kind="food"><Name>apple</Name><Cost>1.5</Cost></Item>
+	<Item id="c" kind="tool"><Name>saw</Name><Cost>25</Cost></Item>
+	<Staff><Name>ann</Name></Staff>
+</Shop>`
+
+// the node-set as a space separated list of names (and values, for attributes and text)
+func xpathNames(nodes []*XPathNode) string {
+	var names []string
+	for _, n := range nodes {
+		switch n.Kind() {
+		case XPathElementNode:
+			if id, ok := n.Element().Attribute("id"); ok {
+				names = append(names, n.String()+"#"+id)
+				continue
+			}
+			names = append(names, n.String())
+		case XPathAttributeNode, XPathTextNode:
+			names = append(names, n.String()+"="+n.StringValue())
+		default:
+			names = append(names, n.String())
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func TestXPathNodeSets(t *testing.T) {
+	tree := readTree(t, xpathDoc)
+	tests := []struct{ path, want string }{
+		// axes
+		{"/Shop/Item", "Item#a Item#b Item#c"},
+		{"//Name", "Name Name Name Name"},
+		{"/Shop/Item/@id", "@id=a @id=b @id=c"},
+		{"/Shop/comment()", "comment()"},
+		{"/Shop/Item[2]/following-sibling::*", "Item#c Staff"},
+		{"/Shop/Item[2]/preceding-sibling::*", "Item#a"},
+		{"/Shop/Item[2]/Cost/ancestor::*", "Shop Item#b"},
+		{"/Shop/Item[2]/Cost/ancestor-or-self::*", "Shop Item#b Cost"},
+		{"/Shop/Item[3]/preceding::Cost", "Cost Cost"},
+		{"/Shop/Item[1]/following::Name", "Name Name Name"},
+		{"//Cost/..", "Item#a Item#b Item#c"},
+		{"//Name/text()", "text()=hammer text()=apple text()=saw text()=ann"},
+		{"/Shop/Item[1]/descendant::*", "Name Cost"},
+		{"/Shop/Item[1]/self::Item", "Item#a"},
+		{"/Shop/Item[1]/self::Staff", ""},
+
+		// predicates
+		{"/Shop/Item[@kind='tool']", "Item#a Item#c"},
+		{"/Shop/Item[Cost > 5]", "Item#a Item#c"},
+		{"/Shop/Item[last()]", "Item#c"},
+		{"/Shop/Item[position() < 3][@kind='tool']", "Item#a"},
+		{"/Shop/Item[@kind='tool'][2]", "Item#c"},
+		{"/Shop/*[not(@kind)]", "Staff"},
+
+		// unions come back in document order
+		{"//Staff | //Item[1] | /Shop", "Shop Item#a Staff"},
+		{"/Shop/Item[3]/preceding-sibling::*[1]", "Item#b"},
+		{"(/Shop/Item[3]/preceding-sibling::*)[1]", "Item#a"},
+	}
+	for _, test := range tests {
+		result, err := tree.XPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got := xpathNames(result.Nodes()); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestXPathValues(t *testing.T) {
+	tree := readTree(t, xpathDoc)
+	tests := []struct{ path, want string }{
+		{"count(//Item)", "3"},
+		{"sum(//Cost)", "36.5"},
+		{"string(/Shop/@name)", "corner"},
+		{"concat(/Shop/Item[1]/Name, '-', /Shop/Item[1]/@id)", "hammer-a"},
+		{"substring-before('a=b', '=')", "a"},
+		{"substring-after('a=b', '=')", "b"},
+		{"substring('12345', 2, 3)", "234"},
+		{"string-length(/Shop/Item[2]/Name)", "5"},
+		{"normalize-space('  a   b ')", "a b"},
+		{"translate('abc', 'ab', 'AB')", "ABc"},
+		{"starts-with(/Shop/Item[3]/Name, 'sa')", "true"},
+		{"contains(/Shop/@name, 'x')", "false"},
+		{"name(/Shop/*[last()])", "Staff"},
+		{"local-name(//@kind)", "kind"},
+		{"floor(1.5) + ceiling(1.5) + round(2.5)", "6"},
+		{"10 div 4", "2.5"},
+		{"7 mod 3", "1"},
+		{"boolean(//Missing)", "false"},
+		{"//Item[Cost = 25]/Name", "saw"},
+		{"number('x')", "NaN"},
+	}
+	for _, test := range tests {
+		result, err := tree.XPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got := result.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestXPathElementContext(t *testing.T) {
+	tree := readTree(t, xpathDoc)
+	b := tree.Elements.Elements()[0].Elements()[1]
+	tests := []struct{ path, want string }{
+		{"Name", "Name"},
+		{".", "Item#b"},
+		{"..", "Shop"},
+		{"../Staff", "Staff"},
+		{"following-sibling::Item", "Item#c"},
+		{"preceding-sibling::*", "Item#a"},
+		{"/Shop/Item", "Item#a Item#b Item#c"},
+		{"//Name", "Name Name Name Name"},
+		{"ancestor::*", "Shop"},
+		{"preceding::Name", "Name"},
+	}
+	for _, test := range tests {
+		result, err := b.XPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got := xpathNames(result.Nodes()); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+		}
+	}
+
+	// position() and last() of a lone context node
+	result, err := b.XPath("position() = last()")
+	if err != nil || !result.Bool() {
+		t.Errorf("position() = last(): got %v, %v", result.Value(), err)
+	}
+}
+
+func TestXPathDetachedElement(t *testing.T) {
+	e := readTree(t, `<a><b /></a>`).Elements.Elements()[0].Child("b")
+	if err := e.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	elements, err := e.XPathElements("/b | ..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 1 || elements[0] != e {
+		t.Errorf("got %v, want just the element itself", elements)
+	}
+}
+
+func TestXPathSyntaxErrors(t *testing.T) {
+	for _, path := range []string{"/Shop/", "//Item[", "foo::bar", "count(", "1 +"} {
+		if _, err := CompileXPath(path); err == nil {
+			t.Errorf("%s: compiled", path)
+		}
+	}
+}